@@ -0,0 +1,476 @@
+package supago
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/client"
+	"github.com/train360-corp/supago/internal/s3"
+	"github.com/train360-corp/supago/internal/utils"
+	"github.com/train360-corp/supago/internal/wal"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// archive layout (in ArchiveConfig.Directory, and under S3Config.Prefix)
+const (
+	archiveMountPath      = "/var/lib/postgresql/archive" // where the archive directory is mounted in the database container
+	archiveWALDir         = "wal"                         // WAL segments, by name
+	archiveBaseDir        = "base"                        // base backups, as "<label>/{base.tar.gz,backup_label,backup.json}"
+	baseBackupArchive     = "base.tar.gz"
+	baseBackupLabel       = "backup_label"
+	baseBackupMetadata    = "backup.json"
+	defaultArchiveTimeout = time.Minute
+)
+
+// ArchiveConfig continuous WAL archiving (archive_mode=on), with periodic base backups
+type ArchiveConfig struct {
+	// Directory (on the host) WAL segments and base backups are archived to
+	// It is shared with the database container's postgres user through the group of the current process.
+	Directory string
+	// S3 (optional) an S3-compatible bucket the archive is mirrored to (and recovered from); see ScheduleArchiving
+	S3 *S3Config
+	// Timeout forces a WAL segment switch at least this often while there are writes (archive_timeout; defaults to a
+	// minute), bounding how much recent data the archive can be missing
+	Timeout time.Duration
+	// BaseBackupEvery how often to take a base backup (see ScheduleArchiving); aligned as BackupSchedule.Every is
+	BaseBackupEvery time.Duration
+	// BaseBackupOffset shifts the aligned base backups (as BackupSchedule.Offset does)
+	BaseBackupOffset time.Duration
+	// Retention how many of the newest base backups (and the WAL needed to recover from them) to keep (0 keeps all)
+	Retention int
+}
+
+// S3Config an S3-compatible bucket (AWS S3, MinIO, ...), addressed path-style
+type S3Config struct {
+	// Endpoint e.g., "http://127.0.0.1:9000" (MinIO) or "https://s3.us-east-1.amazonaws.com"
+	Endpoint        string
+	Region          string // defaults to us-east-1
+	Bucket          string
+	Prefix          string // e.g., "supago/production/"
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// BaseBackup a physical copy of the data directory, from which WAL is replayed during recovery
+type BaseBackup struct {
+	Label        string    `json:"label"`
+	StartSegment string    `json:"start_segment"` // the first WAL segment needed to recover from the backup
+	StartTime    time.Time `json:"start_time"`
+	StopTime     time.Time `json:"stop_time"` // the earliest time the backup can be recovered to
+	Size         int64     `json:"size"`
+}
+
+// validate the archive settings
+func (a ArchiveConfig) validate() error {
+	if a.Directory == "" {
+		return errors.New("archive has no directory")
+	} else if a.Timeout < 0 {
+		return fmt.Errorf("archive timeout must not be negative, got %v", a.Timeout)
+	} else if a.BaseBackupEvery != 0 && a.BaseBackupEvery < time.Minute {
+		return fmt.Errorf("base backup interval must be at least a minute, got %v", a.BaseBackupEvery)
+	} else if a.BaseBackupOffset < 0 {
+		return fmt.Errorf("base backup offset must not be negative, got %v", a.BaseBackupOffset)
+	} else if a.Retention < 0 {
+		return fmt.Errorf("archive retention must not be negative, got %d", a.Retention)
+	}
+	if a.S3 != nil {
+		if _, err := a.s3(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a ArchiveConfig) s3() (*s3.Client, error) {
+	return s3.New(a.S3.Endpoint, a.S3.Region, a.S3.Bucket, a.S3.AccessKeyID, a.S3.SecretAccessKey)
+}
+
+// postgresSettings the postgres command-line settings for archiving (archiving disabled if archive is nil)
+// The restore_command is set regardless of recovery: postgres only uses it while recovering (see SupaGo.RecoverTo).
+func (a *ArchiveConfig) postgresSettings() []string {
+	if a == nil {
+		return []string{"-c", "archive_mode=off"}
+	}
+	timeout := a.Timeout
+	if timeout == 0 {
+		timeout = defaultArchiveTimeout
+	}
+	dir := path.Join(archiveMountPath, archiveWALDir)
+	return []string{
+		"-c", "archive_mode=on",
+		// idempotent (an already archived, identical, segment succeeds), and atomic (via rename)
+		"-c", fmt.Sprintf(`archive_command=f=%s/%%f; if [ -f "$f" ]; then cmp -s "%%p" "$f"; else cp "%%p" "$f.tmp" && chmod 0640 "$f.tmp" && mv "$f.tmp" "$f"; fi`, dir),
+		"-c", fmt.Sprintf("archive_timeout=%d", int(timeout.Seconds())),
+		"-c", fmt.Sprintf(`restore_command=cp %s/%%f "%%p"`, dir),
+	}
+}
+
+// shareArchive makes the archive directory (or a part of it) in the database container accessible to both the
+// container's postgres user, and the group of the current (host) process
+func shareArchive(ctx context.Context, docker *client.Client, cid string, paths ...string) error {
+	gid := os.Getgid()
+	if gid < 0 { // e.g., windows
+		gid = 0
+	}
+	if len(paths) == 0 {
+		paths = []string{archiveMountPath}
+	}
+	script := fmt.Sprintf(
+		`mkdir -p %[1]s/%[2]s %[1]s/%[3]s && chown -R postgres:%[4]d "$@" && chmod -R u+rwX,g+rwX,o-rwx "$@" && find "$@" -type d -exec chmod g+s {} +`,
+		archiveMountPath, archiveWALDir, archiveBaseDir, gid,
+	)
+	output, err := utils.ExecInContainer(ctx, docker, cid, append([]string{"sh", "-c", script, "sh"}, paths...))
+	if err != nil {
+		return fmt.Errorf("failed to share archive directory: %v (%s)", err, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// BaseBackup takes a base backup into the archive (see ArchiveConfig)
+// The data directory is copied while the database keeps running (pg_backup_start / pg_backup_stop); the backup is
+// complete once the WAL written meanwhile has been archived.
+func (sg *SupaGo) BaseBackup(ctx context.Context) (*BaseBackup, error) {
+	sg.mu.Lock()
+	archive := sg.config.Database.Archive
+	db, err := sg.database("supabase_admin", "postgres")
+	sg.mu.Unlock()
+	if archive == nil {
+		return nil, errors.New("archiving is not configured")
+	} else if err != nil {
+		return nil, err
+	}
+
+	started := time.Now().UTC()
+	backup := &BaseBackup{Label: "base-" + started.Format("20060102T150405Z")}
+	dir := path.Join(archiveMountPath, archiveBaseDir, backup.Label)
+	script := fmt.Sprintf(`SELECT pg_backup_start(%[1]s, true);
+\! mkdir -p %[2]s && tar -C /var/lib/postgresql/data --exclude='./pg_wal/*' --exclude='./pg_replslot/*' --exclude='./pg_stat_tmp/*' --exclude=./postmaster.pid --exclude=./postmaster.opts -czf %[2]s/%[3]s . ; echo $? > %[2]s/tar.status
+\pset tuples_only on
+\pset format unaligned
+\o %[2]s/%[4]s
+SELECT labelfile FROM pg_backup_stop(true);
+\o
+`, utils.QuoteLiteral(backup.Label), dir, baseBackupArchive, baseBackupLabel)
+
+	scriptFile := "/tmp/supago/sql/base-backup.sql"
+	if err := utils.CopyToContainer(ctx, db.docker, db.cid, EmbeddedFile{Data: []byte(script), Path: scriptFile}); err != nil {
+		return nil, fmt.Errorf("failed to copy base backup script into container: %w", err)
+	}
+	defer func() {
+		_, _ = utils.ExecInContainer(context.Background(), db.docker, db.cid, []string{"rm", "-f", scriptFile})
+	}()
+	sg.logger.Infof("taking base backup %s", backup.Label)
+	if _, err := execPsql(ctx, db.docker, db.cid, db.user, db.name, "-f", scriptFile); err != nil {
+		_, _ = utils.ExecInContainer(context.Background(), db.docker, db.cid, []string{"rm", "-rf", dir})
+		return nil, fmt.Errorf("failed to take base backup: %w", err)
+	}
+	backup.StopTime = time.Now().UTC()
+
+	// tar exits with 1 when files changed while being read (expected: WAL replay makes them consistent)
+	output, err := utils.ExecInContainer(ctx, db.docker, db.cid, []string{"sh", "-c",
+		fmt.Sprintf("cat %[1]s/tar.status && rm -f %[1]s/tar.status && stat -c %%s %[1]s/%[2]s && cat %[1]s/%[3]s", dir, baseBackupArchive, baseBackupLabel),
+	})
+	lines := strings.SplitN(output, "\n", 3)
+	if err != nil || len(lines) < 3 {
+		_, _ = utils.ExecInContainer(context.Background(), db.docker, db.cid, []string{"rm", "-rf", dir})
+		return nil, fmt.Errorf("failed to inspect base backup: %v (%s)", err, strings.TrimSpace(output))
+	} else if status := strings.TrimSpace(lines[0]); status != "0" && status != "1" {
+		_, _ = utils.ExecInContainer(context.Background(), db.docker, db.cid, []string{"rm", "-rf", dir})
+		return nil, fmt.Errorf("failed to copy data directory for base backup (tar exited with %s)", status)
+	}
+	if backup.Size, err = strconv.ParseInt(strings.TrimSpace(lines[1]), 10, 64); err != nil {
+		return nil, fmt.Errorf("failed to size base backup: %w", err)
+	}
+	label, err := wal.ParseLabel(lines[2])
+	if err != nil {
+		return nil, err
+	}
+	backup.StartSegment, backup.StartTime = label.StartSegment, label.StartTime
+
+	// the metadata is written last: it marks the backup complete
+	metadata, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode base backup metadata: %w", err)
+	}
+	if err := utils.CopyToContainer(ctx, db.docker, db.cid, EmbeddedFile{Data: metadata, Path: path.Join(dir, baseBackupMetadata)}); err != nil {
+		return nil, fmt.Errorf("failed to write base backup metadata: %w", err)
+	}
+	if err := shareArchive(ctx, db.docker, db.cid, dir); err != nil {
+		return nil, err
+	}
+
+	sg.logger.Infow("base backup completed",
+		"label", backup.Label,
+		"size", backup.Size,
+		"duration", backup.StopTime.Sub(started),
+		"start_segment", backup.StartSegment,
+	)
+	return backup, nil
+}
+
+// BaseBackups the complete base backups in the (local) archive, oldest first
+func (sg *SupaGo) BaseBackups() ([]BaseBackup, error) {
+	sg.mu.Lock()
+	archive := sg.config.Database.Archive
+	sg.mu.Unlock()
+	if archive == nil {
+		return nil, errors.New("archiving is not configured")
+	}
+	return readBaseBackups(archive.Directory)
+}
+
+func readBaseBackups(dir string) ([]BaseBackup, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, archiveBaseDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list base backups: %w", err)
+	}
+	var backups []BaseBackup
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, archiveBaseDir, entry.Name(), baseBackupMetadata))
+		if errors.Is(err, os.ErrNotExist) {
+			continue // incomplete
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read base backup %s: %w", entry.Name(), err)
+		}
+		var backup BaseBackup
+		if err := json.Unmarshal(data, &backup); err != nil {
+			return nil, fmt.Errorf("failed to decode base backup %s: %w", entry.Name(), err)
+		}
+		backups = append(backups, backup)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Label < backups[j].Label })
+	return backups, nil
+}
+
+// ScheduleArchiving runs the archive's background work until ctx is done (in the background): base backups every
+// ArchiveConfig.BaseBackupEvery (pruned to ArchiveConfig.Retention), and mirroring the archive to ArchiveConfig.S3
+// Failures are logged, and retried at the next run.
+func (sg *SupaGo) ScheduleArchiving(ctx context.Context) error {
+	sg.mu.Lock()
+	archive := sg.config.Database.Archive
+	sg.mu.Unlock()
+	if archive == nil {
+		return errors.New("archiving is not configured")
+	} else if err := archive.validate(); err != nil {
+		return err
+	} else if archive.BaseBackupEvery == 0 && archive.S3 == nil {
+		return errors.New("archive has neither base backups nor S3 mirroring configured")
+	}
+
+	var bucket *s3.Client
+	interval := archive.Timeout
+	if archive.S3 != nil {
+		bucket, _ = archive.s3() // validated above
+		if interval == 0 {
+			interval = defaultArchiveTimeout
+		}
+	}
+	schedule := BackupSchedule{Every: archive.BaseBackupEvery, Offset: archive.BaseBackupOffset}
+
+	go func() {
+		var mirror <-chan time.Time
+		if bucket != nil {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			mirror = ticker.C
+		}
+		for {
+			var next <-chan time.Time
+			var timer *time.Timer
+			if schedule.Every > 0 {
+				at := schedule.next(time.Now())
+				sg.logger.Debugf("next base backup at %s", at.Format(time.RFC3339))
+				timer = time.NewTimer(time.Until(at))
+				next = timer.C
+			}
+			select {
+			case <-ctx.Done():
+				if timer != nil {
+					timer.Stop()
+				}
+				sg.logger.Debug("archiving schedule stopped")
+				return
+			case <-next:
+				if _, err := sg.BaseBackup(ctx); err != nil {
+					sg.logger.Errorf("scheduled base backup failed: %v", err)
+				} else if archive.Retention > 0 {
+					sg.pruneArchive(ctx, *archive, bucket)
+				}
+				if bucket != nil {
+					sg.mirrorArchive(ctx, *archive, bucket)
+				}
+			case <-mirror:
+				if timer != nil {
+					timer.Stop()
+				}
+				sg.mirrorArchive(ctx, *archive, bucket)
+			}
+		}
+	}()
+	return nil
+}
+
+func (a ArchiveConfig) key(parts ...string) string {
+	return a.S3.Prefix + path.Join(parts...)
+}
+
+// mirrorArchive uploads the archived WAL segments, and complete base backups, missing from bucket
+func (sg *SupaGo) mirrorArchive(ctx context.Context, archive ArchiveConfig, bucket *s3.Client) {
+	keys, err := bucket.List(ctx, archive.S3.Prefix)
+	if err != nil {
+		sg.logger.Errorf("failed to list archive bucket: %v", err)
+		return
+	}
+	uploaded := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		uploaded[key] = true
+	}
+
+	var pending [][]string // relative paths, in upload order
+	if entries, err := os.ReadDir(filepath.Join(archive.Directory, archiveWALDir)); err != nil {
+		sg.logger.Errorf("failed to list archived WAL: %v", err)
+		return
+	} else {
+		for _, entry := range entries {
+			if !entry.IsDir() && !strings.HasSuffix(entry.Name(), ".tmp") {
+				pending = append(pending, []string{archiveWALDir, entry.Name()})
+			}
+		}
+	}
+	backups, err := readBaseBackups(archive.Directory)
+	if err != nil {
+		sg.logger.Errorf("failed to list base backups: %v", err)
+		return
+	}
+	for _, backup := range backups { // the metadata last (marks the mirrored backup complete)
+		for _, file := range []string{baseBackupArchive, baseBackupLabel, baseBackupMetadata} {
+			pending = append(pending, []string{archiveBaseDir, backup.Label, file})
+		}
+	}
+
+	var count int
+	for _, parts := range pending {
+		key := archive.key(parts...)
+		if uploaded[key] {
+			continue
+		}
+		file, err := os.Open(filepath.Join(append([]string{archive.Directory}, parts...)...))
+		if err != nil {
+			sg.logger.Errorf("failed to open %s for mirroring: %v", path.Join(parts...), err)
+			return
+		}
+		err = bucket.Put(ctx, key, file)
+		_ = file.Close()
+		if err != nil {
+			sg.logger.Errorf("failed to mirror %s: %v", path.Join(parts...), err)
+			return
+		}
+		count++
+	}
+	if count > 0 {
+		sg.logger.Debugf("mirrored %d archive files to s3", count)
+	}
+}
+
+// pruneArchive removes all but the newest archive.Retention base backups, and the WAL only needed by removed ones
+// (both locally, and in bucket if not nil)
+func (sg *SupaGo) pruneArchive(ctx context.Context, archive ArchiveConfig, bucket *s3.Client) {
+	backups, err := readBaseBackups(archive.Directory)
+	if err != nil {
+		sg.logger.Errorf("failed to list base backups for pruning: %v", err)
+		return
+	} else if len(backups) <= archive.Retention {
+		return
+	}
+	expired, kept := backups[:len(backups)-archive.Retention], backups[len(backups)-archive.Retention:]
+
+	for _, backup := range expired {
+		if err := os.RemoveAll(filepath.Join(archive.Directory, archiveBaseDir, backup.Label)); err != nil {
+			sg.logger.Errorf("failed to remove expired base backup %s: %v", backup.Label, err)
+			return
+		}
+		sg.logger.Debugf("removed expired base backup %s", backup.Label)
+	}
+	oldest := kept[0].StartSegment
+	if entries, err := os.ReadDir(filepath.Join(archive.Directory, archiveWALDir)); err != nil {
+		sg.logger.Errorf("failed to list archived WAL for pruning: %v", err)
+	} else {
+		for _, entry := range entries {
+			if wal.Expired(entry.Name(), oldest) {
+				if err := os.Remove(filepath.Join(archive.Directory, archiveWALDir, entry.Name())); err != nil {
+					sg.logger.Errorf("failed to remove expired WAL segment %s: %v", entry.Name(), err)
+				}
+			}
+		}
+	}
+
+	if bucket == nil {
+		return
+	}
+	keys, err := bucket.List(ctx, archive.S3.Prefix)
+	if err != nil {
+		sg.logger.Errorf("failed to list archive bucket for pruning: %v", err)
+		return
+	}
+	expiredLabels := make(map[string]bool, len(expired))
+	for _, backup := range expired {
+		expiredLabels[backup.Label] = true
+	}
+	for _, key := range keys {
+		parts := strings.Split(strings.TrimPrefix(key, archive.S3.Prefix), "/")
+		if len(parts) == 2 && parts[0] == archiveWALDir && wal.Expired(parts[1], oldest) ||
+			len(parts) == 3 && parts[0] == archiveBaseDir && expiredLabels[parts[1]] {
+			if err := bucket.Delete(ctx, key); err != nil {
+				sg.logger.Errorf("failed to remove expired %s from s3: %v", key, err)
+			}
+		}
+	}
+}
+
+// downloadArchive fetches the base backups and WAL segments missing from the local archive from bucket
+func downloadArchive(ctx context.Context, archive ArchiveConfig, bucket *s3.Client) error {
+	keys, err := bucket.List(ctx, archive.S3.Prefix)
+	if err != nil {
+		return fmt.Errorf("failed to list archive bucket: %w", err)
+	}
+	for _, key := range keys {
+		rel := strings.TrimPrefix(key, archive.S3.Prefix)
+		if strings.Contains(rel, "..") || !strings.HasPrefix(rel, archiveWALDir+"/") && !strings.HasPrefix(rel, archiveBaseDir+"/") {
+			continue
+		}
+		local := filepath.Join(archive.Directory, filepath.FromSlash(rel))
+		if _, err := os.Stat(local); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(local), 0o770); err != nil {
+			return fmt.Errorf("failed to create archive directory: %w", err)
+		}
+		file, err := os.OpenFile(local+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o660)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", rel, err)
+		}
+		err = bucket.Get(ctx, key, file)
+		if closeErr := file.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to write %s: %w", rel, closeErr)
+		}
+		if err != nil {
+			_ = os.Remove(local + ".tmp")
+			return err
+		} else if err := os.Rename(local+".tmp", local); err != nil {
+			return fmt.Errorf("failed to write %s: %w", rel, err)
+		}
+	}
+	return nil
+}
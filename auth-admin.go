@@ -0,0 +1,283 @@
+package supago
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// authAdminPerPage the default page size of ListUsers
+const authAdminPerPage = 50
+
+// AuthAdmin a client for the auth service's admin API, through Kong as the service role
+// A client is bound to the service key it was created with; get a new one after retiring rotated keys.
+type AuthAdmin struct {
+	url  string // e.g., "http://127.0.0.1:8000/auth/v1"
+	key  string
+	HTTP *http.Client
+}
+
+// AuthError an error the auth service responded with
+type AuthError struct {
+	StatusCode int
+	// Code GoTrue's error code (e.g., "email_exists", "user_not_found"), if any
+	Code    string
+	Message string
+}
+
+func (e *AuthError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("auth error %d (%s): %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("auth error %d: %s", e.StatusCode, e.Message)
+}
+
+// CreateUserParams a user to create; the email or phone is required
+type CreateUserParams struct {
+	Email    string `json:"email,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+	Password string `json:"password,omitempty"`
+	// EmailConfirm mark the email as confirmed (otherwise, the user can't sign in with it until they confirm it)
+	EmailConfirm bool           `json:"email_confirm,omitempty"`
+	PhoneConfirm bool           `json:"phone_confirm,omitempty"`
+	UserMetadata map[string]any `json:"user_metadata,omitempty"`
+	AppMetadata  map[string]any `json:"app_metadata,omitempty"`
+	// Role (optional) the user's database role (defaults to authenticated)
+	Role string `json:"role,omitempty"`
+}
+
+// UpdateUserParams changes to a user; nil fields are left unchanged
+type UpdateUserParams struct {
+	Email        *string `json:"email,omitempty"`
+	Phone        *string `json:"phone,omitempty"`
+	Password     *string `json:"password,omitempty"`
+	EmailConfirm *bool   `json:"email_confirm,omitempty"`
+	PhoneConfirm *bool   `json:"phone_confirm,omitempty"`
+	// UserMetadata (optional) merged into the user's metadata (keys set to nil are removed)
+	UserMetadata map[string]any `json:"user_metadata,omitempty"`
+	// AppMetadata (optional) merged into the user's app metadata (keys set to nil are removed)
+	AppMetadata map[string]any `json:"app_metadata,omitempty"`
+	Role        *string        `json:"role,omitempty"`
+	// BanDuration (optional) e.g., "24h", or "none" to lift a ban (see BanUser and UnbanUser)
+	BanDuration string `json:"ban_duration,omitempty"`
+}
+
+// InviteUserOptions how a user is invited
+type InviteUserOptions struct {
+	// Data (optional) the user's metadata (available to the invite email's template as .Data)
+	Data map[string]any
+	// RedirectTo (optional) where the invite link redirects to (the site URL, or one of the redirect URLs)
+	RedirectTo string
+}
+
+// ListUsersOptions a page of users; zero values list the first page of 50
+type ListUsersOptions struct {
+	Page    int // from 1
+	PerPage int
+}
+
+// UsersPage a page of users
+type UsersPage struct {
+	Users []User
+	// Total the number of users (across every page)
+	Total int
+	// NextPage the page after this one, or 0 if this is the last
+	NextPage int
+}
+
+// AuthAdmin a client for the running stack's auth admin API
+func (sg *SupaGo) AuthAdmin() (*AuthAdmin, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	for _, name := range []string{"auth", "kong"} {
+		if service := sg.service(name); service == nil || service.container == nil {
+			return nil, fmt.Errorf("%s is not running", name)
+		}
+	}
+	return &AuthAdmin{
+		url:  fmt.Sprintf("http://127.0.0.1:%d/auth/v1", sg.config.Kong.hostPort()),
+		key:  sg.config.Keys.PrivateJwt,
+		HTTP: http.DefaultClient,
+	}, nil
+}
+
+// CreateUser creates a user (without sending them any email)
+func (a *AuthAdmin) CreateUser(ctx context.Context, params CreateUserParams) (*User, error) {
+	if params.Email == "" && params.Phone == "" {
+		return nil, errors.New("a user needs an email or a phone number")
+	}
+	var user User
+	if err := a.do(ctx, http.MethodPost, "/admin/users", nil, params, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// InviteUser creates a user and emails them an invite link (to set their password through)
+func (a *AuthAdmin) InviteUser(ctx context.Context, email string, opts InviteUserOptions) (*User, error) {
+	query := url.Values{}
+	if opts.RedirectTo != "" {
+		query.Set("redirect_to", opts.RedirectTo)
+	}
+	body := map[string]any{"email": email}
+	if opts.Data != nil {
+		body["data"] = opts.Data
+	}
+	var user User
+	if err := a.do(ctx, http.MethodPost, "/invite", query, body, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUser the user with the ID
+func (a *AuthAdmin) GetUser(ctx context.Context, id string) (*User, error) {
+	var user User
+	if err := a.do(ctx, http.MethodGet, "/admin/users/"+url.PathEscape(id), nil, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ListUsers a page of users
+func (a *AuthAdmin) ListUsers(ctx context.Context, opts ListUsersOptions) (*UsersPage, error) {
+	if opts.Page < 0 || opts.PerPage < 0 {
+		return nil, errors.New("page and page size must not be negative")
+	} else if opts.Page == 0 {
+		opts.Page = 1
+	}
+	if opts.PerPage == 0 {
+		opts.PerPage = authAdminPerPage
+	}
+	query := url.Values{"page": {strconv.Itoa(opts.Page)}, "per_page": {strconv.Itoa(opts.PerPage)}}
+
+	var response struct {
+		Users []User `json:"users"`
+	}
+	header, err := a.request(ctx, http.MethodGet, "/admin/users", query, nil, &response)
+	if err != nil {
+		return nil, err
+	}
+	page := &UsersPage{Users: response.Users, Total: len(response.Users)}
+	if total, err := strconv.Atoi(header.Get("X-Total-Count")); err == nil {
+		page.Total = total
+	}
+	if opts.Page*opts.PerPage < page.Total {
+		page.NextPage = opts.Page + 1
+	}
+	return page, nil
+}
+
+// UpdateUser applies changes to the user with the ID
+func (a *AuthAdmin) UpdateUser(ctx context.Context, id string, params UpdateUserParams) (*User, error) {
+	var user User
+	if err := a.do(ctx, http.MethodPut, "/admin/users/"+url.PathEscape(id), nil, params, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetAppMetadata merges metadata into the user's app metadata (keys set to nil are removed), which, unlike user
+// metadata, users can't change themselves (e.g., their roles or tenant)
+func (a *AuthAdmin) SetAppMetadata(ctx context.Context, id string, metadata map[string]any) (*User, error) {
+	return a.UpdateUser(ctx, id, UpdateUserParams{AppMetadata: metadata})
+}
+
+// BanUser stops the user signing in (or refreshing their sessions) for duration
+func (a *AuthAdmin) BanUser(ctx context.Context, id string, duration time.Duration) (*User, error) {
+	if duration <= 0 {
+		return nil, fmt.Errorf("ban duration must be positive, got %v", duration)
+	}
+	return a.UpdateUser(ctx, id, UpdateUserParams{BanDuration: duration.String()})
+}
+
+// UnbanUser lifts the user's ban
+func (a *AuthAdmin) UnbanUser(ctx context.Context, id string) (*User, error) {
+	return a.UpdateUser(ctx, id, UpdateUserParams{BanDuration: "none"})
+}
+
+// DeleteUser deletes the user with the ID (and their identities, sessions and factors)
+func (a *AuthAdmin) DeleteUser(ctx context.Context, id string) error {
+	return a.do(ctx, http.MethodDelete, "/admin/users/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// do sends a request to the auth service, decoding its response into out (unless nil)
+func (a *AuthAdmin) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	_, err := a.request(ctx, method, path, query, in, out)
+	return err
+}
+
+// request sends a request to the auth service, decoding its response into out (unless nil) and returning its header
+func (a *AuthAdmin) request(ctx context.Context, method, path string, query url.Values, in, out any) (http.Header, error) {
+	u := a.url + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("apikey", a.key)
+	req.Header.Set("Authorization", "Bearer "+a.key)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := a.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the auth service: %w", err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the auth service's response: %w", err)
+	}
+	if res.StatusCode >= 300 {
+		return nil, authError(res.StatusCode, data)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return nil, fmt.Errorf("failed to decode the auth service's response: %w", err)
+		}
+	}
+	return res.Header, nil
+}
+
+// authError the error in an auth service (or Kong) error response
+func authError(status int, body []byte) *AuthError {
+	var response struct {
+		ErrorCode        string `json:"error_code"`
+		Msg              string `json:"msg"`
+		Message          string `json:"message"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	_ = json.Unmarshal(body, &response)
+	err := &AuthError{StatusCode: status, Code: response.ErrorCode}
+	for _, message := range []string{response.Msg, response.Message, response.ErrorDescription, response.Error} {
+		if message != "" {
+			err.Message = message
+			break
+		}
+	}
+	if err.Message == "" {
+		err.Message = http.StatusText(status)
+	}
+	return err
+}
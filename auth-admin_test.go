@@ -0,0 +1,121 @@
+package supago
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAuthError(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		status  int
+		body    string
+		code    string
+		message string
+	}{
+		{"gotrue", http.StatusUnprocessableEntity, `{"code":422,"error_code":"email_exists","msg":"A user with this email address has already been registered"}`, "email_exists", "A user with this email address has already been registered"},
+		{"kong", http.StatusUnauthorized, `{"message":"Invalid authentication credentials"}`, "", "Invalid authentication credentials"},
+		{"oauth", http.StatusBadRequest, `{"error":"invalid_grant","error_description":"Invalid Refresh Token"}`, "", "Invalid Refresh Token"},
+		{"error only", http.StatusBadRequest, `{"error":"invalid_request"}`, "", "invalid_request"},
+		{"empty", http.StatusBadGateway, ``, "", "Bad Gateway"},
+		{"not json", http.StatusInternalServerError, `upstream failed`, "", "Internal Server Error"},
+	} {
+		err := authError(tc.status, []byte(tc.body))
+		if err.StatusCode != tc.status || err.Code != tc.code || err.Message != tc.message {
+			t.Errorf("%s: got %+v", tc.name, err)
+		}
+	}
+}
+
+func TestAuthAdminErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("apikey") != "service-key" || r.Header.Get("Authorization") != "Bearer service-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"message":"Invalid authentication credentials"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"code":404,"error_code":"user_not_found","msg":"User not found"}`))
+	}))
+	defer server.Close()
+
+	admin := &AuthAdmin{url: server.URL, key: "service-key", HTTP: server.Client()}
+	_, err := admin.GetUser(context.Background(), "missing")
+	var authErr *AuthError
+	if !errors.As(err, &authErr) || authErr.StatusCode != http.StatusNotFound || authErr.Code != "user_not_found" {
+		t.Errorf("expected a user_not_found error, got %v", err)
+	}
+
+	admin.key = "other-key"
+	if _, err := admin.GetUser(context.Background(), "missing"); !errors.As(err, &authErr) || authErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected an unauthorized error, got %v", err)
+	}
+}
+
+func TestAuthAdminListUsers(t *testing.T) {
+	const total = 5
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		if r.Method != http.MethodGet || r.URL.Path != "/admin/users" || page < 1 || perPage < 1 {
+			http.Error(w, `{"msg":"bad request"}`, http.StatusBadRequest)
+			return
+		}
+		var users []string
+		for i := (page - 1) * perPage; i < min(page*perPage, total); i++ {
+			users = append(users, fmt.Sprintf(`{"id":"user-%d"}`, i))
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		_, _ = fmt.Fprintf(w, `{"users":[%s],"aud":"authenticated"}`, strings.Join(users, ","))
+	}))
+	defer server.Close()
+	admin := &AuthAdmin{url: server.URL, key: "service-key", HTTP: server.Client()}
+
+	for _, tc := range []struct {
+		opts     ListUsersOptions
+		users    int
+		nextPage int
+	}{
+		{ListUsersOptions{}, total, 0},
+		{ListUsersOptions{PerPage: 2}, 2, 2},
+		{ListUsersOptions{Page: 2, PerPage: 2}, 2, 3},
+		{ListUsersOptions{Page: 3, PerPage: 2}, 1, 0},
+		{ListUsersOptions{Page: 1, PerPage: total}, total, 0},
+	} {
+		page, err := admin.ListUsers(context.Background(), tc.opts)
+		if err != nil {
+			t.Errorf("%+v: %v", tc.opts, err)
+		} else if len(page.Users) != tc.users || page.Total != total || page.NextPage != tc.nextPage {
+			t.Errorf("%+v: got %d users of %d, next page %d", tc.opts, len(page.Users), page.Total, page.NextPage)
+		}
+	}
+
+	// following NextPage visits every user once
+	seen := map[string]bool{}
+	for opts := (ListUsersOptions{PerPage: 2}); ; {
+		page, err := admin.ListUsers(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, user := range page.Users {
+			seen[user.ID] = true
+		}
+		if page.NextPage == 0 {
+			break
+		}
+		opts.Page = page.NextPage
+	}
+	if len(seen) != total {
+		t.Errorf("expected %d users across pages, got %d", total, len(seen))
+	}
+
+	if _, err := admin.ListUsers(context.Background(), ListUsersOptions{Page: -1}); err == nil {
+		t.Error("expected a negative page to be rejected")
+	}
+}
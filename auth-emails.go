@@ -0,0 +1,157 @@
+package supago
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// AuthEmailsConfig the emails GoTrue sends; zero values keep its defaults
+type AuthEmailsConfig struct {
+	Invite       AuthEmail
+	Confirmation AuthEmail
+	Recovery     AuthEmail
+	MagicLink    AuthEmail
+	EmailChange  AuthEmail
+}
+
+// AuthEmail an email's subject, body and link
+// Subjects and bodies are Go templates GoTrue renders with {{ .ConfirmationURL }}, {{ .Token }}, {{ .TokenHash }},
+// {{ .SiteURL }}, {{ .RedirectTo }}, {{ .Email }}, {{ .NewEmail }} and {{ .Data }} (the user's metadata).
+type AuthEmail struct {
+	// Subject (optional) the email's subject
+	Subject string
+	// Template (optional) the email's (HTML) body
+	Template string
+	// File (optional) a file to read the body from instead, whenever GoTrue fetches it (so edits apply without a
+	// restart, once GoTrue's cache expires)
+	File string
+	// URLPath (optional) where the email's confirmation link points, on the Kong URL (defaults to /auth/v1/verify)
+	URLPath string
+}
+
+// authEmailTemplateData what GoTrue renders email templates with (to check templates against)
+type authEmailTemplateData struct {
+	SiteURL         string
+	ConfirmationURL string
+	Email           string
+	NewEmail        string
+	Token           string
+	TokenHash       string
+	RedirectTo      string
+	Data            map[string]any
+}
+
+// authEmail an email, as GoTrue names it
+type authEmail struct {
+	name string // e.g., "magic_link"
+	AuthEmail
+}
+
+// emails every email
+func (e AuthEmailsConfig) emails() []authEmail {
+	return []authEmail{
+		{"invite", e.Invite},
+		{"confirmation", e.Confirmation},
+		{"recovery", e.Recovery},
+		{"magic_link", e.MagicLink},
+		{"email_change", e.EmailChange},
+	}
+}
+
+// templated whether any email has a custom body (served to GoTrue)
+func (e AuthEmailsConfig) templated() bool {
+	for _, email := range e.emails() {
+		if email.Template != "" || email.File != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// body the email's body template
+func (e authEmail) body() (string, error) {
+	if e.File == "" {
+		return e.Template, nil
+	}
+	body, err := os.ReadFile(e.File)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s template: %w", e.name, err)
+	}
+	return string(body), nil
+}
+
+// env GoTrue's environment variables for the emails, with bodies served on the host's port
+func (e AuthEmailsConfig) env(port uint16) map[string]string {
+	env := map[string]string{}
+	for _, email := range e.emails() {
+		suffix := strings.ToUpper(email.name)
+		if email.Subject != "" {
+			env["GOTRUE_MAILER_SUBJECTS_"+suffix] = email.Subject
+		}
+		if email.Template != "" || email.File != "" {
+			env["GOTRUE_MAILER_TEMPLATES_"+suffix] = fmt.Sprintf("http://%s:%d/templates/%s", authCallbacksHost, port, email.name)
+		}
+		urlPath := email.URLPath
+		if urlPath == "" {
+			urlPath = "/auth/v1/verify"
+		}
+		env["GOTRUE_MAILER_URLPATHS_"+suffix] = urlPath
+	}
+	return env
+}
+
+func (e AuthEmailsConfig) validate() error {
+	for _, email := range e.emails() {
+		if email.Template != "" && email.File != "" {
+			return fmt.Errorf("%s email has both a template and a file", email.name)
+		} else if email.URLPath != "" && !strings.HasPrefix(email.URLPath, "/") {
+			return fmt.Errorf("%s email's URL path must start with \"/\", got %q", email.name, email.URLPath)
+		}
+		if err := checkEmailTemplate(email.name+" subject", email.Subject); err != nil {
+			return err
+		}
+		body, err := email.body()
+		if err != nil {
+			return err
+		} else if err := checkEmailTemplate(email.name+" template", body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkEmailTemplate checks text parses, and only uses the fields GoTrue renders it with
+func checkEmailTemplate(name, text string) error {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, authEmailTemplateData{Data: map[string]any{}}); err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return nil
+}
+
+// serve serves the emails' bodies on mux (at /templates/<name>)
+func (e AuthEmailsConfig) serve(mux *http.ServeMux, logger *zap.SugaredLogger) {
+	for _, email := range e.emails() {
+		if email.Template == "" && email.File == "" {
+			continue
+		}
+		mux.HandleFunc("GET /templates/"+email.name, func(w http.ResponseWriter, r *http.Request) {
+			body, err := email.body()
+			if err != nil {
+				logger.Error(err.Error())
+				http.Error(w, "failed to read template", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(body))
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package supago
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/train360-corp/supago/internal/utils"
+	"github.com/train360-corp/supago/internal/webhook"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// authCallbacksHost how the auth container reaches the host (mapped to its gateway on Linux); GoTrue accepts plain
+// HTTP hooks on it
+const authCallbacksHost = "host.docker.internal"
+
+// Hook decisions (see HookDecision)
+const (
+	HookContinue = "continue"
+	HookReject   = "reject"
+)
+
+// AuthHooksConfig Go handlers for GoTrue's hooks, which SupaGo serves to the auth container over signed HTTP
+// (on AuthConfig.ServerPort); each hook is enabled when set
+type AuthHooksConfig struct {
+	// Secret (base64) the requests are signed with (random unless set)
+	Secret string
+	// CustomAccessToken returns the claims of an access token about to be issued (e.g., with custom claims added)
+	CustomAccessToken func(ctx context.Context, input CustomAccessTokenInput) (map[string]any, error)
+	// SendEmail delivers auth emails (instead of GoTrue, over SMTP)
+	SendEmail func(ctx context.Context, input SendEmailInput) error
+	// SendSMS delivers one-time passwords by SMS (instead of an SMS provider)
+	SendSMS func(ctx context.Context, input SendSMSInput) error
+	// MFAVerificationAttempt decides whether an MFA verification attempt may proceed (e.g., to limit attempts)
+	MFAVerificationAttempt func(ctx context.Context, input MFAVerificationAttemptInput) (HookDecision, error)
+	// PasswordVerificationAttempt decides whether a password sign-in attempt may proceed
+	PasswordVerificationAttempt func(ctx context.Context, input PasswordVerificationAttemptInput) (HookDecision, error)
+}
+
+// CustomAccessTokenInput the token about to be issued
+type CustomAccessTokenInput struct {
+	UserID               string         `json:"user_id"`
+	Claims               map[string]any `json:"claims"`
+	AuthenticationMethod string         `json:"authentication_method"`
+}
+
+// SendEmailInput an auth email to deliver
+type SendEmailInput struct {
+	User      User          `json:"user"`
+	EmailData HookEmailData `json:"email_data"`
+}
+
+// HookEmailData what an auth email carries
+type HookEmailData struct {
+	Token           string `json:"token"`
+	TokenHash       string `json:"token_hash"`
+	RedirectTo      string `json:"redirect_to"`
+	EmailActionType string `json:"email_action_type"` // e.g., "signup", "recovery", "magiclink", "invite" or "email_change"
+	SiteURL         string `json:"site_url"`
+	TokenNew        string `json:"token_new"`
+	TokenHashNew    string `json:"token_hash_new"`
+}
+
+// SendSMSInput a one-time password to deliver
+type SendSMSInput struct {
+	User User `json:"user"`
+	SMS  struct {
+		OTP string `json:"otp"`
+	} `json:"sms"`
+}
+
+// MFAVerificationAttemptInput an attempt to verify a factor
+type MFAVerificationAttemptInput struct {
+	FactorID   string `json:"factor_id"`
+	FactorType string `json:"factor_type"` // "totp" or "phone"
+	UserID     string `json:"user_id"`
+	Valid      bool   `json:"valid"`
+}
+
+// PasswordVerificationAttemptInput an attempt to sign in with a password
+type PasswordVerificationAttemptInput struct {
+	UserID string `json:"user_id"`
+	Valid  bool   `json:"valid"`
+}
+
+// HookDecision whether a verification attempt may proceed
+type HookDecision struct {
+	Decision string `json:"decision"` // HookContinue or HookReject
+	Message  string `json:"message,omitempty"`
+	// ShouldLogoutUser sign the user out of every session (password verification attempts only)
+	ShouldLogoutUser bool `json:"should_logout_user,omitempty"`
+}
+
+// HookError an error a hook returns to GoTrue (and, through it, to the client) with an HTTP status code
+// Other errors are returned with status 500.
+type HookError struct {
+	HTTPCode int
+	Message  string
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("hook error %d: %s", e.HTTPCode, e.Message)
+}
+
+// authHook a hook, as GoTrue names it
+type authHook struct {
+	name   string // e.g., "custom_access_token"
+	handle func(ctx context.Context, body []byte) (any, error)
+}
+
+// hooks the configured hooks
+func (h AuthHooksConfig) hooks() []authHook {
+	var hooks []authHook
+	if h.CustomAccessToken != nil {
+		hooks = append(hooks, authHook{"custom_access_token", func(ctx context.Context, body []byte) (any, error) {
+			var input CustomAccessTokenInput
+			if err := json.Unmarshal(body, &input); err != nil {
+				return nil, err
+			}
+			claims, err := h.CustomAccessToken(ctx, input)
+			return map[string]any{"claims": claims}, err
+		}})
+	}
+	if h.SendEmail != nil {
+		hooks = append(hooks, authHook{"send_email", func(ctx context.Context, body []byte) (any, error) {
+			var input SendEmailInput
+			if err := json.Unmarshal(body, &input); err != nil {
+				return nil, err
+			}
+			return struct{}{}, h.SendEmail(ctx, input)
+		}})
+	}
+	if h.SendSMS != nil {
+		hooks = append(hooks, authHook{"send_sms", func(ctx context.Context, body []byte) (any, error) {
+			var input SendSMSInput
+			if err := json.Unmarshal(body, &input); err != nil {
+				return nil, err
+			}
+			return struct{}{}, h.SendSMS(ctx, input)
+		}})
+	}
+	if h.MFAVerificationAttempt != nil {
+		hooks = append(hooks, authHook{"mfa_verification_attempt", func(ctx context.Context, body []byte) (any, error) {
+			var input MFAVerificationAttemptInput
+			if err := json.Unmarshal(body, &input); err != nil {
+				return nil, err
+			}
+			return h.MFAVerificationAttempt(ctx, input)
+		}})
+	}
+	if h.PasswordVerificationAttempt != nil {
+		hooks = append(hooks, authHook{"password_verification_attempt", func(ctx context.Context, body []byte) (any, error) {
+			var input PasswordVerificationAttemptInput
+			if err := json.Unmarshal(body, &input); err != nil {
+				return nil, err
+			}
+			return h.PasswordVerificationAttempt(ctx, input)
+		}})
+	}
+	return hooks
+}
+
+// env GoTrue's environment variables enabling the hooks, served on the host's port
+func (h AuthHooksConfig) env(port uint16) map[string]string {
+	env := map[string]string{}
+	for _, hook := range h.hooks() {
+		prefix := "GOTRUE_HOOK_" + strings.ToUpper(hook.name) + "_"
+		env[prefix+"ENABLED"] = "true"
+		env[prefix+"URI"] = fmt.Sprintf("http://%s:%d/hooks/%s", authCallbacksHost, port, hook.name)
+		env[prefix+"SECRETS"] = "v1," + webhook.SecretPrefix + strings.TrimPrefix(h.Secret, webhook.SecretPrefix)
+	}
+	return env
+}
+
+func (h AuthHooksConfig) validate() error {
+	if len(h.hooks()) == 0 {
+		return nil
+	} else if h.Secret == "" {
+		return errors.New("hooks have no secret")
+	}
+	_, err := webhook.Secret(h.Secret)
+	return err
+}
+
+// randomHookSecret a new (base64) secret for signing hook requests
+func randomHookSecret() string {
+	return base64.StdEncoding.EncodeToString([]byte(utils.RandomString(32)))
+}
+
+// serve serves the hooks on mux (at /hooks/<name>), verifying every request's signature
+func (h AuthHooksConfig) serve(mux *http.ServeMux, logger *zap.SugaredLogger) error {
+	if len(h.hooks()) == 0 {
+		return nil
+	}
+	key, err := webhook.Secret(h.Secret)
+	if err != nil {
+		return err
+	}
+	for _, hook := range h.hooks() {
+		mux.HandleFunc("POST /hooks/"+hook.name, func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+			if err != nil {
+				http.Error(w, "failed to read request", http.StatusBadRequest)
+				return
+			} else if err := webhook.Verify(key, r.Header, body, time.Now()); err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			output, err := hook.handle(r.Context(), body)
+			if err != nil {
+				var hookErr *HookError
+				if !errors.As(err, &hookErr) {
+					logger.Errorf("%s hook failed: %v", hook.name, err)
+					hookErr = &HookError{HTTPCode: http.StatusInternalServerError, Message: err.Error()}
+				}
+				output = map[string]any{"error": map[string]any{"http_code": hookErr.HTTPCode, "message": hookErr.Message}}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(output)
+		})
+	}
+	return nil
+}
+
+// serveAuthCallbacks starts serving the hooks and email templates to the auth container (unless none are configured,
+// or already serving), on the network's gateway only (the templates aren't authenticated)
+// The caller must hold sg.mu (with docker and its network set up)
+func (sg *SupaGo) serveAuthCallbacks(ctx context.Context) error {
+	if sg.callbacks != nil || !sg.config.Auth.ServesCallbacks() {
+		return nil
+	}
+	mux := http.NewServeMux()
+	if err := sg.config.Auth.Hooks.serve(mux, sg.logger); err != nil {
+		return fmt.Errorf("invalid auth hooks: %w", err)
+	}
+	sg.config.Auth.Emails.serve(mux, sg.logger)
+
+	host, err := sg.hostGateway(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find the address to serve auth callbacks on: %w", err)
+	} else if host == "" {
+		host = "127.0.0.1"
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(int(sg.config.Auth.serverPort(sg.config.Kong))))
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to serve auth callbacks on %s: %w", address, err)
+	}
+	sg.callbacks = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func(server *http.Server) {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			sg.logger.Errorf("auth callbacks server failed: %v", err)
+		}
+	}(sg.callbacks)
+	sg.logger.Infof("serving auth callbacks on %s", address)
+	return nil
+}
+
+// stopAuthCallbacks stops serving the hooks and email templates
+// The caller must hold sg.mu
+func (sg *SupaGo) stopAuthCallbacks() {
+	if sg.callbacks == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sg.callbacks.Shutdown(ctx); err != nil {
+		sg.logger.Warnf("failed to stop auth callbacks server: %v", err)
+	}
+	sg.callbacks = nil
+}
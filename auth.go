@@ -0,0 +1,231 @@
+package supago
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Character groups for AuthPasswordConfig.RequiredCharacters
+const (
+	PasswordLowercase = "abcdefghijklmnopqrstuvwxyz"
+	PasswordUppercase = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	PasswordDigits    = "0123456789"
+)
+
+// AuthConfig how GoTrue (the auth service) signs users up and in; zero values keep its defaults
+type AuthConfig struct {
+	// DisableSignup only let users be created through the admin API (or invited)
+	DisableSignup bool
+	// AutoconfirmEmail sign users up without confirming their email address
+	AutoconfirmEmail bool
+	// EnablePhone let users sign up and in with a phone number (requires an SMS provider, or a send-SMS hook)
+	EnablePhone bool
+	// AutoconfirmPhone sign users up without confirming their phone number
+	AutoconfirmPhone bool
+	// EnableAnonymousUsers let users sign in anonymously
+	EnableAnonymousUsers bool
+	// JWTExpiry how long access tokens are valid for (defaults to an hour)
+	JWTExpiry time.Duration
+	// RedirectURLs where users may be redirected to after signing in, besides the site URL (wildcards allowed, e.g.,
+	// "https://*.example.com/**")
+	RedirectURLs []string
+	MFA          AuthMFAConfig
+	Password     AuthPasswordConfig
+	Providers    AuthProvidersConfig
+	Emails       AuthEmailsConfig
+	Hooks        AuthHooksConfig
+	// ServerPort the host port SupaGo serves hooks and email templates to the auth container on (defaults to Kong's
+	// host port + 1)
+	ServerPort uint16
+}
+
+// AuthMFAConfig multi-factor authentication
+type AuthMFAConfig struct {
+	// DisableTOTP stop users enrolling (and verifying) authenticator apps
+	DisableTOTP bool
+	// Phone let users enroll (and verify) phone numbers as a factor
+	Phone bool
+	// MaxEnrolledFactors the most factors a user may enroll (defaults to 10)
+	MaxEnrolledFactors int
+}
+
+// AuthPasswordConfig the passwords users may choose
+type AuthPasswordConfig struct {
+	// MinLength the shortest password accepted (defaults to 6)
+	MinLength int
+	// RequiredCharacters groups of characters a password must contain one of each of (e.g., PasswordLowercase,
+	// PasswordUppercase and PasswordDigits)
+	RequiredCharacters []string
+	// RejectLeaked reject passwords found in data breaches (checked against HaveIBeenPwned)
+	RejectLeaked bool
+}
+
+// AuthProvidersConfig the external (OAuth) providers users may sign in with; each is enabled when set
+type AuthProvidersConfig struct {
+	Google *OAuthProvider
+	GitHub *OAuthProvider
+	// Azure URL is the tenant's (e.g., "https://login.microsoftonline.com/<tenant-id>"; defaults to any account)
+	Azure *OAuthProvider
+	// Keycloak URL is the realm's (e.g., "https://keycloak.example.com/realms/<realm>"), serving
+	// /protocol/openid-connect/{auth,token,userinfo}; other OpenID Connect issuers are not supported
+	Keycloak *OAuthProvider
+}
+
+// OAuthProvider an OAuth client registered with an external provider
+type OAuthProvider struct {
+	ClientID string
+	Secret   string
+	// RedirectURI (optional) the callback registered with the provider (defaults to the Kong URL's /auth/v1/callback,
+	// which must then be reachable from browsers)
+	RedirectURI string
+	// URL (optional) of the provider, for those hosted per tenant (Azure, Keycloak)
+	URL string
+	// SkipNonceCheck accept ID tokens without a nonce (e.g., Google's from iOS sign-ins)
+	SkipNonceCheck bool
+}
+
+// authProvider a configured provider, as GoTrue names it
+type authProvider struct {
+	name  string // e.g., "github"
+	label string // e.g., "GitHub"
+	*OAuthProvider
+}
+
+// providers the configured providers
+func (p AuthProvidersConfig) providers() []authProvider {
+	var providers []authProvider
+	for _, provider := range []authProvider{
+		{"google", "Google", p.Google},
+		{"github", "GitHub", p.GitHub},
+		{"azure", "Azure", p.Azure},
+		{"keycloak", "Keycloak", p.Keycloak},
+	} {
+		if provider.OAuthProvider != nil {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
+
+// serverPort the host port hooks and email templates are served on
+func (a AuthConfig) serverPort(kong KongConfig) uint16 {
+	if a.ServerPort == 0 {
+		return kong.hostPort() + 1
+	}
+	return a.ServerPort
+}
+
+// ServesCallbacks whether the auth container calls back into SupaGo (hooks, or email templates), which then serves it
+// from the running process: the stack depends on that process staying up
+func (a AuthConfig) ServesCallbacks() bool {
+	return len(a.Hooks.hooks()) > 0 || a.Emails.templated()
+}
+
+// env GoTrue's environment variables for the config
+func (a AuthConfig) env(kong KongConfig) map[string]string {
+	expiry := time.Hour
+	if a.JWTExpiry > 0 {
+		expiry = a.JWTExpiry
+	}
+	env := map[string]string{
+		"GOTRUE_DISABLE_SIGNUP":                   strconv.FormatBool(a.DisableSignup),
+		"GOTRUE_MAILER_AUTOCONFIRM":               strconv.FormatBool(a.AutoconfirmEmail),
+		"GOTRUE_EXTERNAL_PHONE_ENABLED":           strconv.FormatBool(a.EnablePhone),
+		"GOTRUE_SMS_AUTOCONFIRM":                  strconv.FormatBool(a.AutoconfirmPhone),
+		"GOTRUE_EXTERNAL_ANONYMOUS_USERS_ENABLED": strconv.FormatBool(a.EnableAnonymousUsers),
+		"GOTRUE_JWT_EXP":                          strconv.Itoa(int(expiry.Seconds())),
+		"GOTRUE_URI_ALLOW_LIST":                   strings.Join(a.RedirectURLs, ","),
+		"GOTRUE_MFA_TOTP_ENROLL_ENABLED":          strconv.FormatBool(!a.MFA.DisableTOTP),
+		"GOTRUE_MFA_TOTP_VERIFY_ENABLED":          strconv.FormatBool(!a.MFA.DisableTOTP),
+		"GOTRUE_MFA_PHONE_ENROLL_ENABLED":         strconv.FormatBool(a.MFA.Phone),
+		"GOTRUE_MFA_PHONE_VERIFY_ENABLED":         strconv.FormatBool(a.MFA.Phone),
+		"GOTRUE_PASSWORD_HIBP_ENABLED":            strconv.FormatBool(a.Password.RejectLeaked),
+	}
+	if a.MFA.MaxEnrolledFactors > 0 {
+		env["GOTRUE_MFA_MAX_ENROLLED_FACTORS"] = strconv.Itoa(a.MFA.MaxEnrolledFactors)
+	}
+	if a.Password.MinLength > 0 {
+		env["GOTRUE_PASSWORD_MIN_LENGTH"] = strconv.Itoa(a.Password.MinLength)
+	}
+	if len(a.Password.RequiredCharacters) > 0 {
+		env["GOTRUE_PASSWORD_REQUIRED_CHARACTERS"] = strings.Join(a.Password.RequiredCharacters, ":")
+	}
+	for _, provider := range a.Providers.providers() {
+		prefix := "GOTRUE_EXTERNAL_" + strings.ToUpper(provider.name) + "_"
+		redirect := provider.RedirectURI
+		if redirect == "" {
+			redirect = strings.TrimSuffix(kong.URLs.Kong, "/") + "/auth/v1/callback"
+		}
+		env[prefix+"ENABLED"] = "true"
+		env[prefix+"CLIENT_ID"] = provider.ClientID
+		env[prefix+"SECRET"] = provider.Secret
+		env[prefix+"REDIRECT_URI"] = redirect
+		if provider.URL != "" {
+			env[prefix+"URL"] = provider.URL
+		}
+		if provider.SkipNonceCheck {
+			env[prefix+"SKIP_NONCE_CHECK"] = "true"
+		}
+	}
+	maps.Copy(env, a.Emails.env(a.serverPort(kong)))
+	maps.Copy(env, a.Hooks.env(a.serverPort(kong)))
+	return env
+}
+
+func (a AuthConfig) validate(kong KongConfig) error {
+	if a.JWTExpiry < 0 || a.JWTExpiry%time.Second != 0 {
+		return fmt.Errorf("JWT expiry must be a positive number of seconds, got %v", a.JWTExpiry)
+	} else if a.MFA.MaxEnrolledFactors < 0 {
+		return fmt.Errorf("max enrolled factors must not be negative, got %d", a.MFA.MaxEnrolledFactors)
+	} else if a.Password.MinLength < 0 {
+		return fmt.Errorf("password min length must not be negative, got %d", a.Password.MinLength)
+	}
+	if err := a.Emails.validate(); err != nil {
+		return err
+	} else if err := a.Hooks.validate(); err != nil {
+		return err
+	}
+	for _, redirect := range a.RedirectURLs {
+		if redirect == "" || strings.Contains(redirect, ",") {
+			return fmt.Errorf("invalid redirect URL %q", redirect)
+		}
+	}
+	for _, group := range a.Password.RequiredCharacters {
+		if group == "" || strings.Contains(group, ":") {
+			return fmt.Errorf("invalid required password characters %q (a non-empty group without colons)", group)
+		}
+	}
+	for _, provider := range a.Providers.providers() {
+		if provider.ClientID == "" || provider.Secret == "" {
+			return fmt.Errorf("%s provider needs a client ID and secret", provider.label)
+		} else if provider.name == "keycloak" && !strings.Contains(provider.URL, "/realms/") {
+			return fmt.Errorf("Keycloak provider needs the URL of its realm (e.g., \"https://keycloak.example.com/realms/<realm>\"), got %q", provider.URL)
+		} else if provider.RedirectURI == "" && !browserReachable(kong.URLs.Kong) {
+			return fmt.Errorf("%s provider needs a redirect URI: the Kong URL %q (its default) is not reachable from browsers", provider.label, kong.URLs.Kong)
+		}
+		for _, u := range []string{provider.URL, provider.RedirectURI} {
+			if u == "" {
+				continue
+			} else if err := validateURL(u); err != nil {
+				return fmt.Errorf("%s provider: %w", provider.label, err)
+			}
+		}
+	}
+	return nil
+}
+
+// browserReachable whether rawURL's host may be reachable from users' browsers: not a container's name on the
+// platform's network (hosts without a dot, besides localhost)
+func browserReachable(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	return host == "localhost" || net.ParseIP(host) != nil || strings.Contains(strings.TrimSuffix(host, "."), ".")
+}
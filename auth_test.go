@@ -0,0 +1,143 @@
+package supago
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAuthProvidersValidate(t *testing.T) {
+	public := KongConfig{URLs: KongURLsConfig{Kong: "https://api.example.com"}}
+	container := KongConfig{URLs: KongURLsConfig{Kong: "http://example-kong:8000"}}
+	keycloak := func(realmURL, redirect string) AuthConfig {
+		return AuthConfig{Providers: AuthProvidersConfig{Keycloak: &OAuthProvider{
+			ClientID: "app", Secret: "secret", URL: realmURL, RedirectURI: redirect,
+		}}}
+	}
+	for _, tc := range []struct {
+		name  string
+		auth  AuthConfig
+		kong  KongConfig
+		valid bool
+	}{
+		{"realm", keycloak("https://sso.example.com/realms/app", ""), public, true},
+		{"no url", keycloak("", ""), public, false},
+		{"not a realm", keycloak("https://accounts.example.com", ""), public, false},
+		{"container kong url", keycloak("https://sso.example.com/realms/app", ""), container, false},
+		{"container kong url with redirect", keycloak("https://sso.example.com/realms/app", "https://api.example.com/auth/v1/callback"), container, true},
+		{"localhost kong url", keycloak("http://localhost:8080/realms/app", ""), KongConfig{URLs: KongURLsConfig{Kong: "http://localhost:8000"}}, true},
+		{"no secret", AuthConfig{Providers: AuthProvidersConfig{GitHub: &OAuthProvider{ClientID: "app"}}}, public, false},
+	} {
+		if err := tc.auth.validate(tc.kong); tc.valid && err != nil {
+			t.Errorf("%s: expected valid, got %v", tc.name, err)
+		} else if !tc.valid && err == nil {
+			t.Errorf("%s: expected invalid", tc.name)
+		}
+	}
+}
+
+// TestKeycloakProviderStandIn follows GoTrue's keycloak provider path (authorize, exchange the code, fetch the user)
+// with the environment SupaGo gives it, against a local stand-in for a Keycloak realm
+func TestKeycloakProviderStandIn(t *testing.T) {
+	const code = "code-1"
+	mux := http.NewServeMux()
+	realm := httptest.NewServer(mux)
+	defer realm.Close()
+	mux.HandleFunc("GET /realms/test/protocol/openid-connect/auth", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("client_id") != "app" {
+			http.Error(w, "unknown client", http.StatusBadRequest)
+			return
+		}
+		redirect, _ := url.Parse(r.URL.Query().Get("redirect_uri"))
+		redirect.RawQuery = url.Values{"code": {code}, "state": {r.URL.Query().Get("state")}}.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+	mux.HandleFunc("POST /realms/test/protocol/openid-connect/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "app" || secret != "secret" || r.FormValue("code") != code {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "token-1", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("GET /realms/test/protocol/openid-connect/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"sub": "user-1", "email": "ada@example.com", "email_verified": true})
+	})
+
+	auth := AuthConfig{Providers: AuthProvidersConfig{Keycloak: &OAuthProvider{
+		ClientID: "app", Secret: "secret", URL: realm.URL + "/realms/test",
+	}}}
+	kong := KongConfig{URLs: KongURLsConfig{Kong: "http://localhost:8000"}}
+	if err := auth.validate(kong); err != nil {
+		t.Fatal(err)
+	}
+	env := auth.env(kong)
+	if env["GOTRUE_EXTERNAL_KEYCLOAK_ENABLED"] != "true" {
+		t.Fatalf("expected the keycloak provider enabled, got %v", env)
+	}
+	issuer := env["GOTRUE_EXTERNAL_KEYCLOAK_URL"]
+	callback := env["GOTRUE_EXTERNAL_KEYCLOAK_REDIRECT_URI"]
+	if callback != "http://localhost:8000/auth/v1/callback" {
+		t.Errorf("expected the Kong URL's callback, got %q", callback)
+	}
+
+	// authorize (the browser), stopping at the redirect back to GoTrue
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(issuer + "/protocol/openid-connect/auth?" + url.Values{
+		"client_id":     {env["GOTRUE_EXTERNAL_KEYCLOAK_CLIENT_ID"]},
+		"redirect_uri":  {callback},
+		"response_type": {"code"},
+		"state":         {"state-1"},
+	}.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+	location, err := res.Location()
+	if err != nil {
+		t.Fatalf("expected a redirect to the callback, got status %d", res.StatusCode)
+	} else if !strings.HasPrefix(location.String(), callback+"?") || location.Query().Get("code") != code {
+		t.Fatalf("unexpected redirect %q", location)
+	}
+
+	// exchange the code (GoTrue)
+	req, _ := http.NewRequest(http.MethodPost, issuer+"/protocol/openid-connect/token", strings.NewReader(url.Values{
+		"grant_type": {"authorization_code"}, "code": {location.Query().Get("code")}, "redirect_uri": {callback},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(env["GOTRUE_EXTERNAL_KEYCLOAK_CLIENT_ID"], env["GOTRUE_EXTERNAL_KEYCLOAK_SECRET"])
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&token)
+	_ = res.Body.Close()
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("token exchange failed with status %d: %v", res.StatusCode, err)
+	}
+
+	// fetch the user (GoTrue)
+	req, _ = http.NewRequest(http.MethodGet, issuer+"/protocol/openid-connect/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var user struct {
+		Email string `json:"email"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&user)
+	_ = res.Body.Close()
+	if err != nil || user.Email != "ada@example.com" {
+		t.Errorf("expected the stand-in's user, got %+v (%v)", user, err)
+	}
+}
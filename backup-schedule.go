@@ -0,0 +1,139 @@
+package supago
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BackupSchedule periodically writes backups (see Backup) to a directory
+type BackupSchedule struct {
+	// Directory backups are written to (as "<platform>-<timestamp>.tar[.gz]")
+	Directory string
+	// Every how often to back up; runs are aligned to multiples of Every since midnight UTC (like cron), e.g.,
+	// 6*time.Hour runs at 00:00, 06:00, 12:00 and 18:00 UTC
+	Every time.Duration
+	// Offset shifts the aligned runs, e.g., Every: 24*time.Hour, Offset: 2*time.Hour runs daily at 02:00 UTC
+	Offset time.Duration
+	// Retention how many of the newest backups to keep (0 keeps all)
+	Retention int
+	// Compress gzip the backups
+	Compress bool
+}
+
+// next the first run strictly after now
+func (s BackupSchedule) next(now time.Time) time.Time {
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	next := midnight.Add(s.Offset%s.Every - s.Every)
+	for !next.After(now) {
+		next = next.Add(s.Every)
+	}
+	return next
+}
+
+// ScheduleBackups backs up according to schedule until ctx is done (in the background)
+// Failed backups are logged, and retried at the next scheduled run.
+func (sg *SupaGo) ScheduleBackups(ctx context.Context, schedule BackupSchedule) error {
+	if schedule.Directory == "" {
+		return errors.New("backup schedule has no directory")
+	} else if schedule.Every < time.Minute {
+		return fmt.Errorf("backup schedule interval must be at least a minute, got %v", schedule.Every)
+	} else if schedule.Offset < 0 {
+		return fmt.Errorf("backup schedule offset must not be negative, got %v", schedule.Offset)
+	} else if schedule.Retention < 0 {
+		return fmt.Errorf("backup schedule retention must not be negative, got %d", schedule.Retention)
+	}
+	if err := os.MkdirAll(schedule.Directory, 0o700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	go func() {
+		for {
+			next := schedule.next(time.Now())
+			sg.logger.Debugf("next scheduled backup at %s", next.Format(time.RFC3339))
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				sg.logger.Debug("backup schedule stopped")
+				return
+			case <-timer.C:
+				sg.scheduledBackup(ctx, schedule, next)
+			}
+		}
+	}()
+	return nil
+}
+
+func (sg *SupaGo) scheduledBackup(ctx context.Context, schedule BackupSchedule, at time.Time) {
+	sg.mu.Lock()
+	platform := sg.config.Global.PlatformName
+	sg.mu.Unlock()
+
+	name := fmt.Sprintf("%s-%s.tar", platform, at.UTC().Format("20060102T150405Z"))
+	if schedule.Compress {
+		name += ".gz"
+	}
+	path := filepath.Join(schedule.Directory, name)
+	if metadata, err := sg.BackupToFile(ctx, path, BackupOptions{Compress: schedule.Compress}); err != nil {
+		sg.logger.Errorf("scheduled backup failed: %v", err)
+		return
+	} else {
+		sg.logger.Infow("scheduled backup written",
+			"path", path,
+			"size", metadata.Size,
+			"duration", metadata.Duration,
+			"roles", strings.Join(metadata.Roles, ","),
+		)
+	}
+
+	if schedule.Retention > 0 {
+		sg.pruneBackups(schedule.Directory, platform, schedule.Retention)
+	}
+}
+
+// scheduledBackups the names of platform's scheduled backups among names, oldest first
+// Names must match exactly: platform names may contain hyphens, so "app-b-<timestamp>.tar" is not a backup of "app".
+func scheduledBackups(names []string, platform string) []string {
+	pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(platform) + `-\d{8}T\d{6}Z\.tar(\.gz)?$`)
+	var backups []string
+	for _, name := range names {
+		if pattern.MatchString(name) {
+			backups = append(backups, name)
+		}
+	}
+	sort.Strings(backups) // timestamps sort chronologically
+	return backups
+}
+
+// pruneBackups removes all but the newest retain backups of platform in dir
+func (sg *SupaGo) pruneBackups(dir, platform string, retain int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		sg.logger.Errorf("failed to list backups for pruning: %v", err)
+		return
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	backups := scheduledBackups(names, platform)
+	for len(backups) > retain {
+		path := filepath.Join(dir, backups[0])
+		if err := os.Remove(path); err != nil {
+			sg.logger.Errorf("failed to remove expired backup %s: %v", path, err)
+		} else {
+			sg.logger.Debugf("removed expired backup %s", path)
+		}
+		backups = backups[1:]
+	}
+}
@@ -0,0 +1,52 @@
+package supago
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBackupScheduleNext(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	for _, tc := range []struct {
+		schedule BackupSchedule
+		now      string
+		expect   string
+	}{
+		{BackupSchedule{Every: 6 * time.Hour}, "2025-03-01T05:59:59Z", "2025-03-01T06:00:00Z"},
+		{BackupSchedule{Every: 6 * time.Hour}, "2025-03-01T06:00:00Z", "2025-03-01T12:00:00Z"}, // strictly after
+		{BackupSchedule{Every: 6 * time.Hour}, "2025-03-01T23:30:00Z", "2025-03-02T00:00:00Z"},
+		{BackupSchedule{Every: 24 * time.Hour, Offset: 2 * time.Hour}, "2025-03-01T01:00:00Z", "2025-03-01T02:00:00Z"},
+		{BackupSchedule{Every: 24 * time.Hour, Offset: 2 * time.Hour}, "2025-03-01T03:00:00Z", "2025-03-02T02:00:00Z"},
+		{BackupSchedule{Every: time.Hour, Offset: 90 * time.Minute}, "2025-03-01T10:10:00Z", "2025-03-01T10:30:00Z"},
+		{BackupSchedule{Every: 15 * time.Minute}, "2025-03-01T10:07:00+02:00", "2025-03-01T08:15:00Z"}, // aligned in UTC
+	} {
+		if got := tc.schedule.next(at(tc.now)); !got.Equal(at(tc.expect)) {
+			t.Errorf("every %v (offset %v) after %s: expect %s, got %s", tc.schedule.Every, tc.schedule.Offset, tc.now, tc.expect, got.Format(time.RFC3339))
+		}
+	}
+}
+
+func TestScheduledBackups(t *testing.T) {
+	names := []string{
+		"app-20250302T000000Z.tar.gz",
+		"app-20250301T000000Z.tar",
+		"app-b-20250301T000000Z.tar", // another platform's
+		"app-20250301T000000Z.tar.partial",
+		"app-notes.tar",
+		"application-20250301T000000Z.tar",
+	}
+	expect := []string{"app-20250301T000000Z.tar", "app-20250302T000000Z.tar.gz"}
+	if got := scheduledBackups(names, "app"); !slices.Equal(got, expect) {
+		t.Errorf("expect %v, got %v", expect, got)
+	}
+	if got := scheduledBackups(names, "app-b"); !slices.Equal(got, []string{"app-b-20250301T000000Z.tar"}) {
+		t.Errorf("expect only app-b's backup, got %v", got)
+	}
+}
@@ -0,0 +1,214 @@
+package supago
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/train360-corp/supago/internal/utils"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// backup archive members
+const (
+	backupMetadataFile = "backup.json"
+	backupRolesFile    = "roles.sql"
+	backupDumpFile     = "postgres.dump" // pg_dump custom-format archive of the "postgres" database
+)
+
+type BackupOptions struct {
+	// Compress gzip the backup archive
+	Compress bool
+}
+
+// BackupMetadata describes a logical backup (and is stored within it)
+type BackupMetadata struct {
+	Platform        string        `json:"platform"`
+	CreatedAt       time.Time     `json:"created_at"`
+	Duration        time.Duration `json:"duration"`
+	PostgresVersion string        `json:"postgres_version"`
+	Database        string        `json:"database"`
+	Roles           []string      `json:"roles"`
+	DumpSize        int64         `json:"dump_size"`
+	Compressed      bool          `json:"compressed"`
+	// Size of the whole archive (as written to the destination; not stored within it)
+	Size int64 `json:"-"`
+}
+
+// Backup writes a logical backup of the database to dest
+// The backup is a tar archive (gzipped when compressed) holding the roles (pg_dumpall --roles-only), a pg_dump
+// custom-format archive of the "postgres" database, and BackupMetadata; see Restore.
+func (sg *SupaGo) Backup(ctx context.Context, dest io.Writer, opts BackupOptions) (*BackupMetadata, error) {
+	sg.mu.Lock()
+	db, err := sg.database("supabase_admin", "postgres")
+	platform := sg.config.Global.PlatformName
+	sg.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return sg.backup(ctx, db, platform, dest, opts)
+}
+
+// backup writes a logical backup of the database db (connected as a superuser) is connected to, to dest
+func (sg *SupaGo) backup(ctx context.Context, db *Database, platform string, dest io.Writer, opts BackupOptions) (*BackupMetadata, error) {
+	var err error
+	started := time.Now()
+	metadata := &BackupMetadata{
+		Platform:   platform,
+		CreatedAt:  started.UTC(),
+		Database:   db.name,
+		Compressed: opts.Compress,
+	}
+
+	if metadata.PostgresVersion, err = db.QueryValue(ctx, "SHOW server_version;"); err != nil {
+		return nil, fmt.Errorf("failed to get postgres version: %w", err)
+	}
+	if rows, err := db.Query(ctx, "SELECT rolname FROM pg_roles WHERE rolname !~ '^pg_' ORDER BY rolname;"); err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	} else {
+		for _, row := range rows {
+			metadata.Roles = append(metadata.Roles, row[0])
+		}
+	}
+
+	// roles are small (kept in memory)
+	var roles bytes.Buffer
+	if err := db.stream(ctx, &roles, "pg_dumpall", "--roles-only"); err != nil {
+		return nil, fmt.Errorf("failed to dump roles: %w", err)
+	}
+
+	// the dump is spooled to disk (tar headers need its size up-front)
+	spool, err := os.CreateTemp("", "supago-backup-*.dump")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+	}()
+	compression := "6"
+	if opts.Compress { // the archive is compressed as a whole instead
+		compression = "0"
+	}
+	if err := db.stream(ctx, spool, "pg_dump", "--format=custom", "--compress="+compression, "--dbname="+db.name); err != nil {
+		return nil, fmt.Errorf("failed to dump database: %w", err)
+	}
+	if metadata.DumpSize, err = spool.Seek(0, io.SeekEnd); err != nil {
+		return nil, fmt.Errorf("failed to size dump: %w", err)
+	} else if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind dump: %w", err)
+	}
+	metadata.Duration = time.Since(started)
+
+	// write the archive
+	counter := &countingWriter{w: dest}
+	var out io.Writer = counter
+	var gz *gzip.Writer
+	if opts.Compress {
+		gz = gzip.NewWriter(counter)
+		out = gz
+	}
+	tw := tar.NewWriter(out)
+	meta, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode backup metadata: %w", err)
+	}
+	for _, member := range []struct {
+		name string
+		size int64
+		data io.Reader
+	}{
+		{backupMetadataFile, int64(len(meta)), bytes.NewReader(meta)},
+		{backupRolesFile, int64(roles.Len()), &roles},
+		{backupDumpFile, metadata.DumpSize, spool},
+	} {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     member.name,
+			Typeflag: tar.TypeReg,
+			Mode:     0o600,
+			Size:     member.size,
+			ModTime:  started,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to write backup archive: %w", err)
+		}
+		if _, err := io.Copy(tw, member.data); err != nil {
+			return nil, fmt.Errorf("failed to write backup archive: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write backup archive: %w", err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return nil, fmt.Errorf("failed to write backup archive: %w", err)
+		}
+	}
+	metadata.Size = counter.n
+
+	sg.logger.Infow("backup completed",
+		"size", metadata.Size,
+		"duration", metadata.Duration,
+		"roles", len(metadata.Roles),
+		"compressed", metadata.Compressed,
+		"postgres", metadata.PostgresVersion,
+	)
+	return metadata, nil
+}
+
+// BackupToFile writes a logical backup (see Backup) to a file at path (created with 0600 permissions)
+// The file only appears at path once the backup completed successfully.
+func (sg *SupaGo) BackupToFile(ctx context.Context, path string, opts BackupOptions) (*BackupMetadata, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	tmp := path + ".partial"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup file: %w", err)
+	}
+	metadata, err := sg.Backup(ctx, file, opts)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write backup file: %w", closeErr)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return nil, fmt.Errorf("failed to finalize backup file: %w", err)
+	}
+	return metadata, nil
+}
+
+// stream runs a postgres client tool (e.g., pg_dump) against the database, streaming its output to w
+func (d *Database) stream(ctx context.Context, w io.Writer, tool string, args ...string) error {
+	cmd := append([]string{
+		"env", "-u", "PGPASSWORD",
+		tool,
+		"-h", "127.0.0.1",
+		"-U", d.user,
+	}, args...)
+	stderr, err := utils.ExecInContainerStream(ctx, d.docker, d.cid, cmd, w)
+	if err != nil {
+		return fmt.Errorf("%v (%s)", err, strings.ReplaceAll(strings.TrimSpace(stderr), "\n", "\\n"))
+	}
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
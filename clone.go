@@ -0,0 +1,271 @@
+package supago
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/train360-corp/supago/internal/services/kong"
+	"github.com/train360-corp/supago/internal/utils"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// databases SupaGo's stack depends on (never cloned over, or dropped)
+var protectedDatabases = []string{"postgres", "_supabase", "template0", "template1"}
+
+type CloneDatabaseOptions struct {
+	// Template the database copied (defaults to "postgres")
+	Template string
+}
+
+// CloneDatabase creates database name as a copy of a template database (CREATE DATABASE ... TEMPLATE)
+// Copying requires the template to have no other connections: those of the stack's services are terminated (they
+// reconnect right away). The clone is not served by the stack's APIs (they serve "postgres"); it is meant for direct
+// use (e.g., a test run, or a migration rehearsal) through the returned handle (connected as postgres).
+func (sg *SupaGo) CloneDatabase(ctx context.Context, name string, opts CloneDatabaseOptions) (*Database, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	template := opts.Template
+	if template == "" {
+		template = "postgres"
+	}
+	if name == "" || len(name) > 63 {
+		return nil, fmt.Errorf("invalid database name %q", name)
+	} else if slices.Contains(protectedDatabases, name) {
+		return nil, fmt.Errorf("database %q is managed by supago", name)
+	}
+	db, err := sg.database("supabase_admin", "template1") // not connected to the template
+	if err != nil {
+		return nil, err
+	}
+
+	terminate := fmt.Sprintf(
+		"SELECT count(pg_terminate_backend(pid)) FROM pg_stat_activity WHERE datname = %s AND pid <> pg_backend_pid();",
+		utils.QuoteLiteral(template),
+	)
+	create := fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s;", utils.QuoteIdentifier(name), utils.QuoteIdentifier(template))
+	for attempt := 1; ; attempt++ {
+		_, err := execPsql(ctx, db.docker, db.cid, db.user, db.name, "-c", terminate, "-c", create)
+		if err == nil {
+			break
+		} else if attempt == 5 || !strings.Contains(err.Error(), "is being accessed by other users") {
+			return nil, fmt.Errorf("failed to clone database %q: %w", template, err)
+		}
+		sg.logger.Debugf("database %q is in use (retrying clone)", template)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+		}
+	}
+
+	sg.logger.Infof("cloned database %q into %q", template, name)
+	return sg.database("postgres", name)
+}
+
+// DropDatabase drops database name (terminating its connections), if it exists
+func (sg *SupaGo) DropDatabase(ctx context.Context, name string) error {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	if slices.Contains(protectedDatabases, name) {
+		return fmt.Errorf("database %q is managed by supago", name)
+	}
+	if _, err := sg.psql(ctx, "supabase_admin", "template1",
+		"-c", fmt.Sprintf("DROP DATABASE IF EXISTS %s WITH (FORCE);", utils.QuoteIdentifier(name)),
+	); err != nil {
+		return fmt.Errorf("failed to drop database %q: %w", name, err)
+	}
+	return nil
+}
+
+type CloneStackOptions struct {
+	// Platform the name of the new stack (see IsValidPlatformName)
+	Platform string
+	// Directory the new stack's data is created in (as "postgres/data" and "storage/data")
+	Directory string
+	// KongPort the host port of the new stack's Kong (must differ from this stack's ports)
+	KongPort uint16
+	// AuthServerPort (optional) the host port the new stack serves its auth hooks and email templates on (defaults to
+	// KongPort + 1; see AuthConfig.ServerPort)
+	AuthServerPort uint16
+	// Subnet (optional) of the new stack's docker network (docker-assigned if empty)
+	Subnet string
+}
+
+// CloneStack copies this stack (its database's data directory, storage, keys, credentials and services) into a new
+// stack under another platform name, which can run alongside it (e.g., a preview environment)
+// The data directory is copied while the database keeps running (pg_backup_start / pg_backup_stop); the new stack
+// is not started (see Run), and does not archive WAL.
+func (sg *SupaGo) CloneStack(ctx context.Context, opts CloneStackOptions) (*SupaGo, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	if !IsValidPlatformName(opts.Platform) {
+		return nil, fmt.Errorf("invalid platform name %q", opts.Platform)
+	} else if opts.Platform == sg.config.Global.PlatformName {
+		return nil, errors.New("the cloned stack needs another platform name")
+	} else if opts.Directory == "" {
+		return nil, errors.New("no directory for the cloned stack")
+	} else if opts.KongPort == 0 || opts.KongPort == sg.config.Kong.hostPort() {
+		return nil, fmt.Errorf("the cloned stack needs a kong port other than %d", sg.config.Kong.hostPort())
+	} else if opts.Subnet != "" && opts.Subnet == sg.config.Global.Subnet {
+		return nil, fmt.Errorf("subnet %s is used by this stack", opts.Subnet)
+	}
+	db := sg.databaseService()
+	if db == nil || db.container == nil || sg.docker == nil {
+		return nil, errors.New("database is not running")
+	}
+
+	// the new stack's config
+	cfg := sg.config
+	cfg.Global.PlatformName = opts.Platform
+	cfg.Global.Subnet = opts.Subnet
+	cfg.Database.DataDirectory = filepath.Join(opts.Directory, "postgres", "data")
+	cfg.Database.Archive = nil
+	cfg.Storage.DataDirectory = filepath.Join(opts.Directory, "storage", "data")
+	cfg.Kong.HostPort = opts.KongPort
+	cfg.Auth.ServerPort = opts.AuthServerPort
+	if cfg.Auth.ServesCallbacks() {
+		taken := map[uint16]bool{sg.config.Kong.hostPort(): true, sg.config.Auth.serverPort(sg.config.Kong): true}
+		if port := cfg.Auth.serverPort(cfg.Kong); taken[port] || port == opts.KongPort {
+			return nil, fmt.Errorf("the cloned stack's auth server port %d is taken (see CloneStackOptions.AuthServerPort)", port)
+		} else if taken[opts.KongPort] {
+			return nil, fmt.Errorf("the cloned stack's kong port %d is taken by this stack's auth server", opts.KongPort)
+		}
+	}
+	if sg.config.Kong.URLs.Kong == fmt.Sprintf("http://%s:8000", containerName(sg.config, kong.ContainerName)) {
+		cfg.Kong.URLs.Kong = fmt.Sprintf("http://%s:8000", containerName(cfg, kong.ContainerName))
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config for the cloned stack: %w", err)
+	} else if !isUninitializedDataDirectory(cfg.Database.DataDirectory) {
+		return nil, fmt.Errorf("data directory \"%s\" is not empty", cfg.Database.DataDirectory)
+	}
+	for _, dir := range []string{cfg.Database.DataDirectory, cfg.Storage.DataDirectory} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create \"%s\": %w", dir, err)
+		}
+	}
+	if sg.config.Database.CredentialsStore != nil {
+		cfg.Database.CredentialsStore = DatabaseCredentialsFromConfig(cfg)
+		if err := cfg.Database.CredentialsStore.Save(cfg.Database.passwords()); err != nil {
+			return nil, fmt.Errorf("failed to save database credentials: %w", err)
+		}
+	}
+	if sg.config.Global.SecretsStore != nil {
+		cfg.Global.SecretsStore = SecretsFromConfig(cfg)
+		if secrets, err := cfg.secrets(); err != nil {
+			return nil, err
+		} else if err := cfg.Global.SecretsStore.Save(secrets); err != nil {
+			return nil, fmt.Errorf("failed to save secrets: %w", err)
+		}
+	}
+
+	sg.logger.Infof("cloning stack into %q", opts.Platform)
+	if err := sg.copyDataDirectory(ctx, db.container.ID, cfg.Database.DataDirectory); err != nil {
+		return nil, err
+	}
+
+	// hand the copied data directory to the container's postgres user, and copy storage as is
+	definition, err := db.constructor(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct the cloned database: %w", err)
+	}
+	if _, err := sg.runTask(ctx, Service{
+		Image:      definition.Image,
+		Name:       containerName(cfg, dbContainerName) + "-clone",
+		Entrypoint: []string{"sh", "-c", "chown -R postgres:postgres /clone/postgres && chmod 0700 /clone/postgres && cp -a /source/storage/. /clone/storage/"},
+		Mounts: []mount.Mount{
+			{Type: mount.TypeBind, Source: cfg.Database.DataDirectory, Target: "/clone/postgres"},
+			{Type: mount.TypeBind, Source: sg.config.Storage.DataDirectory, Target: "/source/storage", ReadOnly: true},
+			{Type: mount.TypeBind, Source: cfg.Storage.DataDirectory, Target: "/clone/storage"},
+		},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to prepare cloned data: %w", err)
+	}
+
+	clone := constructor(cfg)
+	clone.logger = sg.logger
+	clone.migrations = slices.Clone(sg.migrations)
+	clone.seeds = slices.Clone(sg.seeds)
+	for _, service := range sg.services {
+		if service.constructor == nil {
+			sg.logger.Warnf("%v cannot be cloned (no constructor); skipping", service)
+			continue
+		}
+		service, err := clone.construct(service.constructor)
+		if err != nil {
+			return nil, err
+		}
+		clone.services = append(clone.services, service)
+	}
+	return clone, nil
+}
+
+// copyDataDirectory copies the data directory of the (running) database in container cid into dir, on the host
+// A temporary replication slot retains the WAL written during the copy, which the copy replays when it first starts.
+// The caller must hold sg.mu
+func (sg *SupaGo) copyDataDirectory(ctx context.Context, cid, dir string) error {
+	const staging = "/tmp/supago/clone"
+	script := fmt.Sprintf(`SELECT pg_create_physical_replication_slot('supago_clone', true, true);
+SELECT pg_backup_start('supago-clone', true);
+\! mkdir -p %[1]s && tar -C /var/lib/postgresql/data --exclude='./pg_wal/*' --exclude='./pg_replslot/*' --exclude=./postmaster.pid --exclude=./postmaster.opts -cf %[1]s/base.tar . ; echo $? > %[1]s/tar.status
+\pset tuples_only on
+\pset format unaligned
+\o %[1]s/backup_label
+SELECT labelfile FROM pg_backup_stop(false);
+\o
+\! tar -C /var/lib/postgresql/data -cf %[1]s/wal.tar ./pg_wal
+`, staging)
+	defer func() {
+		_, _ = utils.ExecInContainer(context.Background(), sg.docker, cid, []string{"rm", "-rf", staging, "/tmp/supago/sql/clone.sql"})
+	}()
+	if err := utils.CopyToContainer(ctx, sg.docker, cid, EmbeddedFile{Data: []byte(script), Path: "/tmp/supago/sql/clone.sql"}); err != nil {
+		return fmt.Errorf("failed to copy clone script into container: %w", err)
+	}
+	if _, err := execPsql(ctx, sg.docker, cid, "supabase_admin", "postgres", "-f", "/tmp/supago/sql/clone.sql"); err != nil {
+		return fmt.Errorf("failed to copy data directory: %w", err)
+	}
+	if status, err := utils.ExecInContainer(ctx, sg.docker, cid, []string{"cat", path.Join(staging, "tar.status")}); err != nil {
+		return fmt.Errorf("failed to copy data directory: %w", err)
+	} else if status = strings.TrimSpace(status); status != "0" && status != "1" { // 1: files changed while read
+		return fmt.Errorf("failed to copy data directory (tar exited with %s)", status)
+	}
+
+	reader, _, err := sg.docker.CopyFromContainer(ctx, cid, staging)
+	if err != nil {
+		return fmt.Errorf("failed to read copied data directory: %w", err)
+	}
+	defer reader.Close()
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read copied data directory: %w", err)
+		}
+		switch path.Base(header.Name) {
+		case "base.tar", "wal.tar":
+			if err := utils.ExtractTar(tr, dir); err != nil {
+				return fmt.Errorf("failed to extract copied data directory: %w", err)
+			}
+		case "backup_label":
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return fmt.Errorf("failed to read backup label: %w", err)
+			} else if err := os.WriteFile(filepath.Join(dir, "backup_label"), data, 0o600); err != nil {
+				return fmt.Errorf("failed to write backup label: %w", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/train360-corp/supago"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// stackFile the config file describing a stack (JSON)
+type stackFile struct {
+	// Platform the name of the stack
+	Platform string `json:"platform"`
+	// Config (optional) a config file (YAML, TOML or JSON; relative to this file) setting any Config field (see
+	// supago.LoadConfig); it takes precedence over the fields below, and SUPAGO_* environment variables over both
+	Config string `json:"config"`
+	// Directory the stack's data is kept in ("postgres" and "storage"); relative to the config file (defaults to its directory)
+	Directory string `json:"directory"`
+	// Services the services of the stack, by name (defaults to all)
+	Services []string `json:"services"`
+	// KongPort the host port Kong is published on (defaults to 8000)
+	KongPort uint16 `json:"kong_port"`
+	// Subnet (optional) of the stack's docker network (docker-assigned if empty)
+	Subnet string `json:"subnet"`
+	// SiteURL where the frontend site is publicly accessible
+	SiteURL string `json:"site_url"`
+	// SigningAlgorithm the algorithm JWTs are signed with: RS256 (default), ES256 or HS256 (a key persisted next to the
+	// database keeps the API keys valid across runs)
+	SigningAlgorithm string `json:"signing_algorithm"`
+	// Migrations and Seeds directories (relative to the config file)
+	Migrations string `json:"migrations"`
+	Seeds      string `json:"seeds"`
+	Debug      bool   `json:"debug"`
+}
+
+// services every prebuilt service, by name
+var services = map[string]supago.ServiceConstructor{
+	"analytics": supago.Services.Analytics,
+	"auth":      supago.Services.Auth,
+	"imgproxy":  supago.Services.ImgProxy,
+	"kong":      supago.Services.Kong,
+	"meta":      supago.Services.Meta,
+	"postgres":  supago.Services.Postgres,
+	"postgrest": supago.Services.Postgrest,
+	"realtime":  supago.Services.Realtime,
+	"storage":   supago.Services.Storage,
+	"studio":    supago.Services.Studio,
+}
+
+// loadStack reads the config file at path, and builds the stack it describes
+func loadStack(path string, debug bool) (*supago.SupaGo, *supago.Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var file stackFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, nil, fmt.Errorf("invalid config file \"%s\": %w", path, err)
+	}
+	base, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve config file directory: %w", err)
+	}
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(base, p)
+	}
+	dir := base
+	if file.Directory != "" {
+		dir = resolve(file.Directory)
+	}
+	if file.SigningAlgorithm == "" {
+		file.SigningAlgorithm = string(supago.SigningAlgorithmRS256) // deterministic signatures (the same API keys on every run)
+	}
+
+	constructors := supago.Services.All()
+	if len(file.Services) > 0 {
+		constructors = nil
+		for _, name := range file.Services {
+			constructor, ok := services[name]
+			if !ok {
+				return nil, nil, fmt.Errorf("invalid config file \"%s\": unknown service %q (one of %s)", path, name, strings.Join(serviceNames(), ", "))
+			}
+			constructors = append(constructors, constructor)
+		}
+	}
+
+	// the file's fields go through the builder, so the config file and SUPAGO_* environment variables override them
+	builder := supago.ConfigBuilder().DataDirectory(dir)
+	if file.Platform != "" {
+		builder.Platform(file.Platform)
+	}
+	if file.KongPort != 0 {
+		builder.KongPort(file.KongPort)
+	}
+	if file.Subnet != "" {
+		builder.Subnet(file.Subnet)
+	}
+	if file.SiteURL != "" {
+		builder.SiteURL(file.SiteURL)
+	}
+	if file.Debug {
+		builder.Debug(true)
+	}
+	if file.Config != "" {
+		builder.FromFile(resolve(file.Config))
+	}
+	switch algorithm := supago.SigningAlgorithm(file.SigningAlgorithm); algorithm {
+	case supago.SigningAlgorithmES256, supago.SigningAlgorithmRS256:
+		builder.GetSigningKeyUsing(supago.SigningKeyFromFile(algorithm)(filepath.Join(dir, "postgres", fmt.Sprintf("jwt_signing_%s.pem", algorithm))))
+	case "HS256":
+	default:
+		return nil, nil, fmt.Errorf("invalid config file \"%s\": unsupported signing algorithm %q", path, file.SigningAlgorithm)
+	}
+	cfg, err := builder.FromEnv().BuildE()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid config file \"%s\": %w", path, err)
+	}
+
+	sg, err := supago.New(cfg).SetLogger(logger(debug)).AddService(constructors[0], constructors[1:]...)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, source := range []struct {
+		dir string
+		add func(dir string)
+	}{
+		{resolve(file.Migrations), func(dir string) { sg.AddMigrations(os.DirFS(dir)) }},
+		{resolve(file.Seeds), func(dir string) { sg.AddSeeds(os.DirFS(dir)) }},
+	} {
+		if source.dir == "" {
+			continue
+		} else if info, err := os.Stat(source.dir); err != nil || !info.IsDir() {
+			return nil, nil, fmt.Errorf("invalid config file \"%s\": \"%s\" is not a directory", path, source.dir)
+		}
+		source.add(source.dir)
+	}
+	return sg, cfg, nil
+}
+
+// findConfig the config file to use: path if set, otherwise the first default name found in the working directory
+func findConfig(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	for _, name := range []string{"supago.json"} {
+		if _, err := os.Stat(name); err == nil {
+			return name, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", errors.New("no config file (supago.json) in the working directory (specify one with -config)")
+}
+
+// serviceNames the names of every prebuilt service
+func serviceNames() []string {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeStack writes a stack file (and its config file) to a new directory, returning the stack file's path
+func writeStack(t *testing.T, stack, config string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "supago.yaml"), []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "supago.json")
+	if err := os.WriteFile(path, []byte(stack), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadStackPrecedence(t *testing.T) {
+	stack := `{
+  "platform": "stacktest",
+  "config": "supago.yaml",
+  "kong_port": 8100,
+  "subnet": "172.31.0.0/16",
+  "site_url": "http://127.0.0.1:3100",
+  "signing_algorithm": "HS256",
+  "debug": true
+}`
+
+	// the stack file's fields, where nothing overrides them
+	_, cfg, err := loadStack(writeStack(t, stack, ""), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Kong.HostPort != 8100 || cfg.Global.Subnet != "172.31.0.0/16" || cfg.Kong.URLs.Site != "http://127.0.0.1:3100" || !cfg.Global.DebugMode {
+		t.Errorf("expected the stack file's fields, got %+v %+v", cfg.Global, cfg.Kong)
+	}
+
+	// the config file over the stack file's fields
+	_, cfg, err = loadStack(writeStack(t, stack, "kong:\n  host_port: 8200\n"), false)
+	if err != nil {
+		t.Fatal(err)
+	} else if cfg.Kong.HostPort != 8200 {
+		t.Errorf("expected the config file's Kong port, got %d", cfg.Kong.HostPort)
+	}
+
+	// the environment over both
+	t.Setenv("SUPAGO_KONG_HOST_PORT", "8300")
+	t.Setenv("SUPAGO_GLOBAL_SUBNET", "172.32.0.0/16")
+	t.Setenv("SUPAGO_KONG_URLS_SITE", "http://127.0.0.1:3300")
+	t.Setenv("SUPAGO_GLOBAL_DEBUG_MODE", "false")
+	_, cfg, err = loadStack(writeStack(t, stack, "kong:\n  host_port: 8200\n"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Kong.HostPort != 8300 || cfg.Global.Subnet != "172.32.0.0/16" || cfg.Kong.URLs.Site != "http://127.0.0.1:3300" || cfg.Global.DebugMode {
+		t.Errorf("expected the environment's fields, got %+v %+v", cfg.Global, cfg.Kong)
+	}
+}
+
+// TestLoadStackSecrets every invocation (e.g., `supago keys` next to `supago up`) builds the same secrets
+func TestLoadStackSecrets(t *testing.T) {
+	path := writeStack(t, `{"platform": "stacktest", "signing_algorithm": "HS256"}`, "")
+	_, first, err := loadStack(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := loadStack(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Keys.JwtSecret != second.Keys.JwtSecret || first.Keys.PublicJwt != second.Keys.PublicJwt || first.Keys.PrivateJwt != second.Keys.PrivateJwt {
+		t.Error("expected the same keys on every load")
+	} else if first.Dashboard != second.Dashboard || first.LogFlare != second.LogFlare || first.Auth.Hooks.Secret != second.Auth.Hooks.Secret {
+		t.Error("expected the same dashboard credentials, LogFlare keys and hooks secret on every load")
+	}
+}
@@ -0,0 +1,292 @@
+// Command supago manages a SupaGo stack described by a config file (see stackFile)
+//
+//	supago [-config supago.json] [-v] <command> [arguments]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/train360-corp/supago"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+)
+
+const usage = `usage: supago [-config file] [-v] <command> [arguments]
+
+commands:
+  up [-d] [-force]             start the stack (in the foreground, unless detached)
+  down                         stop and remove the stack's containers
+  status                       show the state of every service
+  logs [-f] [-n lines] <svc>   show a service's logs
+  restart <svc>                restart a service's container
+  psql [args...]               run psql against the database (as postgres)
+  backup [-gzip] <file>        write a logical backup of the database
+  restore [-new] <file>        load a logical backup into the database
+  keys                         show the API keys
+  plan                         show the services the stack consists of
+
+services are named by alias (e.g., db, kong, auth, rest) or container name
+`
+
+// command runs a subcommand with its arguments
+type command func(ctx context.Context, sg *supago.SupaGo, cfg *supago.Config, args []string) error
+
+var commands = map[string]command{
+	"up":      up,
+	"down":    down,
+	"status":  status,
+	"logs":    logs,
+	"restart": restart,
+	"psql":    psql,
+	"backup":  backup,
+	"restore": restore,
+	"keys":    keys,
+	"plan":    plan,
+}
+
+func main() {
+	flags := flag.NewFlagSet("supago", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	configPath := flags.String("config", "", "the config file (defaults to supago.json)")
+	verbose := flags.Bool("v", false, "log debug output")
+	_ = flags.Parse(os.Args[1:])
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "supago: unknown command %q\n\n%s", flags.Arg(0), usage)
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	err := func() error {
+		path, err := findConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		sg, cfg, err := loadStack(path, *verbose)
+		if err != nil {
+			return err
+		}
+		return cmd(ctx, sg, cfg, flags.Args()[1:])
+	}()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "supago: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// logger logs to stderr (info and above, unless debug)
+func logger(debug bool) *zap.SugaredLogger {
+	if debug {
+		return supago.NewOpinionatedLogger(zapcore.DebugLevel, false)
+	}
+	return supago.NewOpinionatedLogger(zapcore.InfoLevel, false)
+}
+
+// parse parses a subcommand's flags, requiring exactly n positional arguments (any number if n is negative)
+func parse(flags *flag.FlagSet, args []string, n int) ([]string, error) {
+	flags.SetOutput(os.Stderr)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	} else if n >= 0 && flags.NArg() != n {
+		return nil, fmt.Errorf("%s: expected %d argument(s), got %d", flags.Name(), n, flags.NArg())
+	}
+	return flags.Args(), nil
+}
+
+func up(ctx context.Context, sg *supago.SupaGo, cfg *supago.Config, args []string) error {
+	flags := flag.NewFlagSet("up", flag.ContinueOnError)
+	detach := flags.Bool("d", false, "return once the stack is running")
+	force := flags.Bool("force", false, "remove conflicting containers")
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	if *detach && cfg.Auth.ServesCallbacks() {
+		return errors.New("up: the auth hooks and email templates are served by this process, so the stack can't run detached (run it without -d)")
+	}
+	run := sg.Run
+	if *force {
+		run = sg.RunForcefully
+	}
+	if err := run(ctx); err != nil {
+		return err
+	}
+	fmt.Printf("API:   http://127.0.0.1:%d\n", kongPort(cfg))
+	if *detach {
+		return nil
+	}
+	<-ctx.Done()
+	sg.Stop()
+	return nil
+}
+
+func down(ctx context.Context, sg *supago.SupaGo, _ *supago.Config, args []string) error {
+	if _, err := parse(flag.NewFlagSet("down", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	return sg.Down(ctx)
+}
+
+func status(ctx context.Context, sg *supago.SupaGo, _ *supago.Config, args []string) error {
+	if _, err := parse(flag.NewFlagSet("status", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	statuses, err := sg.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tIMAGE\tSTATE\tHEALTH\tPORTS")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Service, s.Image, or(s.State, "-"), or(s.Health, "-"), strings.Join(s.Ports, ", "))
+	}
+	return w.Flush()
+}
+
+func logs(ctx context.Context, sg *supago.SupaGo, _ *supago.Config, args []string) error {
+	flags := flag.NewFlagSet("logs", flag.ContinueOnError)
+	follow := flags.Bool("f", false, "follow the output")
+	tail := flags.Int("n", 0, "the number of lines to show from the end (all if 0)")
+	timestamps := flags.Bool("t", false, "show timestamps")
+	args, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	return sg.Logs(ctx, args[0], os.Stdout, supago.LogsOptions{Follow: *follow, Tail: *tail, Timestamps: *timestamps})
+}
+
+func restart(ctx context.Context, sg *supago.SupaGo, _ *supago.Config, args []string) error {
+	args, err := parse(flag.NewFlagSet("restart", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	} else if err := sg.Attach(ctx); err != nil {
+		return err
+	}
+	return sg.Restart(ctx, args[0])
+}
+
+// psql runs psql interactively through the docker CLI (for a terminal)
+func psql(ctx context.Context, sg *supago.SupaGo, _ *supago.Config, args []string) error {
+	var db string
+	for _, service := range sg.Services() {
+		if slices.Contains(service.Aliases, "db") {
+			db = service.Name
+		}
+	}
+	if db == "" {
+		return errors.New("the stack has no database")
+	}
+	flags := []string{"exec", "-i"}
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		flags = append(flags, "-t")
+	}
+	cmd := exec.CommandContext(ctx, "docker", append(append(flags, db, "psql", "-h", "127.0.0.1", "-U", "postgres", "-d", "postgres"), args...)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+func backup(ctx context.Context, sg *supago.SupaGo, _ *supago.Config, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	compress := flags.Bool("gzip", false, "gzip the backup")
+	args, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	} else if err := sg.Attach(ctx); err != nil {
+		return err
+	}
+	metadata, err := sg.BackupToFile(ctx, args[0], supago.BackupOptions{Compress: *compress})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("backed up postgres %s to %s (%d bytes, %v)\n", metadata.PostgresVersion, args[0], metadata.Size, metadata.Duration)
+	return nil
+}
+
+func restore(ctx context.Context, sg *supago.SupaGo, _ *supago.Config, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fresh := flags.Bool("new", false, "restore into a new data directory (moving the current one aside)")
+	args, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	} else if err := sg.Attach(ctx); err != nil {
+		return err
+	}
+	result, err := sg.RestoreFromFile(ctx, args[0], supago.RestoreOptions{NewDataDirectory: *fresh})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restored %s (taken %s) in %v\n", args[0], result.Backup.CreatedAt.Format("2006-01-02 15:04:05"), result.Duration)
+	if result.PreviousDataDirectory != "" {
+		fmt.Printf("previous data directory kept at %s\n", result.PreviousDataDirectory)
+	}
+	return nil
+}
+
+func keys(_ context.Context, _ *supago.SupaGo, cfg *supago.Config, args []string) error {
+	if _, err := parse(flag.NewFlagSet("keys", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "API URL\thttp://127.0.0.1:%d\n", kongPort(cfg))
+	fmt.Fprintf(w, "anon key\t%s\n", cfg.Keys.PublicJwt)
+	fmt.Fprintf(w, "service_role key\t%s\n", cfg.Keys.PrivateJwt)
+	if cfg.Keys.JWKS != "" {
+		fmt.Fprintf(w, "JWKS\t%s\n", cfg.Keys.JWKS)
+	}
+	return w.Flush()
+}
+
+func plan(_ context.Context, sg *supago.SupaGo, cfg *supago.Config, args []string) error {
+	if _, err := parse(flag.NewFlagSet("plan", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	fmt.Printf("platform %s\n", cfg.Global.PlatformName)
+	fmt.Printf("  database data: %s\n", cfg.Database.DataDirectory)
+	fmt.Printf("  storage data:  %s\n\n", cfg.Storage.DataDirectory)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tIMAGE\tALIASES\tPORTS\tMOUNTS")
+	for _, service := range sg.Services() {
+		var ports, mounts []string
+		for _, port := range service.Ports {
+			host := port
+			if mapped, ok := service.HostPorts[port]; ok {
+				host = mapped
+			}
+			ports = append(ports, fmt.Sprintf("127.0.0.1:%d->%d", host, port))
+		}
+		for _, mount := range service.Mounts {
+			mounts = append(mounts, fmt.Sprintf("%s:%s", mount.Source, mount.Target))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", service.Name, service.Image, strings.Join(service.Aliases, ","), or(strings.Join(ports, ", "), "-"), or(strings.Join(mounts, ", "), "-"))
+	}
+	return w.Flush()
+}
+
+// kongPort the host port Kong is published on
+func kongPort(cfg *supago.Config) uint16 {
+	if cfg.Kong.HostPort == 0 {
+		return 8000
+	}
+	return cfg.Kong.HostPort
+}
+
+// or s, unless empty
+func or(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
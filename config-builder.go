@@ -3,11 +3,40 @@ package supago
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
 )
 
 type configBuilder struct {
 	platform            *string
 	encryptionKeyGetter EncryptionKeyGetter
+	signingAlgorithm    *SigningAlgorithm
+	signingKeyGetter    SigningKeyGetter
+	credentialsStore    DatabaseCredentialsStore
+	noCredentialsStore  bool
+	secretsStore        SecretsStore
+	noSecretsStore      bool
+	archive             *ArchiveConfig
+	postgresSettings    map[string]string
+	postgresConfigFile  []byte
+	postgresMemory      int64
+	extensions          []Extension
+	files               []string
+	env                 bool
+	debug               *bool
+	subnet              *string
+	siteURL             *string
+	kongURL             *string
+	kongPort            *uint16
+	smtp                *KongSMTPConfig
+	dataDirectory       *string
+	databaseDirectory   *string
+	storageDirectory    *string
+	dashboard           *DashboardConfig
+	logFlare            *LogFlareConfig
+	rest                *RestConfig
+	auth                *AuthConfig
 }
 
 func ConfigBuilder() *configBuilder {
@@ -19,6 +48,84 @@ func (b *configBuilder) Platform(platform string) *configBuilder {
 	return b
 }
 
+// Debug run the services in debug mode (verbose logging)
+func (b *configBuilder) Debug(enabled bool) *configBuilder {
+	b.debug = &enabled
+	return b
+}
+
+// Subnet of the platform's docker network, e.g., "172.31.0.0/16" (docker-assigned if empty)
+func (b *configBuilder) Subnet(cidr string) *configBuilder {
+	b.subnet = &cidr
+	return b
+}
+
+// SiteURL where the frontend site is publicly accessible (e.g., "https://example.com")
+func (b *configBuilder) SiteURL(url string) *configBuilder {
+	b.siteURL = &url
+	return b
+}
+
+// KongURL where Kong (the API) is publicly accessible (e.g., "https://api.example.com")
+func (b *configBuilder) KongURL(url string) *configBuilder {
+	b.kongURL = &url
+	return b
+}
+
+// KongPort publish Kong on a (127.0.0.1) host port other than 8000
+func (b *configBuilder) KongPort(port uint16) *configBuilder {
+	b.kongPort = &port
+	return b
+}
+
+// SMTP send auth emails through an SMTP server (reached from the auth container)
+func (b *configBuilder) SMTP(smtp KongSMTPConfig) *configBuilder {
+	b.smtp = &smtp
+	return b
+}
+
+// DataDirectory keep the stack's data in dir (as "postgres/data" and "storage/data"; defaults to the working directory)
+func (b *configBuilder) DataDirectory(dir string) *configBuilder {
+	b.dataDirectory = &dir
+	return b
+}
+
+// DatabaseDirectory keep the database's data in dir (the encryption key and credentials are kept next to it)
+func (b *configBuilder) DatabaseDirectory(dir string) *configBuilder {
+	b.databaseDirectory = &dir
+	return b
+}
+
+// StorageDirectory keep the storage service's objects in dir
+func (b *configBuilder) StorageDirectory(dir string) *configBuilder {
+	b.storageDirectory = &dir
+	return b
+}
+
+// DashboardCredentials the username and password Studio is protected with (random unless set)
+func (b *configBuilder) DashboardCredentials(username, password string) *configBuilder {
+	b.dashboard = &DashboardConfig{Username: username, Password: password}
+	return b
+}
+
+// LogFlareKeys the API keys of the analytics service (random unless set)
+func (b *configBuilder) LogFlareKeys(publicKey, privateKey string) *configBuilder {
+	b.logFlare = &LogFlareConfig{PublicKey: publicKey, PrivateKey: privateKey}
+	return b
+}
+
+// Rest configure how PostgREST exposes the database (e.g., its schemas, or row limits)
+func (b *configBuilder) Rest(rest RestConfig) *configBuilder {
+	b.rest = &rest
+	return b
+}
+
+// Auth configure how users sign up and in (e.g., signup, MFA, password policy, or OAuth providers)
+func (b *configBuilder) Auth(auth AuthConfig) *configBuilder {
+	b.auth = &auth
+	return b
+}
+
 func (b *configBuilder) EncryptionKey(key string) *configBuilder {
 	b.encryptionKeyGetter = StaticEncryptionKey(key)
 	return b
@@ -29,6 +136,115 @@ func (b *configBuilder) GetEncryptionKeyUsing(getter EncryptionKeyGetter) *confi
 	return b
 }
 
+// SigningAlgorithm sign JWTs with an asymmetric key (persisted next to the database data directory)
+func (b *configBuilder) SigningAlgorithm(algorithm SigningAlgorithm) *configBuilder {
+	b.signingAlgorithm = &algorithm
+	return b
+}
+
+// GetSigningKeyUsing sign JWTs with an asymmetric key retrieved from getter
+func (b *configBuilder) GetSigningKeyUsing(getter SigningKeyGetter) *configBuilder {
+	b.signingKeyGetter = getter
+	return b
+}
+
+// DatabaseCredentialsUsing persist database passwords with store (defaults to a file next to the database data directory)
+// Passing nil disables persistence (new passwords are then generated on every build)
+func (b *configBuilder) DatabaseCredentialsUsing(store DatabaseCredentialsStore) *configBuilder {
+	b.credentialsStore = store
+	b.noCredentialsStore = store == nil
+	return b
+}
+
+// SecretsUsing persist generated secrets with store (defaults to a file next to the database data directory)
+// Passing nil disables persistence (new secrets are then generated on every build, so other processes building the
+// config, such as the supago CLI, can't agree with the running stack)
+func (b *configBuilder) SecretsUsing(store SecretsStore) *configBuilder {
+	b.secretsStore = store
+	b.noSecretsStore = store == nil
+	return b
+}
+
+// ArchiveWAL continuously archive the database's WAL (and base backups) for point-in-time recovery
+func (b *configBuilder) ArchiveWAL(archive ArchiveConfig) *configBuilder {
+	b.archive = &archive
+	return b
+}
+
+// PostgresSetting set a postgres configuration parameter (e.g., "max_connections", "200")
+func (b *configBuilder) PostgresSetting(name, value string) *configBuilder {
+	if b.postgresSettings == nil {
+		b.postgresSettings = map[string]string{}
+	}
+	b.postgresSettings[name] = value
+	return b
+}
+
+// PostgresConfigFile additional postgresql.conf contents (e.g., a postgresql.custom.conf); see DatabaseConfig.ConfigFile
+func (b *configBuilder) PostgresConfigFile(contents []byte) *configBuilder {
+	b.postgresConfigFile = contents
+	return b
+}
+
+// PostgresMemory size postgres (shared_buffers, work_mem, max_connections, etc.) for bytes of dedicated memory
+func (b *configBuilder) PostgresMemory(bytes int64) *configBuilder {
+	b.postgresMemory = bytes
+	return b
+}
+
+// Extensions keep the database provisioned with extensions (see DatabaseConfig.Extensions)
+func (b *configBuilder) Extensions(extensions ...Extension) *configBuilder {
+	b.extensions = append(b.extensions, extensions...)
+	return b
+}
+
+// apply sets the fields of cfg the builder's methods were called for
+func (b *configBuilder) apply(cfg *Config) {
+	if b.debug != nil {
+		cfg.Global.DebugMode = *b.debug
+	}
+	if b.subnet != nil {
+		cfg.Global.Subnet = *b.subnet
+	}
+	if b.siteURL != nil {
+		cfg.Kong.URLs.Site = *b.siteURL
+	}
+	if b.kongURL != nil {
+		cfg.Kong.URLs.Kong = *b.kongURL
+	}
+	if b.kongPort != nil {
+		cfg.Kong.HostPort = *b.kongPort
+	}
+	if b.smtp != nil {
+		cfg.Kong.SMTP = *b.smtp
+	}
+	if b.dataDirectory != nil {
+		cfg.Database.DataDirectory = filepath.Join(*b.dataDirectory, "postgres", "data")
+		cfg.Storage.DataDirectory = filepath.Join(*b.dataDirectory, "storage", "data")
+	}
+	if b.databaseDirectory != nil {
+		cfg.Database.DataDirectory = *b.databaseDirectory
+	}
+	if b.storageDirectory != nil {
+		cfg.Storage.DataDirectory = *b.storageDirectory
+	}
+	if b.dashboard != nil {
+		cfg.Dashboard = *b.dashboard
+	}
+	if b.logFlare != nil {
+		cfg.LogFlare = *b.logFlare
+	}
+	if b.rest != nil {
+		cfg.Rest = *b.rest
+	}
+	if b.auth != nil {
+		cfg.Auth = *b.auth
+	}
+}
+
+// Build like BuildE, but panics if the config is invalid
+//
+// Deprecated: use BuildE, and handle the error.
 func (b *configBuilder) Build() *Config {
 	cfg, err := b.BuildE()
 	if err != nil {
@@ -39,31 +255,170 @@ func (b *configBuilder) Build() *Config {
 
 func (b *configBuilder) BuildE() (*Config, error) {
 
-	if b.platform == nil {
-		return nil, errors.New("no platform specified (use the .Platform(...) method to specify one)")
-	} else if !IsValidPlatformName(*b.platform) {
+	// the platform may be named by the config files or environment, which the base config depends on
+	var named Config
+	if _, err := b.applyOverrides(&named); err != nil {
+		return nil, err
+	}
+	platform := b.platform
+	if named.Global.PlatformName != "" {
+		platform = &named.Global.PlatformName
+	}
+	if platform == nil {
+		return nil, errors.New("no platform specified (use the .Platform(...) method, or global.platform_name, to specify one)")
+	} else if !IsValidPlatformName(*platform) {
 		return nil, errors.New("invalid platform specified (use the .Platform(...) method to specify a proper one)")
 	}
-	cfg, err := newBaseConfig(*b.platform)
+	cfg, err := newBaseConfig(*platform)
 	if err != nil {
 		return nil, fmt.Errorf("could not create config: %w", err)
 	}
 
-	// use default generator from the config itself
-	if b.encryptionKeyGetter == nil {
-		b.encryptionKeyGetter = EncryptionKeyFromConfig(*cfg)
+	cfg.Database.Settings = b.postgresSettings
+	cfg.Database.ConfigFile = b.postgresConfigFile
+	cfg.Database.Memory = b.postgresMemory
+	cfg.Database.Extensions = b.extensions
+	cfg.Database.Archive = b.archive
+	generatedSecrets := cfg.generatedSecrets()
+	b.apply(cfg)
+
+	// config files and the environment take precedence over the builder's methods
+	generated := cfg.Database
+	set, err := b.applyOverrides(cfg)
+	if err != nil {
+		return nil, err
+	}
+	explicitSecrets := map[string]string{}
+	for name, secret := range cfg.generatedSecrets() {
+		if secret != generatedSecrets[name] {
+			explicitSecrets[name] = secret
+		}
+	}
+	if cfg.Auth.Hooks.Secret == "" {
+		cfg.Auth.Hooks.Secret = randomHookSecret()
+	}
+	explicitPasswords := map[string]string{}
+	for _, role := range databaseRoles {
+		if password := cfg.Database.RolePassword(role); password != generated.RolePassword(role) {
+			explicitPasswords[role] = password
+		}
 	}
 
-	// get the key
-	if key, err := b.encryptionKeyGetter(); err != nil {
-		return nil, fmt.Errorf("failed to get encryption key: %w", err)
-	} else {
+	if b.kongPort != nil && *b.kongPort == 0 {
+		return nil, errors.New("invalid Kong port: must be non-zero")
+	} else if err := cfg.resolveDirectories(); err != nil {
+		return nil, err
+	} else if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 
-		if _, err := IsValidEncryptionKey(key); err != nil {
-			return nil, fmt.Errorf("failed to validate encryption key: %v", err)
+	// get the key (unless set explicitly); using the default generator from the config itself
+	if !set["keys.pg_sodium_encryption"] {
+		getter := b.encryptionKeyGetter
+		if getter == nil {
+			getter = EncryptionKeyFromConfig(*cfg)
+		}
+		key, err := getter()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get encryption key: %w", err)
 		}
-
 		cfg.Keys.PgSodiumEncryption = key
-		return cfg, nil
 	}
+	if _, err := IsValidEncryptionKey(cfg.Keys.PgSodiumEncryption); err != nil {
+		return nil, fmt.Errorf("failed to validate encryption key: %v", err)
+	}
+
+	// use default (file-based) credentials store
+	store := b.credentialsStore
+	if store == nil && !b.noCredentialsStore {
+		store = DatabaseCredentialsFromConfig(*cfg)
+	}
+
+	// load (or persist newly generated, or explicitly set) database passwords
+	if store != nil {
+		stored, err := store.Load()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load database credentials: %w", err)
+		}
+		cfg.Database = cfg.Database.withPasswords(stored).withPasswords(explicitPasswords)
+		cfg.Database.CredentialsStore = store
+		if len(explicitPasswords) > 0 || slices.ContainsFunc(databaseRoles, func(role string) bool { return stored[role] == "" }) { // first run (or new roles)
+			if err := store.Save(cfg.Database.passwords()); err != nil {
+				return nil, fmt.Errorf("failed to save database credentials: %w", err)
+			}
+		}
+	}
+
+	// use default (file-based) secrets store
+	secretsStore := b.secretsStore
+	if secretsStore == nil && !b.noSecretsStore {
+		secretsStore = SecretsFromConfig(*cfg)
+	}
+
+	// load secrets (persisted, with any newly generated or explicitly set ones, once the keys are settled)
+	var storedSecrets map[string]string
+	if secretsStore != nil {
+		if storedSecrets, err = secretsStore.Load(); err != nil {
+			return nil, fmt.Errorf("failed to load secrets: %w", err)
+		}
+		*cfg = cfg.withSecrets(storedSecrets).withSecrets(explicitSecrets)
+		cfg.Global.SecretsStore = secretsStore
+	}
+
+	// keys a rotation switched to (see RotateKeys) take precedence over the signing key
+	rotated, err := rotatedKeys(storedSecrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rotated keys: %w", err)
+	} else if rotated != nil {
+		rotated.PgSodiumEncryption = cfg.Keys.PgSodiumEncryption
+		cfg.Keys = *rotated
+	}
+
+	// use default (file-based) signing key when only an algorithm was requested
+	signingKeyGetter := b.signingKeyGetter
+	if signingKeyGetter == nil && b.signingAlgorithm != nil {
+		switch *b.signingAlgorithm {
+		case SigningAlgorithmRS256, SigningAlgorithmES256:
+			signingKeyGetter = SigningKeyFromConfig(*b.signingAlgorithm)(*cfg)
+		default:
+			return nil, fmt.Errorf("unsupported signing algorithm \"%s\"", *b.signingAlgorithm)
+		}
+	}
+
+	// re-sign keys using the asymmetric key (or an explicitly set secret)
+	if rotated == nil && (signingKeyGetter != nil || cfg.Keys.JwtSecret != generatedSecrets["jwt_secret"]) {
+		var signingKey *SigningKey
+		if signingKeyGetter != nil {
+			if signingKey, err = signingKeyGetter(); err != nil {
+				return nil, fmt.Errorf("failed to get signing key: %w", err)
+			} else if signingKey == nil {
+				return nil, errors.New("signing key getter returned no key")
+			}
+		}
+		keys, err := getJwtKeysConfig(cfg.Keys.JwtSecret, signingKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to construct jwt keys config: %w", err)
+		}
+		keys.PgSodiumEncryption = cfg.Keys.PgSodiumEncryption
+		if set["keys.public_jwt"] {
+			keys.PublicJwt = cfg.Keys.PublicJwt
+		}
+		if set["keys.private_jwt"] {
+			keys.PrivateJwt = cfg.Keys.PrivateJwt
+		}
+		cfg.Keys = *keys
+	}
+
+	if secretsStore != nil {
+		secrets, err := cfg.secrets()
+		if err != nil {
+			return nil, err
+		} else if !maps.Equal(storedSecrets, secrets) { // first run (or new, or explicitly set, secrets)
+			if err := secretsStore.Save(secrets); err != nil {
+				return nil, fmt.Errorf("failed to save secrets: %w", err)
+			}
+		}
+	}
+
+	return cfg, nil
 }
@@ -0,0 +1,79 @@
+package supago
+
+import (
+	"fmt"
+	"github.com/train360-corp/supago/internal/settings"
+	"os"
+)
+
+// EnvPrefix prefixes the environment variables overriding Config fields (e.g., SUPAGO_KONG_URLS_SITE for Kong.URLs.Site)
+const EnvPrefix = "SUPAGO_"
+
+// derivedSettings Config fields that cannot be set from files or the environment (they are derived, or hold code)
+var derivedSettings = []string{
+	"keys.signing_key",
+	"keys.jwks",
+	"keys.retiring",
+	"database.credentials_store",
+	"global.secrets_store",
+}
+
+// LoadConfig builds a Config from a config file (YAML, TOML or JSON, by extension; skipped if path is empty) and the
+// environment (SUPAGO_*, taking precedence over the file); see ConfigBuilder.FromFile and ConfigBuilder.FromEnv
+func LoadConfig(path string) (*Config, error) {
+	b := ConfigBuilder()
+	if path != "" {
+		b.FromFile(path)
+	}
+	return b.FromEnv().BuildE()
+}
+
+// FromFile override settings with those of a config file (YAML, TOML or JSON, by extension)
+// Every Config field can be set, named in snake_case and nested by section (e.g., global.platform_name, kong.urls.site
+// or database.archive.s3.bucket); durations are strings (e.g., "5m"). Files take precedence over the builder's other
+// methods, and later files over earlier ones.
+func (b *configBuilder) FromFile(path string) *configBuilder {
+	b.files = append(b.files, path)
+	return b
+}
+
+// FromEnv override settings with environment variables (taking precedence over files)
+// A variable is named EnvPrefix followed by the field's path in upper case (e.g., SUPAGO_DATABASE_PASSWORD or
+// SUPAGO_KONG_URLS_SITE). Lists of strings are comma-separated; other lists and maps are JSON (e.g.,
+// SUPAGO_DATABASE_SETTINGS='{"max_connections": "200"}').
+func (b *configBuilder) FromEnv() *configBuilder {
+	b.env = true
+	return b
+}
+
+// applyOverrides applies the config files, then the environment, to cfg; returning the paths of the fields set
+func (b *configBuilder) applyOverrides(cfg *Config) (map[string]bool, error) {
+	set := map[string]bool{}
+	for _, path := range b.files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		values, err := settings.Decode(path, data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config file \"%s\": %w", path, err)
+		}
+		paths, err := settings.Apply(cfg, values, derivedSettings...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config file \"%s\": %w", path, err)
+		}
+		for _, p := range paths {
+			set[p] = true
+		}
+	}
+	if b.env {
+		paths, err := settings.Env(cfg, EnvPrefix, os.LookupEnv, derivedSettings...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid environment: %w", err)
+		}
+		for _, p := range paths {
+			set[p] = true
+		}
+	}
+	return set, nil
+}
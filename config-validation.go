@@ -0,0 +1,172 @@
+package supago
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// smtpLookupTimeout how long resolving the SMTP host may take
+const smtpLookupTimeout = 5 * time.Second
+
+// Validate checks the config's constraints (reporting every violation): URLs parse, ports are non-zero, data
+// directories are writable (or can be created), the SMTP host resolves, and the database settings are valid
+// BuildE validates the configs it builds; call it again after changing a config's fields.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(section string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", section, err))
+		}
+	}
+
+	check("site URL", validateURL(c.Kong.URLs.Site))
+	check("Kong URL", validateURL(c.Kong.URLs.Kong))
+	check("SMTP config", c.Kong.SMTP.validate())
+	if c.Global.Subnet != "" {
+		if _, _, err := net.ParseCIDR(c.Global.Subnet); err != nil {
+			check("subnet", fmt.Errorf("expected a CIDR (e.g., \"172.30.0.0/16\"), got \"%s\"", c.Global.Subnet))
+		}
+	}
+	if c.Dashboard.Username == "" || c.Dashboard.Password == "" {
+		check("dashboard credentials", errors.New("username and password must be set"))
+	}
+
+	// the encryption key and credentials are kept next to the database's data directory
+	check("database data directory", validateDirectory(c.Database.DataDirectory, false))
+	if c.Database.DataDirectory != "" {
+		check("database data directory", validateDirectory(filepath.Dir(c.Database.DataDirectory), true))
+	}
+	check("storage data directory", validateDirectory(c.Storage.DataDirectory, false))
+	if overlapping(c.Database.DataDirectory, c.Storage.DataDirectory) {
+		check("storage data directory", fmt.Errorf("\"%s\" overlaps the database data directory", c.Storage.DataDirectory))
+	}
+
+	check("rest config", c.Rest.validate())
+	check("auth config", c.Auth.validate(c.Kong))
+	check("postgres config", c.Database.validatePostgresConfig())
+	check("extensions", c.Database.validateExtensions())
+	if c.Database.Archive != nil {
+		if err := c.Database.Archive.validate(); err != nil {
+			check("archive config", err)
+		} else if err := validateDirectory(c.Database.Archive.Directory, false); err != nil {
+			check("archive config", err)
+		} else if overlapping(c.Database.DataDirectory, c.Database.Archive.Directory) {
+			check("archive config", fmt.Errorf("\"%s\" overlaps the database data directory", c.Database.Archive.Directory))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate checks the SMTP server is addressable from the auth container
+// Hosts without a dot are taken to be containers on the platform's network, which only resolve from within it.
+func (s KongSMTPConfig) validate() error {
+	host := strings.TrimSuffix(s.Host, ".")
+	if host == "" {
+		return errors.New("no host")
+	} else if s.Port == 0 {
+		return errors.New("port must be non-zero")
+	} else if _, err := mail.ParseAddress(s.From.Email); err != nil {
+		return fmt.Errorf("invalid sender email \"%s\": %w", s.From.Email, err)
+	} else if host == "localhost" {
+		return errors.New("host \"localhost\" is the auth container itself (use host.docker.internal to reach the host)")
+	} else if net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), smtpLookupTimeout)
+	defer cancel()
+	if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+		return fmt.Errorf("host \"%s\" does not resolve: %w", host, err)
+	}
+	return nil
+}
+
+// validateURL checks rawURL is an absolute http(s) URL
+func validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("expected an http(s) URL, got \"%s\"", rawURL)
+	} else if u.Hostname() == "" {
+		return fmt.Errorf("\"%s\" has no host", rawURL)
+	}
+	return nil
+}
+
+// validateDirectory checks dir is an absolute path to a directory or, if it does not exist yet, that it can be created
+// (its nearest existing parent is a writable directory); an existing dir must be writable too if writable is set
+// (data directories themselves are written from containers, and may belong to their users)
+func validateDirectory(dir string, writable bool) error {
+	if dir == "" {
+		return errors.New("no directory")
+	} else if !filepath.IsAbs(dir) {
+		return fmt.Errorf("\"%s\" is not an absolute path", dir)
+	}
+	path := filepath.Clean(dir)
+	for {
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) && filepath.Dir(path) != path {
+			path = filepath.Dir(path)
+			continue
+		} else if err != nil {
+			return err
+		} else if !info.IsDir() {
+			return fmt.Errorf("\"%s\" is not a directory", path)
+		} else if path == filepath.Clean(dir) && !writable {
+			return nil
+		}
+		break
+	}
+	f, err := os.CreateTemp(path, ".supago-*")
+	if err != nil {
+		if path != filepath.Clean(dir) {
+			return fmt.Errorf("\"%s\" cannot be created: \"%s\" is not writable", dir, path)
+		}
+		return fmt.Errorf("\"%s\" is not writable", dir)
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+	return nil
+}
+
+// overlapping whether a and b are the same directory, or one contains the other
+func overlapping(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	inside := func(dir, parent string) bool {
+		rel, err := filepath.Rel(parent, dir)
+		return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+	}
+	return inside(a, b) || inside(b, a)
+}
+
+// resolveDirectories makes relative data directories absolute (relative to the working directory), as bind mounts
+// require
+func (c *Config) resolveDirectories() error {
+	dirs := []*string{&c.Database.DataDirectory, &c.Storage.DataDirectory}
+	if c.Database.Archive != nil {
+		dirs = append(dirs, &c.Database.Archive.Directory)
+	}
+	for _, dir := range dirs {
+		if *dir == "" || filepath.IsAbs(*dir) {
+			continue
+		}
+		abs, err := filepath.Abs(*dir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve \"%s\": %w", *dir, err)
+		}
+		*dir = abs
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package supago
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/train360-corp/supago/internal/services/kong"
@@ -15,6 +18,29 @@ type KeysConfig struct {
 	PublicJwt          string
 	PrivateJwt         string
 	PgSodiumEncryption string
+	// SigningKey (optional) asymmetric key used to sign JWTs instead of JwtSecret
+	SigningKey *SigningKey
+	// JWKS public key set (JSON) third-parties can verify JWTs against; never contains shared secrets
+	JWKS string
+	// Retiring keys replaced by a rotation, which are still accepted until retired
+	Retiring *RetiringKeysConfig
+	// keyIDs whether minted JWTs carry a "kid" header (and services verify them against a key set)
+	keyIDs bool
+	// rotated whether the keys were switched to by a rotation (and are persisted, taking precedence over the
+	// builder's; see RotateKeys)
+	rotated bool
+	// signingJWKs private key array (JSON) handed to GoTrue; the first key signs
+	signingJWKs string
+	// verificationJWKS key set (JSON), including shared secrets, services verify JWTs against
+	verificationJWKS string
+}
+
+// RetiringKeysConfig the keys a rotation replaced, kept valid during the overlap window
+type RetiringKeysConfig struct {
+	JwtSecret  string
+	SigningKey *SigningKey
+	PublicJwt  string
+	PrivateJwt string
 }
 
 type StorageConfig struct {
@@ -28,7 +54,68 @@ type DashboardConfig struct {
 
 type DatabaseConfig struct {
 	DataDirectory string
-	Password      string
+	// Password of the supabase_admin superuser
+	Password string
+	// RolePasswords passwords of the other database roles (by role name); roles without one use Password
+	// Each service only receives the password of the role it connects as, but Analytics, Meta and Realtime can't run
+	// without superuser rights: they connect as supabase_admin, with Password.
+	RolePasswords map[string]string
+	// CredentialsStore (optional) persists the passwords across restarts and rotations
+	CredentialsStore DatabaseCredentialsStore
+	// Settings postgres configuration parameters, e.g., {"max_connections": "200", "log_statement": "ddl"}
+	// They take precedence over ConfigFile, which takes precedence over Memory.
+	Settings map[string]string
+	// ConfigFile (optional) additional postgresql.conf contents (e.g., those of a postgresql.custom.conf)
+	ConfigFile []byte
+	// Memory (optional) bytes of memory dedicated to the database; sizes shared_buffers, work_mem, max_connections, etc.
+	Memory int64
+	// Extensions the database is kept provisioned with (created, moved and updated after every start)
+	Extensions []Extension
+	// Archive (optional) continuous WAL archiving and base backups, for point-in-time recovery (see SupaGo.RecoverTo)
+	Archive *ArchiveConfig
+}
+
+// databaseRoles the roles whose passwords SupaGo manages (the superuser, supabase_admin, first)
+var databaseRoles = []string{
+	"supabase_admin",
+	"anon",
+	"authenticated",
+	"authenticator",
+	"dashboard_user",
+	"pgbouncer",
+	"postgres",
+	"service_role",
+	"supabase_auth_admin",
+	"supabase_functions_admin",
+	"supabase_read_only_user",
+	"supabase_replication_admin",
+	"supabase_storage_admin",
+}
+
+// RolePassword the password of a database role
+func (d DatabaseConfig) RolePassword(role string) string {
+	if role == "supabase_admin" {
+		return d.Password
+	} else if password, ok := d.RolePasswords[role]; ok && password != "" {
+		return password
+	}
+	return d.Password
+}
+
+// scopedTo a copy of the config holding only the credentials of roles (none when roles is empty)
+func (d DatabaseConfig) scopedTo(roles ...string) DatabaseConfig {
+	scoped := DatabaseConfig{
+		DataDirectory: d.DataDirectory,
+		RolePasswords: map[string]string{},
+	}
+	for _, role := range roles {
+		if role == "supabase_admin" {
+			scoped.Password = d.Password
+		} else {
+			scoped.RolePasswords[role] = d.RolePassword(role)
+		}
+	}
+	return scoped
 }
 
 type LogFlareConfig struct {
@@ -57,11 +144,26 @@ type KongURLsConfig struct {
 type KongConfig struct {
 	URLs KongURLsConfig
 	SMTP KongSMTPConfig
+	// HostPort the (127.0.0.1) host port Kong is published on (defaults to 8000)
+	HostPort uint16
+}
+
+// hostPort the host port Kong is published on
+func (k KongConfig) hostPort() uint16 {
+	if k.HostPort == 0 {
+		return 8000
+	}
+	return k.HostPort
 }
 
 type GlobalConfig struct {
 	PlatformName string
 	DebugMode    bool
+	// Subnet of the platform's docker network (docker-assigned if empty)
+	Subnet string
+	// SecretsStore (optional) persists the generated secrets (JWT secret, dashboard credentials, LogFlare keys and
+	// auth hooks secret) across restarts and processes
+	SecretsStore SecretsStore
 }
 
 type Config struct {
@@ -72,12 +174,48 @@ type Config struct {
 	LogFlare  LogFlareConfig
 	Keys      KeysConfig
 	Kong      KongConfig
+	Rest      RestConfig
+	Auth      AuthConfig
+}
+
+// randomRolePasswords independently generated passwords for every managed role (except the superuser)
+func randomRolePasswords() map[string]string {
+	passwords := map[string]string{}
+	for _, role := range databaseRoles[1:] {
+		passwords[role] = utils.RandomString(32)
+	}
+	return passwords
+}
+
+// verifier the value services accepting either a shared secret or a JWKS (e.g., PostgREST) verify JWTs with
+func (k KeysConfig) verifier() string {
+	if k.verificationJWKS != "" {
+		return k.verificationJWKS
+	}
+	return k.JwtSecret
+}
+
+// legacySecret the secret JWTs without a "kid" header are verified with
+// During a rotation away from a shared secret, this remains the retiring secret until it is retired
+func (k KeysConfig) legacySecret() string {
+	if k.Retiring != nil && k.Retiring.SigningKey == nil && k.Retiring.JwtSecret != "" {
+		return k.Retiring.JwtSecret
+	}
+	return k.JwtSecret
+}
+
+// derivedSecret a secret for purpose, derived from the JWT secret (so it is stable across rebuilds of a service, and
+// changes with the keys)
+func (k KeysConfig) derivedSecret(purpose string) string {
+	mac := hmac.New(sha256.New, []byte(k.JwtSecret))
+	mac.Write([]byte(purpose))
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
 func newBaseConfig(platformName string) (*Config, error) {
 	jwtSecret := utils.RandomString(32)
 
-	keys, err := getJwtKeysConfig(jwtSecret)
+	keys, err := getJwtKeysConfig(jwtSecret, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to construct jwt keys config: %v", err)
 	}
@@ -96,6 +234,7 @@ func newBaseConfig(platformName string) (*Config, error) {
 		Database: DatabaseConfig{
 			DataDirectory: filepath.Join(wd, "postgres", "data"),
 			Password:      utils.RandomString(32),
+			RolePasswords: randomRolePasswords(),
 		},
 		Storage: StorageConfig{
 			DataDirectory: filepath.Join(wd, "storage", "data"),
@@ -128,7 +267,21 @@ func newBaseConfig(platformName string) (*Config, error) {
 }
 
 // getJwtKeysConfig returns deterministic JWTs (as a KeysConfig) pre-configured for Supabase, based on a fixed secret
-func getJwtKeysConfig(jwtSecret string) (*KeysConfig, error) {
+// When signingKey is non-nil, the JWTs are signed with it (and its JWKS published) instead of the secret
+func getJwtKeysConfig(jwtSecret string, signingKey *SigningKey) (*KeysConfig, error) {
+	keys := &KeysConfig{
+		JwtSecret:  jwtSecret,
+		SigningKey: signingKey,
+		keyIDs:     signingKey != nil,
+	}
+	if err := keys.mint(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// mint (re-)signs the anon and service JWTs with the current key, and derives the key sets services verify against
+func (k *KeysConfig) mint() error {
 
 	// Fixed issued-at: 01 Jan 2025 00:00:00 UTC
 	issuedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
@@ -136,14 +289,22 @@ func getJwtKeysConfig(jwtSecret string) (*KeysConfig, error) {
 	// Expiration: 20 years later
 	expiresAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(20, 0, 0).Unix()
 
+	method, key, kid, err := k.signer()
+	if err != nil {
+		return err
+	}
+
 	makeToken := func(role string) (*string, error) {
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		token := jwt.NewWithClaims(method, jwt.MapClaims{
 			"role": role,
 			"iss":  "supabase",
 			"iat":  issuedAt,
 			"exp":  expiresAt,
 		})
-		signed, err := token.SignedString([]byte(jwtSecret))
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
 		if err != nil {
 			return nil, fmt.Errorf("failed to sign %s JWT: %v", role, err)
 		}
@@ -152,16 +313,14 @@ func getJwtKeysConfig(jwtSecret string) (*KeysConfig, error) {
 
 	anonKey, err := makeToken("anon")
 	if err != nil {
-		return nil, err
+		return err
 	}
 	serviceKey, err := makeToken("service_role")
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &KeysConfig{
-		JwtSecret:  jwtSecret,
-		PublicJwt:  *anonKey,
-		PrivateJwt: *serviceKey,
-	}, nil
+	k.PublicJwt = *anonKey
+	k.PrivateJwt = *serviceKey
+	return k.deriveJWKS()
 }
@@ -0,0 +1,109 @@
+package supago
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DatabaseCredentialsStore persists database role passwords (by role name) across restarts and rotations
+type DatabaseCredentialsStore interface {
+	// Load returns the stored passwords (nil, without error, when none have been stored yet)
+	Load() (map[string]string, error)
+	// Save replaces the stored passwords
+	Save(passwords map[string]string) error
+}
+
+type databaseCredentialsFile string
+
+// DatabaseCredentialsFromConfig store database credentials next to the database's own data directory
+func DatabaseCredentialsFromConfig(config Config) DatabaseCredentialsStore {
+	// save the file one level up from the database's own data directory
+	return DatabaseCredentialsFile(filepath.Join(filepath.Dir(config.Database.DataDirectory), "db_credentials.json"))
+}
+
+// DatabaseCredentialsFile store database credentials as JSON in a file (at `path`, created with 0600 permissions)
+func DatabaseCredentialsFile(path string) DatabaseCredentialsStore {
+	return databaseCredentialsFile(path)
+}
+
+func (f databaseCredentialsFile) Load() (map[string]string, error) {
+	path := string(f)
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error statting credentials file %q: %w", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("credentials file %q exists but is not a regular file", path)
+	}
+
+	// Enforce strict permissions: owner rw only (0600). Reject if group/others have bits.
+	if info.Mode().Perm()&0o177 != 0 {
+		return nil, fmt.Errorf("insecure permissions on %q: got %o, want 0600", path, info.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading credentials file %q: %w", path, err)
+	}
+	passwords := map[string]string{}
+	if err := json.Unmarshal(data, &passwords); err != nil {
+		return nil, fmt.Errorf("invalid credentials file %q: %w", path, err)
+	}
+	return passwords, nil
+}
+
+func (f databaseCredentialsFile) Save(passwords map[string]string) error {
+	path := string(f)
+	data, err := json.MarshalIndent(passwords, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode credentials: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create credentials file directory: %w", err)
+	}
+
+	// write-then-rename, so a crash never leaves a partially written file behind
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write credentials file %q: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to replace credentials file %q: %w", path, err)
+	}
+	return nil
+}
+
+// passwords all managed role passwords (including the superuser's), by role name
+func (d DatabaseConfig) passwords() map[string]string {
+	passwords := map[string]string{}
+	for _, role := range databaseRoles {
+		passwords[role] = d.RolePassword(role)
+	}
+	return passwords
+}
+
+// withPasswords a copy of the config using passwords (roles missing from passwords keep their current password)
+func (d DatabaseConfig) withPasswords(passwords map[string]string) DatabaseConfig {
+	rolePasswords := map[string]string{}
+	for role, password := range d.RolePasswords {
+		rolePasswords[role] = password
+	}
+	for role, password := range passwords {
+		if password == "" {
+			continue
+		} else if role == "supabase_admin" {
+			d.Password = password
+		} else {
+			rolePasswords[role] = password
+		}
+	}
+	d.RolePasswords = rolePasswords
+	return d
+}
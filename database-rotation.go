@@ -0,0 +1,64 @@
+package supago
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/train360-corp/supago/internal/utils"
+	"maps"
+)
+
+// RotateDatabasePasswords generates new passwords for every managed database role and applies them
+// The roles are altered over the trusted local connection inside the database container (so the current
+// passwords need not be known), the new passwords are persisted (see DatabaseConfig.CredentialsStore),
+// and only the services embedding database credentials are recreated.
+func (sg *SupaGo) RotateDatabasePasswords(ctx context.Context) error {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	db := sg.databaseService()
+	if db == nil || db.container == nil {
+		return errors.New("database is not running")
+	}
+
+	passwords := randomRolePasswords()
+	passwords["supabase_admin"] = utils.RandomString(32)
+	previous := sg.config.Database
+	next := previous.withPasswords(passwords)
+
+	// persist first: if anything below fails, the previous passwords are restored
+	if next.CredentialsStore != nil {
+		if err := next.CredentialsStore.Save(next.passwords()); err != nil {
+			return fmt.Errorf("failed to save database credentials: %w", err)
+		}
+	}
+
+	sg.logger.Infof("rotating database passwords")
+	if err := sg.alterRolePasswords(ctx, next); err != nil {
+		if previous.CredentialsStore != nil {
+			if restoreErr := previous.CredentialsStore.Save(previous.passwords()); restoreErr != nil {
+				sg.logger.Errorf("failed to restore previous database credentials: %v", restoreErr)
+			}
+		}
+		return err
+	}
+
+	// recreate the services whose definition embeds a changed credential (the database itself keeps running)
+	sg.config.Database = next
+	return sg.recreate(ctx, func(service *Service) bool {
+		if service == db || service.constructor == nil {
+			return false
+		}
+		rebuilt, err := service.constructor(sg.config)
+		return err != nil || !maps.Equal(rebuilt.Env, service.Env) // recreating reports the error
+	})
+}
+
+// alterRolePasswords sets the passwords of database over the trusted local connection
+// The caller must hold sg.mu
+func (sg *SupaGo) alterRolePasswords(ctx context.Context, database DatabaseConfig) error {
+	if _, err := sg.psql(ctx, "supabase_admin", "postgres", "-c", alterRolePasswordsSQL(database)); err != nil {
+		return fmt.Errorf("failed to alter database role passwords: %w", err)
+	}
+	return nil
+}
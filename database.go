@@ -0,0 +1,91 @@
+package supago
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/client"
+	"github.com/train360-corp/supago/internal/utils"
+	"path"
+	"strings"
+)
+
+// Database a handle to run SQL against the stack's database (through psql inside the database container)
+// A handle is bound to the database container it was created for; get a new one if the database is recreated.
+type Database struct {
+	docker *client.Client
+	cid    string
+	user   string
+	name   string
+}
+
+// Database a handle to the "postgres" database, connected as the postgres role
+func (sg *SupaGo) Database() (*Database, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+	return sg.database("postgres", "postgres")
+}
+
+// database a handle to the dbname database, connected as user
+// The caller must hold sg.mu
+func (sg *SupaGo) database(user, dbname string) (*Database, error) {
+	db := sg.databaseService()
+	if db == nil || db.container == nil || sg.docker == nil {
+		return nil, errors.New("database is not running")
+	}
+	return &Database{docker: sg.docker, cid: db.container.ID, user: user, name: dbname}, nil
+}
+
+// As a handle to the same database, connected as another role
+func (d *Database) As(user string) *Database {
+	return &Database{docker: d.docker, cid: d.cid, user: user, name: d.name}
+}
+
+// Name the name of the database the handle is connected to
+func (d *Database) Name() string {
+	return d.name
+}
+
+// Exec runs one or more SQL statements (in a single transaction)
+func (d *Database) Exec(ctx context.Context, sql string) error {
+	_, err := execPsql(ctx, d.docker, d.cid, d.user, d.name, "--single-transaction", "-c", sql)
+	return err
+}
+
+// ExecFile runs a SQL script (in a single transaction)
+func (d *Database) ExecFile(ctx context.Context, name string, data []byte) error {
+	file := path.Join("/tmp/supago/sql", path.Base(name))
+	if err := utils.CopyToContainer(ctx, d.docker, d.cid, EmbeddedFile{Data: data, Path: file}); err != nil {
+		return fmt.Errorf("failed to copy %s into container: %w", name, err)
+	}
+	defer func() {
+		_, _ = utils.ExecInContainer(context.Background(), d.docker, d.cid, []string{"rm", "-f", file})
+	}()
+	_, err := execPsql(ctx, d.docker, d.cid, d.user, d.name, "--single-transaction", "-f", file)
+	return err
+}
+
+// Query runs a single SQL query, returning its rows with every column as text (NULL as an empty string)
+func (d *Database) Query(ctx context.Context, sql string) ([][]string, error) {
+	output, err := execPsql(ctx, d.docker, d.cid, d.user, d.name, "--csv", "-t", "-c", sql)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := csv.NewReader(strings.NewReader(output)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query output: %w", err)
+	}
+	return rows, nil
+}
+
+// QueryValue runs a SQL query returning a single value (e.g., "SELECT count(*) FROM ..."); empty if no rows
+func (d *Database) QueryValue(ctx context.Context, sql string) (string, error) {
+	rows, err := d.Query(ctx, sql)
+	if err != nil {
+		return "", err
+	} else if len(rows) == 0 || len(rows[0]) == 0 {
+		return "", nil
+	}
+	return rows[0][0], nil
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -14,6 +15,9 @@ func createEncryptionKeyFile(path string) error {
 	if _, err := rand.Read(b); err != nil {
 		return fmt.Errorf("key file \"%s\" does not exist and an error occurred while trying to create it: %v", path, err)
 	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("key file \"%s\" does not exist and an error occurred while trying to create it: %v", path, err)
+	}
 	if err := os.WriteFile(path, []byte(hex.EncodeToString(b)), 0o600); err != nil {
 		return fmt.Errorf("key file \"%s\" does not exist and an error occurred while trying to create it: %v", path, err)
 	}
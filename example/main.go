@@ -25,17 +25,23 @@ func main() {
 	logger.Infof("SupaGo starting")
 
 	// build a config
-	cfg := supago.ConfigBuilder().
+	cfg, err := supago.ConfigBuilder().
 		Platform("example-project").
 		GetEncryptionKeyUsing(encryptionKey).
-		Build()
+		BuildE()
+	if err != nil {
+		logger.Fatalf("invalid config: %v", err)
+	}
 
 	// create a new SupaGo instance
 	// this example uses all (supported) services; alternatively, add individual services as needed; e.g.:
 	// AddService(supago.Services.Postgres, supago.Services.Kong)
-	sg := supago.New(cfg).
+	sg, err := supago.New(cfg).
 		SetLogger(logger).
 		AddServices(supago.Services.All)
+	if err != nil {
+		logger.Fatalf("failed to add services: %v", err)
+	}
 
 	// run services
 	if err := sg.RunForcefully(ctx); err != nil {
@@ -0,0 +1,154 @@
+package supago
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/train360-corp/supago/internal/extensions"
+	"github.com/train360-corp/supago/internal/utils"
+	"strings"
+	"time"
+)
+
+// Extension a Postgres extension the database is kept provisioned with (see DatabaseConfig.Extensions)
+type Extension struct {
+	Name string
+	// Schema (optional) where the extension is created; defaults to the schema the extension requires (e.g., graphql
+	// for pg_graphql) when it has one, and to "extensions" otherwise
+	Schema string
+	// Version (optional) pins the extension version (updating it if installed); defaults to the image's default
+	Version string
+}
+
+func toExtensions(list []Extension) []extensions.Extension {
+	converted := make([]extensions.Extension, len(list))
+	for i, extension := range list {
+		converted[i] = extensions.Extension{Name: extension.Name, Schema: extension.Schema, Version: extension.Version}
+	}
+	return converted
+}
+
+// validateExtensions checks the extensions can be provisioned (as far as is known before the database is running)
+func (d DatabaseConfig) validateExtensions() error {
+	seen := map[string]bool{}
+	for _, extension := range d.Extensions {
+		if extension.Name == "" {
+			return errors.New("extension has no name")
+		} else if seen[extension.Name] {
+			return fmt.Errorf("extension %q is listed more than once", extension.Name)
+		}
+		seen[extension.Name] = true
+	}
+	if libraries, ok := d.Settings["shared_preload_libraries"]; ok {
+		if missing := extensions.MissingLibraries(libraries, toExtensions(d.Extensions)); len(missing) > 0 {
+			return fmt.Errorf("shared_preload_libraries setting is missing %s (required by the extensions)", strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
+
+// provisionExtensions creates (or moves, or updates) database's extensions in the database running in container cid
+// Libraries the extensions need preloaded are added to shared_preload_libraries (ALTER SYSTEM), restarting the
+// database once, unless the setting is explicit (DatabaseConfig.Settings or ConfigFile): then, any value set by an
+// earlier ALTER SYSTEM (which would override it) is reset instead.
+func provisionExtensions(ctx context.Context, docker *client.Client, cid string, database DatabaseConfig) error {
+	if len(database.Extensions) == 0 {
+		return nil
+	}
+	desired := toExtensions(database.Extensions)
+	query := func(sql string) ([][]string, error) {
+		output, err := execPsql(ctx, docker, cid, "supabase_admin", "postgres", "--csv", "-t", "-c", sql)
+		if err != nil {
+			return nil, err
+		}
+		return csv.NewReader(strings.NewReader(output)).ReadAll()
+	}
+
+	// preload libraries
+	rows, err := query("SELECT setting, coalesce(sourcefile, '') FROM pg_settings WHERE name = 'shared_preload_libraries';")
+	if err != nil || len(rows) == 0 {
+		return fmt.Errorf("failed to get shared_preload_libraries: %w", err)
+	}
+	if database.explicitPreloadLibraries() {
+		if strings.HasSuffix(rows[0][1], "postgresql.auto.conf") {
+			if _, err := execPsql(ctx, docker, cid, "supabase_admin", "postgres",
+				"-c", "ALTER SYSTEM RESET shared_preload_libraries;",
+			); err != nil {
+				return fmt.Errorf("failed to reset shared_preload_libraries: %w", err)
+			}
+			if err := restartDatabase(ctx, docker, cid); err != nil {
+				return fmt.Errorf("failed to restart database to apply shared_preload_libraries: %w", err)
+			}
+		}
+	} else if missing := extensions.MissingLibraries(rows[0][0], desired); len(missing) > 0 {
+		libraries := extensions.AppendLibraries(rows[0][0], missing)
+		if _, err := execPsql(ctx, docker, cid, "supabase_admin", "postgres",
+			"-c", "ALTER SYSTEM SET shared_preload_libraries = "+utils.QuoteLiteral(libraries)+";",
+		); err != nil {
+			return fmt.Errorf("failed to set shared_preload_libraries: %w", err)
+		}
+		if err := restartDatabase(ctx, docker, cid); err != nil {
+			return fmt.Errorf("failed to restart database to preload %s: %w", strings.Join(missing, ", "), err)
+		}
+	}
+
+	// current state
+	names := make([]string, len(desired))
+	for i, extension := range desired {
+		names[i] = utils.QuoteLiteral(extension.Name)
+	}
+	available := map[string]extensions.Available{}
+	if rows, err := query(fmt.Sprintf(
+		"SELECT v.name, v.version, coalesce(v.schema::text, ''), v.relocatable FROM pg_available_extension_versions v "+
+			"JOIN pg_available_extensions a ON a.name = v.name AND a.default_version = v.version WHERE v.name IN (%s);",
+		strings.Join(names, ", "),
+	)); err != nil {
+		return fmt.Errorf("failed to list available extensions: %w", err)
+	} else {
+		for _, row := range rows {
+			available[row[0]] = extensions.Available{DefaultVersion: row[1], Schema: row[2], Relocatable: row[3] == "t"}
+		}
+	}
+	installed := map[string]extensions.Installed{}
+	if rows, err := query("SELECT extname, extnamespace::regnamespace::text, extversion FROM pg_extension;"); err != nil {
+		return fmt.Errorf("failed to list installed extensions: %w", err)
+	} else {
+		for _, row := range rows {
+			installed[row[0]] = extensions.Installed{Schema: strings.Trim(row[1], `"`), Version: row[2]}
+		}
+	}
+
+	sql, err := extensions.Plan(desired, available, installed)
+	if err != nil {
+		return err
+	} else if sql == "" {
+		return nil
+	}
+	if _, err := execPsql(ctx, docker, cid, "supabase_admin", "postgres", "--single-transaction", "-c", sql); err != nil {
+		return fmt.Errorf("failed to provision extensions: %w", err)
+	}
+	return nil
+}
+
+// restartDatabase restarts the database container cid, waiting for it to accept connections again
+func restartDatabase(ctx context.Context, docker *client.Client, cid string) error {
+	if err := docker.ContainerRestart(ctx, cid, container.StopOptions{Timeout: utils.Pointer(10)}); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(2 * time.Minute)
+	for {
+		if _, err := utils.ExecInContainer(ctx, docker, cid, []string{"pg_isready", "-U", "postgres", "-h", "localhost"}); err == nil {
+			return nil
+		} else if time.Now().After(deadline) {
+			return fmt.Errorf("database not ready after restart: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
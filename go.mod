@@ -3,10 +3,12 @@ module github.com/train360-corp/supago
 go 1.23.3
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/docker/docker v28.3.3+incompatible
 	github.com/docker/go-connections v0.6.0
 	github.com/golang-jwt/jwt/v5 v5.3.0
 	go.uber.org/zap v1.27.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
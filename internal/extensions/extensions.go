@@ -0,0 +1,118 @@
+package extensions
+
+import (
+	"fmt"
+	"github.com/train360-corp/supago/internal/utils"
+	"slices"
+	"strings"
+)
+
+// DefaultSchema where relocatable extensions are created (as on Supabase's hosted platform)
+const DefaultSchema = "extensions"
+
+// Extension a desired extension
+type Extension struct {
+	Name    string
+	Schema  string // empty for the extension's own schema if it has one, DefaultSchema otherwise
+	Version string // empty for the default version (and no updates)
+}
+
+// Available an extension as the database can install it (from pg_available_extension_versions)
+type Available struct {
+	DefaultVersion string
+	Schema         string // the schema the extension must be installed in ("" if not fixed)
+	Relocatable    bool
+}
+
+// Installed an extension as installed in the database (from pg_extension)
+type Installed struct {
+	Schema  string
+	Version string
+}
+
+// Libraries the shared libraries extensions must be preloaded with (shared_preload_libraries) to be created
+var Libraries = map[string]string{
+	"pg_cron":            "pg_cron",
+	"pg_net":             "pg_net",
+	"pg_squeeze":         "pg_squeeze",
+	"pg_stat_statements": "pg_stat_statements",
+	"pg_tle":             "pg_tle",
+	"pgaudit":            "pgaudit",
+	"pgsodium":           "pgsodium",
+	"timescaledb":        "timescaledb",
+}
+
+// MissingLibraries the libraries extensions need that are not in current (a shared_preload_libraries value)
+func MissingLibraries(current string, extensions []Extension) []string {
+	loaded := map[string]bool{}
+	for _, library := range strings.Split(current, ",") {
+		loaded[strings.Trim(strings.TrimSpace(library), `"`)] = true
+	}
+	var missing []string
+	for _, extension := range extensions {
+		if library, ok := Libraries[extension.Name]; ok && !loaded[library] && !slices.Contains(missing, library) {
+			missing = append(missing, library)
+		}
+	}
+	return missing
+}
+
+// AppendLibraries a shared_preload_libraries value with libraries appended to current
+func AppendLibraries(current string, libraries []string) string {
+	if strings.TrimSpace(current) == "" {
+		return strings.Join(libraries, ", ")
+	}
+	return strings.TrimSpace(current) + ", " + strings.Join(libraries, ", ")
+}
+
+// Plan the SQL bringing installed in line with extensions (empty if nothing changes)
+// Extensions are created (with their dependencies), moved to their schema (when relocatable), and updated to their
+// version; extensions not listed are left untouched.
+func Plan(extensions []Extension, available map[string]Available, installed map[string]Installed) (string, error) {
+	var statements []string
+	for _, extension := range extensions {
+		candidate, ok := available[extension.Name]
+		if !ok {
+			return "", fmt.Errorf("extension %q is not available in the database image", extension.Name)
+		}
+
+		schema := extension.Schema
+		if candidate.Schema != "" {
+			if schema != "" && schema != candidate.Schema {
+				return "", fmt.Errorf("extension %q must be installed in schema %q (not %q)", extension.Name, candidate.Schema, schema)
+			}
+			schema = "" // implied
+		} else if schema == "" {
+			schema = DefaultSchema
+		}
+
+		name := utils.QuoteIdentifier(extension.Name)
+		current, ok := installed[extension.Name]
+		if !ok {
+			statement := "CREATE EXTENSION IF NOT EXISTS " + name
+			if schema != "" {
+				statements = append(statements, "CREATE SCHEMA IF NOT EXISTS "+utils.QuoteIdentifier(schema)+";")
+				statement += " WITH SCHEMA " + utils.QuoteIdentifier(schema)
+			}
+			if extension.Version != "" {
+				statement += " VERSION " + utils.QuoteLiteral(extension.Version)
+			}
+			statements = append(statements, statement+" CASCADE;")
+			continue
+		}
+
+		if schema != "" && current.Schema != schema {
+			if !candidate.Relocatable {
+				return "", fmt.Errorf("extension %q is installed in schema %q, and cannot be moved to %q", extension.Name, current.Schema, schema)
+			}
+			statements = append(statements,
+				"CREATE SCHEMA IF NOT EXISTS "+utils.QuoteIdentifier(schema)+";",
+				"ALTER EXTENSION "+name+" SET SCHEMA "+utils.QuoteIdentifier(schema)+";",
+			)
+		}
+		if extension.Version != "" && current.Version != extension.Version {
+			statements = append(statements, "ALTER EXTENSION "+name+" UPDATE TO "+utils.QuoteLiteral(extension.Version)+";")
+		}
+	}
+	return strings.Join(statements, "\n"), nil
+}
@@ -0,0 +1,74 @@
+package extensions
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMissingLibraries(t *testing.T) {
+	current := "pg_stat_statements, pgaudit, plpgsql, pg_cron, pg_net"
+	missing := MissingLibraries(current, []Extension{{Name: "pg_cron"}, {Name: "timescaledb"}, {Name: "vector"}, {Name: "timescaledb"}})
+	if strings.Join(missing, ",") != "timescaledb" {
+		t.Errorf("unexpected missing libraries: %v", missing)
+	}
+	if got := AppendLibraries(current, missing); got != current+", timescaledb" {
+		t.Errorf("unexpected libraries: %s", got)
+	}
+	if got := AppendLibraries("", missing); got != "timescaledb" {
+		t.Errorf("unexpected libraries: %s", got)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	available := map[string]Available{
+		"pg_cron":    {DefaultVersion: "1.6", Schema: "pg_catalog"},
+		"vector":     {DefaultVersion: "0.8.0", Relocatable: true},
+		"postgis":    {DefaultVersion: "3.3.7"},
+		"pg_graphql": {DefaultVersion: "1.5.11", Schema: "graphql"},
+	}
+	installed := map[string]Installed{
+		"pg_graphql": {Schema: "graphql", Version: "1.5.11"},
+		"vector":     {Schema: "public", Version: "0.7.0"},
+	}
+
+	sql, err := Plan([]Extension{
+		{Name: "pg_cron"},
+		{Name: "vector", Version: "0.8.0"},
+		{Name: "postgis", Schema: "gis"},
+		{Name: "pg_graphql"},
+	}, available, installed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := strings.Join([]string{
+		`CREATE EXTENSION IF NOT EXISTS "pg_cron" CASCADE;`,
+		`CREATE SCHEMA IF NOT EXISTS "extensions";`,
+		`ALTER EXTENSION "vector" SET SCHEMA "extensions";`,
+		`ALTER EXTENSION "vector" UPDATE TO '0.8.0';`,
+		`CREATE SCHEMA IF NOT EXISTS "gis";`,
+		`CREATE EXTENSION IF NOT EXISTS "postgis" WITH SCHEMA "gis" CASCADE;`,
+	}, "\n")
+	if sql != expect {
+		t.Errorf("expect:\n%s\ngot:\n%s", expect, sql)
+	}
+
+	// idempotent once applied
+	installed["pg_cron"] = Installed{Schema: "pg_catalog", Version: "1.6"}
+	installed["vector"] = Installed{Schema: "extensions", Version: "0.8.0"}
+	installed["postgis"] = Installed{Schema: "gis", Version: "3.3.7"}
+	if sql, err := Plan([]Extension{{Name: "pg_cron"}, {Name: "vector", Version: "0.8.0"}, {Name: "postgis", Schema: "gis"}}, available, installed); err != nil {
+		t.Fatal(err)
+	} else if sql != "" {
+		t.Errorf("expected no changes, got:\n%s", sql)
+	}
+
+	for _, extension := range []Extension{
+		{Name: "missing"},
+		{Name: "pg_cron", Schema: "cron"},
+		{Name: "postgis", Schema: "elsewhere"}, // installed, not relocatable
+	} {
+		if _, err := Plan([]Extension{extension}, available, installed); err == nil {
+			t.Errorf("expected error for %+v", extension)
+		}
+	}
+}
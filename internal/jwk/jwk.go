@@ -0,0 +1,202 @@
+package jwk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// Key is a JSON Web Key (RFC 7517) for an RSA or P-256 EC key
+type Key struct {
+	Kty    string   `json:"kty"`
+	Kid    string   `json:"kid,omitempty"`
+	Alg    string   `json:"alg,omitempty"`
+	Use    string   `json:"use,omitempty"`
+	KeyOps []string `json:"key_ops,omitempty"`
+
+	// RSA
+	N  string `json:"n,omitempty"`
+	E  string `json:"e,omitempty"`
+	D  string `json:"d,omitempty"`
+	P  string `json:"p,omitempty"`
+	Q  string `json:"q,omitempty"`
+	DP string `json:"dp,omitempty"`
+	DQ string `json:"dq,omitempty"`
+	QI string `json:"qi,omitempty"`
+
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+
+	// symmetric
+	K string `json:"k,omitempty"`
+}
+
+// Set is a JSON Web Key Set
+type Set struct {
+	Keys []Key `json:"keys"`
+}
+
+// Generate creates a new private key suitable for signing with alg
+func Generate(alg string) (crypto.Signer, error) {
+	switch alg {
+	case RS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case ES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+}
+
+// EncodePEM encodes a private key as a PKCS#8 PEM block
+func EncodePEM(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// DecodePEM decodes a PKCS#8 PEM block and checks it is usable with alg
+func DecodePEM(data []byte, alg string) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if alg != RS256 {
+			return nil, fmt.Errorf("RSA key cannot be used with %s", alg)
+		}
+		return key, nil
+	case *ecdsa.PrivateKey:
+		if alg != ES256 {
+			return nil, fmt.Errorf("EC key cannot be used with %s", alg)
+		} else if key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("EC key must use curve P-256, got %s", key.Curve.Params().Name)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+}
+
+// Public returns the public JWK of key
+func Public(key crypto.Signer, alg string) (Key, error) {
+	jwk := Key{Alg: alg, Use: "sig", KeyOps: []string{"verify"}}
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encode(pub.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = encode(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = encode(pub.Y.FillBytes(make([]byte, size)))
+	default:
+		return Key{}, fmt.Errorf("unsupported public key type %T", pub)
+	}
+	thumbprint, err := Thumbprint(jwk)
+	if err != nil {
+		return Key{}, err
+	}
+	jwk.Kid = thumbprint
+	return jwk, nil
+}
+
+// Private returns the private JWK of key (including the public parameters)
+func Private(key crypto.Signer, alg string) (Key, error) {
+	jwk, err := Public(key, alg)
+	if err != nil {
+		return Key{}, err
+	}
+	jwk.KeyOps = []string{"sign", "verify"}
+	switch priv := key.(type) {
+	case *rsa.PrivateKey:
+		priv.Precompute()
+		jwk.D = encode(priv.D.Bytes())
+		jwk.P = encode(priv.Primes[0].Bytes())
+		jwk.Q = encode(priv.Primes[1].Bytes())
+		jwk.DP = encode(priv.Precomputed.Dp.Bytes())
+		jwk.DQ = encode(priv.Precomputed.Dq.Bytes())
+		jwk.QI = encode(priv.Precomputed.Qinv.Bytes())
+	case *ecdsa.PrivateKey:
+		size := (priv.Curve.Params().BitSize + 7) / 8
+		jwk.D = encode(priv.D.FillBytes(make([]byte, size)))
+	default:
+		return Key{}, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return jwk, nil
+}
+
+// Symmetric returns the JWK of an HS256 shared secret
+func Symmetric(secret []byte, keyOps ...string) (Key, error) {
+	jwk := Key{Kty: "oct", Alg: HS256, KeyOps: keyOps, K: encode(secret)}
+	thumbprint, err := Thumbprint(jwk)
+	if err != nil {
+		return Key{}, err
+	}
+	jwk.Kid = thumbprint
+	return jwk, nil
+}
+
+// Thumbprint computes the RFC 7638 thumbprint of a public JWK
+func Thumbprint(key Key) (string, error) {
+	var members any
+	switch key.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{key.E, key.Kty, key.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{key.Crv, key.Kty, key.X, key.Y}
+	case "oct":
+		members = struct {
+			K   string `json:"k"`
+			Kty string `json:"kty"`
+		}{key.K, key.Kty}
+	default:
+		return "", fmt.Errorf("unsupported key type %q", key.Kty)
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal thumbprint members: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return encode(sum[:]), nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
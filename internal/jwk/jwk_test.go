@@ -0,0 +1,72 @@
+package jwk
+
+import "testing"
+
+func TestPEMRoundTrip(t *testing.T) {
+	for _, alg := range []string{RS256, ES256} {
+		key, err := Generate(alg)
+		if err != nil {
+			t.Fatalf("Generate(%s): %v", alg, err)
+		}
+		data, err := EncodePEM(key)
+		if err != nil {
+			t.Fatalf("EncodePEM(%s): %v", alg, err)
+		}
+		decoded, err := DecodePEM(data, alg)
+		if err != nil {
+			t.Fatalf("DecodePEM(%s): %v", alg, err)
+		}
+		want, _ := Public(key, alg)
+		got, _ := Public(decoded, alg)
+		if want.Kid != got.Kid {
+			t.Errorf("%s: expect kid %s, got %s", alg, want.Kid, got.Kid)
+		}
+	}
+}
+
+func TestDecodePEMWrongAlgorithm(t *testing.T) {
+	key, _ := Generate(ES256)
+	data, _ := EncodePEM(key)
+	if _, err := DecodePEM(data, RS256); err == nil {
+		t.Errorf("expected error decoding EC key as RS256")
+	}
+}
+
+func TestPublicOmitsPrivateParameters(t *testing.T) {
+	key, _ := Generate(RS256)
+	pub, err := Public(key, RS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub.D != "" || pub.P != "" || pub.Q != "" {
+		t.Errorf("public JWK leaked private parameters")
+	}
+	priv, _ := Private(key, RS256)
+	if priv.D == "" || priv.Kid != pub.Kid {
+		t.Errorf("private JWK missing parameters or kid mismatch")
+	}
+}
+
+func TestThumbprintRFC7638(t *testing.T) {
+	// example from RFC 7638, section 3.1
+	key := Key{
+		Kty: "RSA",
+		E:   "AQAB",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	}
+	got, err := Thumbprint(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != expect {
+		t.Errorf("expect: %s, got: %s", expect, got)
+	}
+}
+
+func TestSymmetricKeyID(t *testing.T) {
+	a, _ := Symmetric([]byte("secret-a"))
+	b, _ := Symmetric([]byte("secret-b"))
+	if a.Kid == "" || a.Kid == b.Kid {
+		t.Errorf("expected distinct, non-empty key ids; got %q and %q", a.Kid, b.Kid)
+	}
+}
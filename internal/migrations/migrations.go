@@ -0,0 +1,90 @@
+package migrations
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Migration a single SQL file, identified by the numeric version prefix of its name
+type Migration struct {
+	Version string // e.g., "20240101120000" (supabase/migrations convention) or "001"
+	Name    string // e.g., "create_profiles"
+	Path    string // path within the source fs.FS
+}
+
+// File the canonical file name of the migration
+func (m Migration) File() string {
+	if m.Name == "" {
+		return m.Version + ".sql"
+	}
+	return m.Version + "_" + m.Name + ".sql"
+}
+
+// e.g., "20240101120000_create_profiles.sql", "001-init.sql", "0002.sql"
+var fileNameRegex = regexp.MustCompile(`^([0-9]+)(?:[_-](.+))?\.sql$`)
+
+// Parse a migration file name
+func Parse(file string) (*Migration, error) {
+	match := fileNameRegex.FindStringSubmatch(path.Base(file))
+	if match == nil {
+		return nil, fmt.Errorf("invalid migration file name %q (expected <version>_<name>.sql)", path.Base(file))
+	}
+	return &Migration{Version: match[1], Name: match[2], Path: file}, nil
+}
+
+// Collect the migrations at the root of fsys, in the order they must be applied
+// Files not ending in ".sql" are ignored; duplicate versions are rejected.
+func Collect(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	var migrations []Migration
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		migration, err := Parse(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	return migrations, Sort(migrations)
+}
+
+// Sort orders migrations by (numeric) version, rejecting duplicate versions
+func Sort(migrations []Migration) error {
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return Less(migrations[i].Version, migrations[j].Version)
+	})
+	for i := 1; i < len(migrations); i++ {
+		if Compare(migrations[i-1].Version, migrations[i].Version) == 0 {
+			return fmt.Errorf("duplicate migration version %s (%q and %q)", migrations[i].Version, migrations[i-1].Path, migrations[i].Path)
+		}
+	}
+	return nil
+}
+
+// Compare numeric versions of arbitrary length (ignoring leading zeros)
+func Compare(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// Less whether version a sorts before b
+func Less(a, b string) bool {
+	return Compare(a, b) < 0
+}
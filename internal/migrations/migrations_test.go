@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestParse(t *testing.T) {
+	for file, expect := range map[string]Migration{
+		"20240101120000_create_profiles.sql": {Version: "20240101120000", Name: "create_profiles"},
+		"001-init.sql":                       {Version: "001", Name: "init"},
+		"0002.sql":                           {Version: "0002"},
+	} {
+		got, err := Parse(file)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", file, err)
+		}
+		if got.Version != expect.Version || got.Name != expect.Name {
+			t.Errorf("Parse(%s) = %+v; want %+v", file, *got, expect)
+		}
+	}
+	if _, err := Parse("init.sql"); err == nil {
+		t.Errorf("expected error for file without version")
+	}
+}
+
+func TestCollectOrdersNumerically(t *testing.T) {
+	fsys := fstest.MapFS{
+		"10_c.sql":     {},
+		"9_b.sql":      {},
+		"001_a.sql":    {},
+		"README.md":    {},
+		"nested/1.sql": {},
+	}
+	got, err := Collect(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"001_a.sql", "9_b.sql", "10_c.sql"}
+	if len(got) != len(expect) {
+		t.Fatalf("expect %d migrations, got %d", len(expect), len(got))
+	}
+	for i := range expect {
+		if got[i].Path != expect[i] {
+			t.Errorf("expect: %s, got: %s", expect[i], got[i].Path)
+		}
+	}
+}
+
+func TestCollectRejectsDuplicateVersions(t *testing.T) {
+	if _, err := Collect(fstest.MapFS{"1_a.sql": {}, "01_b.sql": {}}); err == nil {
+		t.Errorf("expected duplicate version error")
+	}
+}
@@ -0,0 +1,112 @@
+package pgconf
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var nameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// ValidName whether name is a valid configuration parameter name (e.g., "work_mem", or "pgsodium.getkey_script")
+func ValidName(name string) bool {
+	return nameRegex.MatchString(name)
+}
+
+// Quote a configuration parameter value (single-quoted, as postgresql.conf expects)
+func Quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// Render a configuration file including base, followed by defaults, extra (verbatim), then settings
+// Later lines override earlier ones: settings take precedence over extra, extra over defaults, and defaults over base.
+func Render(base string, defaults map[string]string, extra []byte, settings map[string]string) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("# generated by supago (changes are overwritten)\n")
+	fmt.Fprintf(&b, "include %s\n", Quote(base))
+	if err := writeSettings(&b, defaults); err != nil {
+		return nil, err
+	}
+	if len(extra) > 0 {
+		b.WriteString("\n")
+		b.Write(extra)
+		if extra[len(extra)-1] != '\n' {
+			b.WriteString("\n")
+		}
+	}
+	if err := writeSettings(&b, settings); err != nil {
+		return nil, err
+	}
+	return []byte(b.String()), nil
+}
+
+// writeSettings writes settings (sorted by name) as a paragraph
+func writeSettings(b *strings.Builder, settings map[string]string) error {
+	if len(settings) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		if !ValidName(name) {
+			return fmt.Errorf("invalid postgres setting name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b.WriteString("\n")
+	for _, name := range names {
+		fmt.Fprintf(b, "%s = %s\n", name, Quote(settings[name]))
+	}
+	return nil
+}
+
+const (
+	kB = 1 << 10
+	MB = 1 << 20
+	GB = 1 << 30
+)
+
+// MemoryPreset settings sized for memory bytes dedicated to the database (a web workload)
+// Following the usual rules of thumb: shared_buffers a quarter of memory, effective_cache_size three quarters, and
+// work_mem such that every connection can run a few sorts at once within the rest.
+func MemoryPreset(memory int64) map[string]string {
+	connections := int64(100)
+	switch {
+	case memory <= 1*GB:
+		connections = 60
+	case memory <= 2*GB:
+		connections = 90
+	case memory <= 4*GB:
+		connections = 120
+	case memory <= 8*GB:
+		connections = 160
+	case memory <= 16*GB:
+		connections = 240
+	default:
+		connections = 380
+	}
+	sharedBuffers := memory / 4
+	maintenance := min(memory/16, 2*GB)
+	workMem := max((memory-sharedBuffers)/(connections*3), 4*MB)
+	return map[string]string{
+		"max_connections":      fmt.Sprint(connections),
+		"shared_buffers":       size(sharedBuffers),
+		"effective_cache_size": size(memory * 3 / 4),
+		"maintenance_work_mem": size(maintenance),
+		"work_mem":             size(workMem),
+		"wal_buffers":          size(min(max(sharedBuffers/32, 64*kB), 16*MB)),
+	}
+}
+
+// size in the largest whole unit postgres accepts (rounded down to kB)
+func size(bytes int64) string {
+	switch kb := bytes / kB; {
+	case kb%(GB/kB) == 0:
+		return fmt.Sprintf("%dGB", kb/(GB/kB))
+	case kb%(MB/kB) == 0:
+		return fmt.Sprintf("%dMB", kb/(MB/kB))
+	default:
+		return fmt.Sprintf("%dkB", kb)
+	}
+}
@@ -0,0 +1,54 @@
+package pgconf
+
+import (
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	got, err := Render("/etc/postgresql/postgresql.conf", map[string]string{"log_min_messages": "error"}, []byte("log_statement = 'ddl'"), map[string]string{
+		"work_mem":               "64MB",
+		"max_connections":        "200",
+		"pgsodium.getkey_script": "/usr/bin/key's",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `# generated by supago (changes are overwritten)
+include '/etc/postgresql/postgresql.conf'
+
+log_min_messages = 'error'
+
+log_statement = 'ddl'
+
+max_connections = '200'
+pgsodium.getkey_script = '/usr/bin/key''s'
+work_mem = '64MB'
+`
+	if string(got) != expect {
+		t.Errorf("expect:\n%s\ngot:\n%s", expect, got)
+	}
+
+	if _, err := Render("/etc/postgresql/postgresql.conf", nil, nil, map[string]string{"bad name": "1"}); err == nil {
+		t.Error("expected invalid name error")
+	}
+}
+
+func TestMemoryPreset(t *testing.T) {
+	preset := MemoryPreset(4 * GB)
+	for name, expect := range map[string]string{
+		"max_connections":      "120",
+		"shared_buffers":       "1GB",
+		"effective_cache_size": "3GB",
+		"maintenance_work_mem": "256MB",
+		"work_mem":             "8738kB",
+		"wal_buffers":          "16MB",
+	} {
+		if preset[name] != expect {
+			t.Errorf("%s = %s, expected %s", name, preset[name], expect)
+		}
+	}
+
+	if preset := MemoryPreset(512 * MB); preset["work_mem"] != "4MB" || preset["shared_buffers"] != "128MB" {
+		t.Errorf("unexpected small preset: %v", preset)
+	}
+}
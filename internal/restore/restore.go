@@ -0,0 +1,228 @@
+package restore
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ManagedSchemas schemas created and owned by the stack (the database image, or its services' own migrations)
+var ManagedSchemas = map[string]bool{
+	"_analytics":         true,
+	"_realtime":          true,
+	"_supavisor":         true,
+	"auth":               true,
+	"cron":               true,
+	"extensions":         true,
+	"graphql":            true,
+	"graphql_public":     true,
+	"information_schema": true,
+	"net":                true,
+	"pg_catalog":         true,
+	"pgbouncer":          true,
+	"pgsodium":           true,
+	"pgsodium_masks":     true,
+	"realtime":           true,
+	"storage":            true,
+	"supabase_functions": true,
+	"vault":              true,
+}
+
+// dataSchemas managed schemas whose data (but not definitions) belongs to the user
+var dataSchemas = map[string]bool{
+	"auth":    true,
+	"storage": true,
+}
+
+// serviceBookkeeping tables tracking the services' own migrations (recreated when the services start)
+var serviceBookkeeping = map[string]bool{
+	"auth.schema_migrations": true,
+	"storage.migrations":     true,
+}
+
+// multi-word pg_restore TOC entry descriptions (longest first), the rest being a single word
+var descriptions = []string{
+	"MATERIALIZED VIEW DATA",
+	"PUBLICATION TABLES IN SCHEMA",
+	"TEXT SEARCH CONFIGURATION",
+	"TEXT SEARCH DICTIONARY",
+	"TEXT SEARCH TEMPLATE",
+	"FOREIGN DATA WRAPPER",
+	"TEXT SEARCH PARSER",
+	"SEQUENCE OWNED BY",
+	"DATABASE PROPERTIES",
+	"PUBLICATION TABLE",
+	"MATERIALIZED VIEW",
+	"CHECK CONSTRAINT",
+	"STATISTICS DATA",
+	"OPERATOR FAMILY",
+	"OPERATOR CLASS",
+	"FOREIGN TABLE",
+	"EVENT TRIGGER",
+	"ACCESS METHOD",
+	"FK CONSTRAINT",
+	"SEQUENCE SET",
+	"ROW SECURITY",
+	"INDEX ATTACH",
+	"TABLE ATTACH",
+	"LARGE OBJECT",
+	"USER MAPPING",
+	"DEFAULT ACL",
+	"TABLE DATA",
+	"SHELL TYPE",
+	"BLOB DATA",
+}
+
+// Entry a parsed line of a pg_restore table of contents (pg_restore --list)
+type Entry struct {
+	Line        string
+	Description string // e.g., "TABLE DATA"
+	Schema      string // "-" for objects outside a schema
+	Tag         string // the object name (and owner), e.g., "users supabase_auth_admin" or "EXTENSION pgcrypto"
+}
+
+var entryRegex = regexp.MustCompile(`^\d+; \d+ \d+ (.*)$`)
+
+// ParseEntry parses a TOC line (nil for comments and blank lines)
+func ParseEntry(line string) *Entry {
+	match := entryRegex.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	rest := match[1]
+	entry := &Entry{Line: line}
+	for _, desc := range descriptions {
+		if strings.HasPrefix(rest, desc+" ") {
+			entry.Description = desc
+			break
+		}
+	}
+	if entry.Description == "" {
+		entry.Description, _, _ = strings.Cut(rest, " ")
+	}
+	rest = strings.TrimPrefix(strings.TrimPrefix(rest, entry.Description), " ")
+	entry.Schema, entry.Tag, _ = strings.Cut(rest, " ")
+	return entry
+}
+
+// Name the object name of the entry (its tag without the owner)
+func (e Entry) Name() string {
+	name, _, _ := strings.Cut(e.Tag, " ")
+	return name
+}
+
+// Target what already exists in the database being restored into
+type Target struct {
+	Schemas       map[string]bool
+	Extensions    map[string]bool
+	EventTriggers map[string]bool
+	Publications  map[string]bool
+	Clean         bool // whether existing (user) objects are dropped and recreated
+}
+
+// Plan the filtered TOC to restore
+type Plan struct {
+	List string // the pg_restore --use-list contents
+	// DataTables managed tables ("schema.table") whose data is restored (and must be emptied beforehand)
+	DataTables []string
+}
+
+// FilterTOC keeps the entries of a pg_restore table of contents that can be restored into target
+// Definitions in managed schemas are skipped (the stack owns them), but auth and storage data is kept; objects
+// already present in target (extensions, event triggers, publications, schemas) are not recreated.
+func FilterTOC(toc string, target Target) Plan {
+	var kept []string
+	tables := map[string]bool{}
+	for _, line := range strings.Split(toc, "\n") {
+		entry := ParseEntry(line)
+		if entry == nil {
+			if strings.HasPrefix(line, ";") {
+				kept = append(kept, line)
+			}
+			continue
+		}
+		if keep(*entry, target) {
+			kept = append(kept, line)
+			if entry.Description == "TABLE DATA" && dataSchemas[entry.Schema] {
+				tables[entry.Schema+"."+entry.Name()] = true
+			}
+		}
+	}
+
+	plan := Plan{List: strings.Join(kept, "\n") + "\n"}
+	for table := range tables {
+		plan.DataTables = append(plan.DataTables, table)
+	}
+	sort.Strings(plan.DataTables)
+	return plan
+}
+
+func keep(entry Entry, target Target) bool {
+	if entry.Schema != "-" {
+		if !ManagedSchemas[entry.Schema] {
+			return true
+		} else if !dataSchemas[entry.Schema] || serviceBookkeeping[entry.Schema+"."+entry.Name()] {
+			return false
+		}
+		return entry.Description == "TABLE DATA" || entry.Description == "SEQUENCE SET"
+	}
+
+	kind, name, _ := strings.Cut(entry.Tag, " ") // e.g., "EXTENSION pgcrypto" for comments and ACLs
+	name, _, _ = strings.Cut(name, " ")
+	switch entry.Description {
+	case "DATABASE", "DATABASE PROPERTIES":
+		return false // the stack owns the database (and its settings, e.g., app.settings.jwt_secret)
+	case "SCHEMA":
+		return !ManagedSchemas[entry.Name()] && (target.Clean || !target.Schemas[entry.Name()])
+	case "EXTENSION":
+		return !target.Extensions[entry.Name()]
+	case "EVENT TRIGGER":
+		return !target.EventTriggers[entry.Name()]
+	case "PUBLICATION":
+		return !target.Publications[entry.Name()]
+	case "COMMENT", "ACL":
+		switch kind {
+		case "SCHEMA":
+			return !ManagedSchemas[name]
+		case "EXTENSION":
+			return !target.Extensions[name]
+		case "EVENT":
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	createRoleRegex = regexp.MustCompile(`^CREATE ROLE ("(?:[^"]|"")+"|[^\s;]+);$`)
+	alterRoleRegex  = regexp.MustCompile(`^ALTER ROLE ("(?:[^"]|"")+"|[^\s;]+) `)
+	grantedByRegex  = regexp.MustCompile(` GRANTED BY ("(?:[^"]|"")+"|[^\s;]+)`)
+)
+
+// FilterRoles keeps the statements of a roles dump (pg_dumpall --roles-only) that apply to roles not in existing
+// Roles that already exist are managed by the stack (their attributes and passwords are left untouched).
+func FilterRoles(dump string, existing map[string]bool) string {
+	var kept []string
+	for _, line := range strings.Split(dump, "\n") {
+		if match := createRoleRegex.FindStringSubmatch(line); match != nil {
+			if existing[unquote(match[1])] {
+				continue
+			}
+		} else if match := alterRoleRegex.FindStringSubmatch(line); match != nil {
+			if existing[unquote(match[1])] {
+				continue
+			}
+		} else if strings.HasPrefix(line, "GRANT ") {
+			line = grantedByRegex.ReplaceAllString(line, "") // the grantor may not exist (or lack admin option)
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
+
+func unquote(identifier string) string {
+	if strings.HasPrefix(identifier, `"`) && strings.HasSuffix(identifier, `"`) && len(identifier) > 1 {
+		return strings.ReplaceAll(identifier[1:len(identifier)-1], `""`, `"`)
+	}
+	return identifier
+}
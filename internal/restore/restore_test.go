@@ -0,0 +1,87 @@
+package restore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseEntry(t *testing.T) {
+	entry := ParseEntry("4123; 0 17050 TABLE DATA auth users supabase_auth_admin")
+	if entry == nil {
+		t.Fatal("expected entry")
+	}
+	if entry.Description != "TABLE DATA" || entry.Schema != "auth" || entry.Name() != "users" {
+		t.Errorf("unexpected entry: %+v", *entry)
+	}
+	if ParseEntry(";") != nil || ParseEntry("") != nil {
+		t.Errorf("expected comments and blank lines to be skipped")
+	}
+}
+
+const toc = `;
+; Archive created at 2025-01-01 00:00:00 UTC
+;
+10; 2615 16400 SCHEMA - app postgres
+11; 2615 16401 SCHEMA - auth supabase_admin
+12; 3079 16402 EXTENSION - pgcrypto
+13; 0 0 COMMENT - EXTENSION pgcrypto
+14; 3079 16403 EXTENSION - postgis
+20; 1259 17000 TABLE auth users supabase_auth_admin
+21; 1259 17001 TABLE public profiles postgres
+22; 0 17000 TABLE DATA auth users supabase_auth_admin
+23; 0 17002 TABLE DATA auth schema_migrations supabase_auth_admin
+24; 0 17001 TABLE DATA public profiles postgres
+25; 0 17003 TABLE DATA realtime subscription supabase_admin
+26; 0 0 SEQUENCE SET auth refresh_tokens_id_seq supabase_auth_admin
+27; 3466 17100 EVENT TRIGGER - issue_pg_net_access supabase_admin
+28; 0 0 DATABASE PROPERTIES - postgres supabase_admin
+29; 0 0 ACL - SCHEMA auth supabase_admin
+`
+
+func TestFilterTOC(t *testing.T) {
+	plan := FilterTOC(toc, Target{
+		Schemas:       map[string]bool{"auth": true, "public": true},
+		Extensions:    map[string]bool{"pgcrypto": true},
+		EventTriggers: map[string]bool{"issue_pg_net_access": true},
+	})
+
+	kept := map[string]bool{}
+	for _, line := range strings.Split(plan.List, "\n") {
+		if entry := ParseEntry(line); entry != nil {
+			id, _, _ := strings.Cut(line, ";")
+			kept[id] = true
+		}
+	}
+	for _, id := range []string{"10", "14", "21", "22", "24", "26"} {
+		if !kept[id] {
+			t.Errorf("expected entry %s to be kept", id)
+		}
+	}
+	for _, id := range []string{"11", "12", "13", "20", "23", "25", "27", "28", "29"} {
+		if kept[id] {
+			t.Errorf("expected entry %s to be skipped", id)
+		}
+	}
+	if len(plan.DataTables) != 1 || plan.DataTables[0] != "auth.users" {
+		t.Errorf("unexpected data tables: %v", plan.DataTables)
+	}
+}
+
+func TestFilterRoles(t *testing.T) {
+	dump := strings.Join([]string{
+		"CREATE ROLE anon;",
+		"ALTER ROLE anon WITH NOSUPERUSER INHERIT NOCREATEROLE NOCREATEDB NOLOGIN NOREPLICATION NOBYPASSRLS;",
+		`CREATE ROLE "App Reader";`,
+		`ALTER ROLE "App Reader" WITH LOGIN;`,
+		`GRANT anon TO "App Reader" GRANTED BY postgres;`,
+	}, "\n")
+	got := FilterRoles(dump, map[string]bool{"anon": true})
+	expect := strings.Join([]string{
+		`CREATE ROLE "App Reader";`,
+		`ALTER ROLE "App Reader" WITH LOGIN;`,
+		`GRANT anon TO "App Reader";`,
+	}, "\n")
+	if got != expect {
+		t.Errorf("expect:\n%s\ngot:\n%s", expect, got)
+	}
+}
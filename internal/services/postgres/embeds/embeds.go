@@ -17,9 +17,6 @@ var RealtimeSQL []byte
 //go:embed webhooks.sql
 var WebhooksSQL []byte
 
-//go:embed roles.sql
-var RolesSQL []byte
-
 //go:embed jwt.sql
 var JwtSQL []byte
 
@@ -0,0 +1,475 @@
+// Package settings sets (nested) struct fields from config files (YAML, TOML or JSON) and environment variables
+// Fields are named in snake_case (e.g., "PlatformName" is "platform_name"), nested by struct: a file sets
+// kong.urls.site, which the environment sets as <PREFIX>KONG_URLS_SITE.
+package settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"math"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// names field names not following the snake_case conversion
+var names = map[string]string{
+	"URLs":   "urls",
+	"GitHub": "github",
+}
+
+// Name the setting name of a Go field name (e.g., "access_key_id" for "AccessKeyID")
+func Name(field string) string {
+	if name, ok := names[field]; ok {
+		return name
+	}
+	runes := []rune(field)
+	var name strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			previous := runes[i-1]
+			next := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && next) {
+				name.WriteByte('_')
+			}
+		}
+		name.WriteRune(unicode.ToLower(r))
+	}
+	return name.String()
+}
+
+// Decode parses a config file by its extension (".yaml", ".yml", ".toml" or ".json")
+func Decode(path string, data []byte) (map[string]any, error) {
+	values := map[string]any{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &values); err != nil {
+			return nil, err
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&values); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q (use .yaml, .toml or .json)", ext)
+	}
+	return values, nil
+}
+
+// Apply sets the fields of target (a pointer to a struct) from values (as decoded by Decode); returning the paths
+// (e.g., "kong.urls.site") set. Tables merge into maps; lists replace slices. Fields whose path is in skip cannot be set.
+func Apply(target any, values map[string]any, skip ...string) ([]string, error) {
+	var set []string
+	if err := apply(reflect.ValueOf(target).Elem(), values, "", skip, &set); err != nil {
+		return nil, err
+	}
+	sort.Strings(set)
+	return set, nil
+}
+
+// Env sets the fields of target (a pointer to a struct) from the environment variables (looked up with lookup) named
+// prefix followed by their path in upper case (e.g., "SUPAGO_KONG_URLS_SITE"); returning the paths set. Lists of
+// strings are comma-separated; other lists, maps and structs are JSON. Fields whose path is in skip are not read.
+func Env(target any, prefix string, lookup func(key string) (string, bool), skip ...string) ([]string, error) {
+	var set []string
+	err := walk(reflect.ValueOf(target).Elem(), "", skip, func(field reflect.Value, path string) error {
+		key := prefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+		raw, ok := lookup(key)
+		if !ok {
+			return nil
+		}
+		if err := assignString(field, raw); err != nil {
+			return fmt.Errorf("environment variable %s: %w", key, err)
+		}
+		set = append(set, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(set)
+	return set, nil
+}
+
+// Paths the path of every field of target (a pointer to a struct) that can be set (except those in skip)
+func Paths(target any, skip ...string) []string {
+	var paths []string
+	_ = walk(reflect.ValueOf(target).Elem(), "", skip, func(_ reflect.Value, path string) error {
+		paths = append(paths, path)
+		return nil
+	})
+	return paths
+}
+
+// walk calls fn for every settable non-struct field of v (descending into structs, allocating pointers to them)
+func walk(v reflect.Value, prefix string, skip []string, fn func(field reflect.Value, path string) error) error {
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		path := join(prefix, Name(field.Name))
+		if !field.IsExported() || slices.Contains(skip, path) || !supported(field.Type) {
+			continue
+		}
+		value := v.Field(i)
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			if err := walk(value, path, skip, fn); err != nil {
+				return err
+			}
+		case field.Type.Kind() == reflect.Pointer && field.Type.Elem().Kind() == reflect.Struct:
+			// only allocated when one of its fields is set
+			elem := reflect.New(field.Type.Elem())
+			if !value.IsNil() {
+				elem.Elem().Set(value.Elem())
+			}
+			touched := false
+			if err := walk(elem.Elem(), path, skip, func(f reflect.Value, p string) error {
+				before := f.Interface()
+				if err := fn(f, p); err != nil {
+					return err
+				}
+				touched = touched || !reflect.DeepEqual(before, f.Interface())
+				return nil
+			}); err != nil {
+				return err
+			} else if touched {
+				value.Set(elem)
+			}
+		default:
+			if err := fn(value, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// supported whether values of type t can be set
+func supported(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Struct:
+		return true
+	case reflect.Slice:
+		return supported(t.Elem())
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && supported(t.Elem())
+	case reflect.Pointer:
+		return t.Elem().Kind() == reflect.Struct
+	default:
+		return false
+	}
+}
+
+// apply sets v from a decoded value
+func apply(v reflect.Value, raw any, path string, skip []string, set *[]string) error {
+	if v.Kind() == reflect.Struct {
+		values, ok := raw.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected a table of settings, got %s", display(path), describe(raw))
+		}
+		fields := map[string]int{}
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			if name := join(path, Name(field.Name)); field.IsExported() && !slices.Contains(skip, name) && supported(field.Type) {
+				fields[Name(field.Name)] = i
+			}
+		}
+		for _, key := range sortedKeys(values) {
+			i, ok := fields[key]
+			if !ok {
+				known := sortedKeys(fields)
+				return fmt.Errorf("%s: unknown setting (expected one of %s)", join(path, key), strings.Join(known, ", "))
+			}
+			if err := apply(v.Field(i), values[key], join(path, key), skip, set); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if v.Kind() == reflect.Pointer {
+		if raw == nil {
+			v.Set(reflect.Zero(v.Type()))
+			*set = append(*set, path)
+			return nil
+		}
+		elem := reflect.New(v.Type().Elem())
+		if !v.IsNil() {
+			elem.Elem().Set(v.Elem())
+		}
+		if err := apply(elem.Elem(), raw, path, skip, set); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+
+	if err := assign(v, raw); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	*set = append(*set, path)
+	return nil
+}
+
+// assign sets a non-struct v from a decoded value
+func assign(v reflect.Value, raw any) error {
+	switch {
+	case v.Type() == durationType:
+		s, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("expected a duration (e.g., \"30s\" or \"5m\"), got %s", describe(raw))
+		}
+		return assignString(v, s)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		s, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %s", describe(raw))
+		}
+		v.SetBytes([]byte(s))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		switch value := raw.(type) {
+		case string:
+			v.SetString(value)
+		case json.Number, int, int64, uint64, bool: // e.g., max_connections: 200 (exact, unlike floats)
+			if v.Type().Name() != "string" { // a named type (e.g., an enum) is never numeric
+				return fmt.Errorf("expected a string, got %s", describe(raw))
+			}
+			v.SetString(fmt.Sprint(value))
+		case float64:
+			return fmt.Errorf("expected a string (quote the value), got %s", describe(raw))
+		default:
+			return fmt.Errorf("expected a string, got %s", describe(raw))
+		}
+	case reflect.Bool:
+		value, ok := raw.(bool)
+		if !ok {
+			return fmt.Errorf("expected true or false, got %s", describe(raw))
+		}
+		v.SetBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := integer(raw)
+		if !ok {
+			return fmt.Errorf("expected an integer, got %s", describe(raw))
+		}
+		return setInteger(v, n)
+	case reflect.Float32, reflect.Float64:
+		switch value := raw.(type) {
+		case float64:
+			v.SetFloat(value)
+		case json.Number:
+			f, err := value.Float64()
+			if err != nil {
+				return fmt.Errorf("expected a number, got %s", describe(raw))
+			}
+			v.SetFloat(f)
+		default:
+			n, ok := integer(raw)
+			if !ok {
+				return fmt.Errorf("expected a number, got %s", describe(raw))
+			}
+			v.SetFloat(float64(n))
+		}
+	case reflect.Slice:
+		var items []any
+		switch value := raw.(type) {
+		case []any:
+			items = value
+		case []map[string]any: // e.g., TOML arrays of tables
+			for _, item := range value {
+				items = append(items, item)
+			}
+		default:
+			return fmt.Errorf("expected a list, got %s", describe(raw))
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			var set []string
+			if err := apply(slice.Index(i), item, fmt.Sprintf("[%d]", i), nil, &set); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Map:
+		values, ok := raw.(map[string]any)
+		if !ok {
+			return fmt.Errorf("expected a table, got %s", describe(raw))
+		}
+		m := reflect.MakeMapWithSize(v.Type(), v.Len()+len(values)) // merged into (a copy of) the current entries
+		for iter := v.MapRange(); iter.Next(); {
+			m.SetMapIndex(iter.Key(), iter.Value())
+		}
+		for _, key := range sortedKeys(values) {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			var set []string
+			if err := apply(elem, values[key], key, nil, &set); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		}
+		v.Set(m)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// assignString sets v from an environment variable's value
+func assignString(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("expected a duration (e.g., \"30s\" or \"5m\"), got %q", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", s)
+		}
+		return setInteger(v, n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", s)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s))
+			return nil
+		} else if v.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(s), "[") {
+			var items []any
+			for _, item := range strings.Split(s, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			return assign(v, items)
+		}
+		fallthrough
+	default:
+		decoder := json.NewDecoder(strings.NewReader(s))
+		decoder.UseNumber()
+		var raw any
+		if err := decoder.Decode(&raw); err != nil {
+			return fmt.Errorf("expected JSON: %w", err)
+		}
+		var set []string
+		return apply(v, raw, "", nil, &set)
+	}
+	return nil
+}
+
+// setInteger sets an integer v to n, if in range
+func setInteger(v reflect.Value, n int64) error {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n < 0 || v.OverflowUint(uint64(n)) {
+			return fmt.Errorf("expected an integer between 0 and %d, got %d", uint64(1)<<(v.Type().Bits())-1, n)
+		}
+		v.SetUint(uint64(n))
+	default:
+		if v.OverflowInt(n) {
+			return fmt.Errorf("%d is out of range", n)
+		}
+		v.SetInt(n)
+	}
+	return nil
+}
+
+// integer a decoded value as an integer
+func integer(raw any) (int64, bool) {
+	switch value := raw.(type) {
+	case int:
+		return int64(value), true
+	case int64:
+		return value, true
+	case uint64:
+		if value <= math.MaxInt64 {
+			return int64(value), true
+		}
+	case float64:
+		if value == math.Trunc(value) && math.Abs(value) <= math.MaxInt64 {
+			return int64(value), true
+		}
+	case json.Number:
+		n, err := value.Int64()
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// describe a decoded value, for errors
+func describe(raw any) string {
+	switch value := raw.(type) {
+	case nil:
+		return "nothing"
+	case string:
+		return strconv.Quote(value)
+	case map[string]any:
+		return "a table"
+	case []any, []map[string]any:
+		return "a list"
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// display a path, for errors (the root is "config")
+func display(path string) string {
+	if path == "" {
+		return "config"
+	}
+	return path
+}
+
+func join(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,251 @@
+package settings
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type item struct {
+	Name    string
+	Version string
+}
+
+type s3 struct {
+	Bucket      string
+	AccessKeyID string
+}
+
+type archive struct {
+	Directory string
+	Timeout   time.Duration
+	S3        *s3
+}
+
+type config struct {
+	Global struct {
+		PlatformName string
+		DebugMode    bool
+	}
+	Kong struct {
+		URLs struct {
+			Site string
+		}
+		HostPort uint16
+	}
+	Database struct {
+		Settings   map[string]string
+		ConfigFile []byte
+		Memory     int64
+		Items      []item
+		Schemas    []string
+		Archive    *archive
+		Store      interface{ Load() error }
+	}
+	Secret string
+}
+
+func TestName(t *testing.T) {
+	for field, expect := range map[string]string{
+		"PlatformName":       "platform_name",
+		"URLs":               "urls",
+		"SMTP":               "smtp",
+		"AccessKeyID":        "access_key_id",
+		"S3":                 "s3",
+		"PgSodiumEncryption": "pg_sodium_encryption",
+		"JWKS":               "jwks",
+		"HostPort":           "host_port",
+		"GitHub":             "github",
+		"OIDC":               "oidc",
+	} {
+		if got := Name(field); got != expect {
+			t.Errorf("Name(%q): expected %q, got %q", field, expect, got)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+global:
+  platform_name: demo
+  debug_mode: true
+kong:
+  urls:
+    site: https://example.com
+  host_port: 8100
+database:
+  settings:
+    max_connections: 200
+  config_file: "log_statement = 'ddl'"
+  memory: 1073741824
+  items:
+    - name: vector
+      version: "0.8.0"
+  schemas: [public, api]
+  archive:
+    directory: /archive
+    timeout: 5m
+    s3:
+      bucket: wal
+      access_key_id: key
+`,
+		"config.toml": `
+[global]
+platform_name = "demo"
+debug_mode = true
+
+[kong]
+host_port = 8100
+urls = { site = "https://example.com" }
+
+[database]
+settings = { max_connections = 200 }
+config_file = "log_statement = 'ddl'"
+memory = 1073741824
+schemas = ["public", "api"]
+
+[[database.items]]
+name = "vector"
+version = "0.8.0"
+
+[database.archive]
+directory = "/archive"
+timeout = "5m"
+
+[database.archive.s3]
+bucket = "wal"
+access_key_id = "key"
+`,
+		"config.json": `{
+  "global": {"platform_name": "demo", "debug_mode": true},
+  "kong": {"urls": {"site": "https://example.com"}, "host_port": 8100},
+  "database": {
+    "settings": {"max_connections": 200},
+    "config_file": "log_statement = 'ddl'",
+    "memory": 1073741824,
+    "items": [{"name": "vector", "version": "0.8.0"}],
+    "schemas": ["public", "api"],
+    "archive": {"directory": "/archive", "timeout": "5m", "s3": {"bucket": "wal", "access_key_id": "key"}}
+  }
+}`,
+	}
+	for path, data := range files {
+		values, err := Decode(path, []byte(data))
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		var cfg config
+		cfg.Database.Settings = map[string]string{"work_mem": "64MB"}
+		set, err := Apply(&cfg, values)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if cfg.Global.PlatformName != "demo" || !cfg.Global.DebugMode || cfg.Kong.URLs.Site != "https://example.com" || cfg.Kong.HostPort != 8100 {
+			t.Errorf("%s: unexpected global/kong settings: %+v %+v", path, cfg.Global, cfg.Kong)
+		}
+		db := cfg.Database
+		if db.Settings["max_connections"] != "200" || db.Settings["work_mem"] != "64MB" || string(db.ConfigFile) != "log_statement = 'ddl'" || db.Memory != 1<<30 {
+			t.Errorf("%s: unexpected database settings: %+v", path, db)
+		}
+		if !reflect.DeepEqual(db.Items, []item{{Name: "vector", Version: "0.8.0"}}) || !reflect.DeepEqual(db.Schemas, []string{"public", "api"}) {
+			t.Errorf("%s: unexpected lists: %+v %+v", path, db.Items, db.Schemas)
+		}
+		if db.Archive == nil || db.Archive.Directory != "/archive" || db.Archive.Timeout != 5*time.Minute || db.Archive.S3 == nil || db.Archive.S3.AccessKeyID != "key" {
+			t.Errorf("%s: unexpected archive: %+v", path, db.Archive)
+		}
+		if !strings.Contains(strings.Join(set, ","), "database.archive.s3.bucket") || !strings.Contains(strings.Join(set, ","), "kong.urls.site") {
+			t.Errorf("%s: unexpected paths set: %v", path, set)
+		}
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	for yaml, expect := range map[string]string{
+		"kong: {host_port: 70000}":          "kong.host_port: expected an integer between 0 and 65535, got 70000",
+		"kong: {host_port: abc}":            `kong.host_port: expected an integer, got "abc"`,
+		"kong: {urls: {sites: x}}":          "kong.urls.sites: unknown setting (expected one of site)",
+		"global: {debug_mode: maybe}":       `global.debug_mode: expected true or false, got "maybe"`,
+		"database: {archive: {timeout: 5}}": `database.archive.timeout: expected a duration (e.g., "30s" or "5m"), got 5`,
+		"database: {store: x}":              "database.store: unknown setting",
+		"secret: x":                         "secret: unknown setting",
+		"global: x":                         "global: expected a table of settings",
+		"global: {platform_name: 1e40}":     "global.platform_name: expected a string (quote the value)",
+	} {
+		values, err := Decode("config.yaml", []byte(yaml))
+		if err != nil {
+			t.Fatalf("%s: %v", yaml, err)
+		}
+		var cfg config
+		if _, err := Apply(&cfg, values, "secret"); err == nil || !strings.Contains(err.Error(), expect) {
+			t.Errorf("%s: expected error %q, got %v", yaml, expect, err)
+		}
+	}
+
+	if _, err := Decode("config.ini", nil); err == nil {
+		t.Error("expected unsupported format error")
+	}
+}
+
+func TestEnv(t *testing.T) {
+	env := map[string]string{
+		"APP_GLOBAL_PLATFORM_NAME":       "demo",
+		"APP_GLOBAL_DEBUG_MODE":          "true",
+		"APP_KONG_URLS_SITE":             "https://example.com",
+		"APP_KONG_HOST_PORT":             "8100",
+		"APP_DATABASE_SETTINGS":          `{"max_connections": "200"}`,
+		"APP_DATABASE_SCHEMAS":           "public, api",
+		"APP_DATABASE_ITEMS":             `[{"name": "vector"}]`,
+		"APP_DATABASE_ARCHIVE_TIMEOUT":   "90s",
+		"APP_DATABASE_ARCHIVE_S3_BUCKET": "wal",
+		"APP_SECRET":                     "ignored",
+	}
+	lookup := func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+	var cfg config
+	set, err := Env(&cfg, "APP_", lookup, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Global.PlatformName != "demo" || !cfg.Global.DebugMode || cfg.Kong.URLs.Site != "https://example.com" || cfg.Kong.HostPort != 8100 {
+		t.Errorf("unexpected global/kong settings: %+v %+v", cfg.Global, cfg.Kong)
+	}
+	if cfg.Database.Settings["max_connections"] != "200" || !reflect.DeepEqual(cfg.Database.Schemas, []string{"public", "api"}) || !reflect.DeepEqual(cfg.Database.Items, []item{{Name: "vector"}}) {
+		t.Errorf("unexpected database settings: %+v", cfg.Database)
+	}
+	if cfg.Database.Archive == nil || cfg.Database.Archive.Timeout != 90*time.Second || cfg.Database.Archive.S3 == nil || cfg.Database.Archive.S3.Bucket != "wal" {
+		t.Errorf("unexpected archive: %+v", cfg.Database.Archive)
+	}
+	if cfg.Secret != "" || len(set) != 9 {
+		t.Errorf("unexpected paths set: %v", set)
+	}
+
+	// pointers stay nil unless one of their fields is set
+	cfg = config{}
+	if _, err := Env(&cfg, "APP_", func(string) (string, bool) { return "", false }); err != nil {
+		t.Fatal(err)
+	} else if cfg.Database.Archive != nil {
+		t.Error("expected no archive")
+	}
+
+	env = map[string]string{"APP_KONG_HOST_PORT": "-1"}
+	if _, err := Env(&cfg, "APP_", lookup); err == nil || !strings.Contains(err.Error(), "environment variable APP_KONG_HOST_PORT: expected an integer between 0 and 65535") {
+		t.Errorf("expected range error, got %v", err)
+	}
+}
+
+func TestPaths(t *testing.T) {
+	paths := Paths(&config{}, "secret")
+	for _, expect := range []string{"global.platform_name", "kong.urls.site", "database.archive.s3.access_key_id", "database.items"} {
+		found := false
+		for _, path := range paths {
+			found = found || path == expect
+		}
+		if !found {
+			t.Errorf("expected path %q in %v", expect, paths)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
+	"io"
 	"path"
 	"strings"
 	"time"
@@ -136,3 +137,82 @@ func ExecInContainer(ctx context.Context, docker *client.Client, cid string, cmd
 
 	return output, nil
 }
+
+// ExecInContainerStream runs "cmd" inside container cid, streaming its stdout to stdout
+// Stderr is collected and returned (for error reporting).
+func ExecInContainerStream(ctx context.Context, docker *client.Client, cid string, cmd []string, stdout io.Writer) (string, error) {
+	execResp, err := docker.ContainerExecCreate(ctx, cid, container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          false,
+	})
+	if err != nil {
+		return "", fmt.Errorf("ExecInContainerStream create failed: %w", err)
+	}
+
+	att, err := docker.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{Tty: false})
+	if err != nil {
+		return "", fmt.Errorf("ExecInContainerStream attach failed: %w", err)
+	}
+	defer att.Close()
+
+	var stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(stdout, &stderr, att.Reader); err != nil {
+		return stderr.String(), fmt.Errorf("ExecInContainerStream copy failed: %w", err)
+	}
+
+	inspect, err := docker.ContainerExecInspect(ctx, execResp.ID)
+	if err != nil {
+		return stderr.String(), fmt.Errorf("ExecInContainerStream inspect failed: %w", err)
+	}
+	if inspect.ExitCode != 0 {
+		return stderr.String(), fmt.Errorf("ExecInContainerStream command exited with code %d", inspect.ExitCode)
+	}
+
+	return stderr.String(), nil
+}
+
+// ExecInContainerStdin runs "cmd" inside container cid with stdin streamed to its standard input (closed at EOF)
+func ExecInContainerStdin(ctx context.Context, docker *client.Client, cid string, cmd []string, stdin io.Reader) (string, error) {
+	execResp, err := docker.ContainerExecCreate(ctx, cid, container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          false,
+	})
+	if err != nil {
+		return "", fmt.Errorf("ExecInContainerStdin create failed: %w", err)
+	}
+
+	att, err := docker.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{Tty: false})
+	if err != nil {
+		return "", fmt.Errorf("ExecInContainerStdin attach failed: %w", err)
+	}
+	copied := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(att.Conn, stdin)
+		if closeErr := att.CloseWrite(); err == nil {
+			err = closeErr
+		}
+		copied <- err
+	}()
+
+	var buf bytes.Buffer
+	_, _ = stdcopy.StdCopy(&buf, &buf, att.Reader)
+	att.Close() // unblocks the copy if the command exited without reading all of stdin
+	copyErr := <-copied
+	output := buf.String()
+
+	inspect, err := docker.ContainerExecInspect(ctx, execResp.ID)
+	if err != nil {
+		return output, fmt.Errorf("ExecInContainerStdin inspect failed: %w", err)
+	}
+	if inspect.ExitCode != 0 {
+		return output, fmt.Errorf("ExecInContainerStdin command exited with code %d", inspect.ExitCode)
+	} else if copyErr != nil {
+		return output, fmt.Errorf("ExecInContainerStdin copy failed: %w", copyErr)
+	}
+	return output, nil
+}
@@ -1,8 +1,20 @@
 package utils
 
+import "strings"
+
 func ShortStr(s string) string {
 	if len(s) > 8 {
 		return s[:4] + "..." + s[len(s)-4:]
 	}
 	return s
 }
+
+// QuoteLiteral quotes s as a SQL string literal (e.g., for statements passed to psql -c)
+func QuoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// QuoteIdentifier quotes s as a SQL identifier
+func QuoteIdentifier(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
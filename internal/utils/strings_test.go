@@ -25,3 +25,19 @@ func TestShortStrGt8(t *testing.T) {
 		t.Errorf("expect: %s, got: %s", expect, got)
 	}
 }
+
+func TestQuoteLiteral(t *testing.T) {
+	expect := `'it''s'`
+	got := QuoteLiteral("it's")
+	if expect != got {
+		t.Errorf("expect: %s, got: %s", expect, got)
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	expect := `"my""schema"`
+	got := QuoteIdentifier(`my"schema`)
+	if expect != got {
+		t.Errorf("expect: %s, got: %s", expect, got)
+	}
+}
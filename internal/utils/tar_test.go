@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tarOf(t *testing.T, members map[string]string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, data := range members {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o600, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestExtractTar(t *testing.T) {
+	dir := t.TempDir()
+	if err := ExtractTar(tarOf(t, map[string]string{"./PG_VERSION": "17\n", "base/1/112": "data"}), dir); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "PG_VERSION")); err != nil || string(data) != "17\n" {
+		t.Errorf("unexpected PG_VERSION: %q (%v)", data, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "base", "1", "112")); err != nil || string(data) != "data" {
+		t.Errorf("unexpected base/1/112: %q (%v)", data, err)
+	}
+}
+
+func TestExtractTarEscape(t *testing.T) {
+	if err := ExtractTar(tarOf(t, map[string]string{"../escaped": "x"}), t.TempDir()); err == nil {
+		t.Error("expected escaping member to be rejected")
+	}
+}
@@ -0,0 +1,55 @@
+package wal
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Label the parts of a backup_label file (as returned by pg_backup_stop) needed for recovery
+type Label struct {
+	StartSegment string    // the WAL segment the backup starts in, e.g., "000000010000000000000002"
+	StartTime    time.Time // when the backup started
+	Timeline     string
+}
+
+var (
+	startWALRegex  = regexp.MustCompile(`^START WAL LOCATION: \S+ \(file ([0-9A-F]{24})\)$`)
+	startTimeRegex = regexp.MustCompile(`^START TIME: (.+)$`)
+)
+
+// ParseLabel parses a backup_label file
+func ParseLabel(data string) (*Label, error) {
+	label := &Label{}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if match := startWALRegex.FindStringSubmatch(line); match != nil {
+			label.StartSegment = match[1]
+			label.Timeline = match[1][:8]
+		} else if match := startTimeRegex.FindStringSubmatch(line); match != nil {
+			started, err := time.Parse("2006-01-02 15:04:05 MST", match[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid backup label start time %q: %w", match[1], err)
+			}
+			label.StartTime = started.UTC()
+		}
+	}
+	if label.StartSegment == "" {
+		return nil, fmt.Errorf("backup label has no start WAL location")
+	}
+	return label, nil
+}
+
+var segmentRegex = regexp.MustCompile(`^[0-9A-F]{24}`)
+
+// Expired whether an archived WAL file is not needed to recover from a backup starting in segment oldest (or later)
+// WAL segments (and backup history files) before oldest are expired; timeline history files are always kept.
+func Expired(name, oldest string) bool {
+	if !segmentRegex.MatchString(name) || strings.HasSuffix(name, ".history") {
+		return false
+	}
+	return name[8:24] < oldest[8:24] || name[8:24] == oldest[8:24] && name[:8] < oldest[:8]
+}
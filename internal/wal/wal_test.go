@@ -0,0 +1,48 @@
+package wal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLabel(t *testing.T) {
+	label, err := ParseLabel(`START WAL LOCATION: 0/2000028 (file 000000010000000000000002)
+CHECKPOINT LOCATION: 0/2000060
+BACKUP METHOD: streamed
+BACKUP FROM: primary
+START TIME: 2025-03-01 12:30:00 UTC
+LABEL: supago-20250301T123000Z
+START TIMELINE: 1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label.StartSegment != "000000010000000000000002" || label.Timeline != "00000001" {
+		t.Errorf("unexpected start segment: %+v", label)
+	}
+	if !label.StartTime.Equal(time.Date(2025, 3, 1, 12, 30, 0, 0, time.UTC)) {
+		t.Errorf("unexpected start time: %v", label.StartTime)
+	}
+
+	if _, err := ParseLabel("LABEL: nothing"); err == nil {
+		t.Error("expected error for label without start location")
+	}
+}
+
+func TestExpired(t *testing.T) {
+	const oldest = "000000020000000000000010"
+	for name, expect := range map[string]bool{
+		"000000010000000000000005":                 true,
+		"00000001000000000000000F.00000028.backup": true,
+		"000000010000000000000010":                 true,
+		"000000020000000000000010":                 false,
+		"000000020000000000000011":                 false,
+		"000000030000000000000009":                 true,
+		"00000002.history":                         false,
+		"backup_label":                             false,
+	} {
+		if got := Expired(name, oldest); got != expect {
+			t.Errorf("Expired(%s) = %v, expected %v", name, got, expect)
+		}
+	}
+}
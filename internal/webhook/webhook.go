@@ -0,0 +1,71 @@
+// Package webhook signs and verifies Standard Webhooks (https://www.standardwebhooks.com), as GoTrue's HTTP hooks
+// send them
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SecretPrefix prefixes base64 secrets (e.g., "v1,whsec_<base64>" in GoTrue's hook config)
+	SecretPrefix = "whsec_"
+	// Tolerance how far a request's timestamp may be from now
+	Tolerance = 5 * time.Minute
+)
+
+// Secret decodes a "whsec_"-prefixed (or bare) base64 secret
+func Secret(secret string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, SecretPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook secret: %w", err)
+	} else if len(key) < 24 {
+		return nil, fmt.Errorf("webhook secret too short (%d bytes, at least 24 required)", len(key))
+	}
+	return key, nil
+}
+
+// Sign the "v1,<base64>" signature of a message
+func Sign(key []byte, id string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(fmt.Sprintf("%s.%d.", id, timestamp.Unix())))
+	mac.Write(body)
+	return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Header sets the headers of a signed message
+func Header(header http.Header, key []byte, id string, timestamp time.Time, body []byte) {
+	header.Set("webhook-id", id)
+	header.Set("webhook-timestamp", strconv.FormatInt(timestamp.Unix(), 10))
+	header.Set("webhook-signature", Sign(key, id, timestamp, body))
+}
+
+// Verify checks a message's headers carry a valid signature of body, timestamped within Tolerance of now
+func Verify(key []byte, header http.Header, body []byte, now time.Time) error {
+	id, timestamp := header.Get("webhook-id"), header.Get("webhook-timestamp")
+	if id == "" || timestamp == "" || header.Get("webhook-signature") == "" {
+		return errors.New("missing webhook headers")
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid webhook timestamp %q", timestamp)
+	}
+	at := time.Unix(seconds, 0)
+	if at.Before(now.Add(-Tolerance)) || at.After(now.Add(Tolerance)) {
+		return errors.New("webhook timestamp out of tolerance")
+	}
+	expected := Sign(key, id, at, body)
+	for _, signature := range strings.Fields(header.Get("webhook-signature")) {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return errors.New("invalid webhook signature")
+}
@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	body := []byte(`{"user_id":"1"}`)
+	now := time.Unix(1700000000, 0)
+
+	header := http.Header{}
+	Header(header, key, "msg_1", now, body)
+	if err := Verify(key, header, body, now.Add(time.Minute)); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+
+	// any of several (space-separated) signatures may match
+	header.Set("webhook-signature", "v1,bm9wZQ== "+header.Get("webhook-signature"))
+	if err := Verify(key, header, body, now); err != nil {
+		t.Errorf("expected a matching signature among several, got %v", err)
+	}
+
+	for name, check := range map[string]func() error{
+		"tampered body": func() error { return Verify(key, header, []byte(`{"user_id":"2"}`), now) },
+		"other key":     func() error { return Verify([]byte(strings.Repeat("x", 32)), header, body, now) },
+		"stale":         func() error { return Verify(key, header, body, now.Add(Tolerance+time.Second)) },
+		"unsigned":      func() error { return Verify(key, http.Header{}, body, now) },
+	} {
+		if err := check(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSecret(t *testing.T) {
+	raw := []byte("0123456789abcdef0123456789abcdef")
+	encoded := base64.StdEncoding.EncodeToString(raw)
+	for _, secret := range []string{encoded, SecretPrefix + encoded} {
+		if key, err := Secret(secret); err != nil || string(key) != string(raw) {
+			t.Errorf("Secret(%q): got %q, %v", secret, key, err)
+		}
+	}
+	if _, err := Secret("not base64!"); err == nil {
+		t.Error("expected an error for an invalid secret")
+	}
+	if _, err := Secret(base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Error("expected an error for a short secret")
+	}
+}
@@ -0,0 +1,30 @@
+package supago
+
+import (
+	"net/http"
+)
+
+// JWKS the public JSON Web Key Set that tokens issued by the stack can be verified with
+// The set is empty when JWTs are signed with the shared secret (which is never published)
+func (sg *SupaGo) JWKS() []byte {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+	if sg.config.Keys.JWKS == "" {
+		return []byte(`{"keys":[]}`)
+	}
+	return []byte(sg.config.Keys.JWKS)
+}
+
+// JWKSHandler serves JWKS (e.g., mount at "/.well-known/jwks.json") so third-party services can verify tokens
+func (sg *SupaGo) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		_, _ = w.Write(sg.JWKS())
+	})
+}
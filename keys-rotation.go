@@ -0,0 +1,217 @@
+package supago
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/train360-corp/supago/internal/jwk"
+	"github.com/train360-corp/supago/internal/utils"
+	"slices"
+	"strings"
+)
+
+// keyDependentServices network aliases of the services embedding JWT keys (recreated when keys change)
+var keyDependentServices = []string{"auth", "rest", "realtime", "storage", "kong", "studio"}
+
+// Keys the keys currently in use (including any keys retiring after a rotation)
+func (sg *SupaGo) Keys() KeysConfig {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+	return sg.config.Keys
+}
+
+// RotateKeys introduces new JWT signing material and re-mints the anon and service keys with it
+// When getter is nil, a new key of the current kind is generated (an asymmetric key of the same algorithm, or a new
+// random shared secret); otherwise, the asymmetric key it returns is used.
+// The replaced keys (and JWTs signed by them) remain valid until RetireKeys is called. The new and retiring keys are
+// persisted (see GlobalConfig.SecretsStore), and take precedence over the builder's keys when the config is built again.
+// Only the services embedding JWT keys (Auth, Rest, Realtime, Storage, Kong, Studio) are recreated.
+func (sg *SupaGo) RotateKeys(ctx context.Context, getter SigningKeyGetter) (*KeysConfig, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	current := sg.config.Keys
+	if current.Retiring != nil {
+		return nil, errors.New("a key rotation is already in progress (use RetireKeys to complete it first)")
+	}
+
+	next := current
+	next.keyIDs = true
+	next.rotated = true
+	next.Retiring = &RetiringKeysConfig{
+		JwtSecret:  current.JwtSecret,
+		SigningKey: current.SigningKey,
+		PublicJwt:  current.PublicJwt,
+		PrivateJwt: current.PrivateJwt,
+	}
+	if getter == nil && current.SigningKey != nil {
+		key, err := jwk.Generate(string(current.SigningKey.Algorithm))
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate %s signing key: %w", current.SigningKey.Algorithm, err)
+		}
+		next.SigningKey = &SigningKey{Algorithm: current.SigningKey.Algorithm, Private: key}
+	} else if getter == nil {
+		next.JwtSecret = utils.RandomString(32)
+	} else if key, err := getter(); err != nil {
+		return nil, fmt.Errorf("failed to get signing key: %w", err)
+	} else if key == nil {
+		return nil, errors.New("signing key getter returned no key")
+	} else {
+		next.SigningKey = key
+	}
+	if err := next.mint(); err != nil {
+		return nil, fmt.Errorf("failed to mint keys: %w", err)
+	}
+
+	sg.logger.Infof("rotating jwt keys (retiring keys remain valid until retired)")
+	if err := sg.saveKeys(next); err != nil {
+		return nil, err
+	} else if err := sg.applyKeys(ctx, next); err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// RetireKeys completes a rotation: keys replaced by RotateKeys (and JWTs signed by them) stop being accepted
+func (sg *SupaGo) RetireKeys(ctx context.Context) error {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	if sg.config.Keys.Retiring == nil {
+		return errors.New("no key rotation is in progress")
+	}
+
+	next := sg.config.Keys
+	next.Retiring = nil
+	if err := next.deriveJWKS(); err != nil { // the anon and service keys themselves are unchanged
+		return fmt.Errorf("failed to derive key sets: %w", err)
+	}
+
+	sg.logger.Infof("retiring previous jwt keys")
+	if err := sg.saveKeys(next); err != nil {
+		return err
+	}
+	return sg.applyKeys(ctx, next)
+}
+
+// saveKeys persists the config's secrets with keys (see GlobalConfig.SecretsStore)
+// They are saved before being applied, as the config switches to them even if recreating the services fails.
+// The caller must hold sg.mu
+func (sg *SupaGo) saveKeys(keys KeysConfig) error {
+	store := sg.config.Global.SecretsStore
+	if store == nil {
+		return nil
+	}
+	cfg := sg.config
+	cfg.Keys = keys
+	secrets, err := cfg.secrets()
+	if err != nil {
+		return err
+	} else if err := store.Save(secrets); err != nil {
+		return fmt.Errorf("failed to save keys: %w", err)
+	}
+	return nil
+}
+
+// addRotatedSecrets adds the keys of a rotation (the current signing key and any retiring keys) to secrets (see
+// rotatedKeys); none unless the keys were rotated
+func (k KeysConfig) addRotatedSecrets(secrets map[string]string) error {
+	if !k.rotated {
+		return nil
+	}
+	secrets["keys_rotated"] = "true"
+	add := func(prefix string, key *SigningKey) error {
+		if key == nil {
+			return nil
+		}
+		data, err := jwk.EncodePEM(key.Private)
+		if err != nil {
+			return fmt.Errorf("failed to encode %ssigning key: %w", strings.ReplaceAll(prefix, "_", " "), err)
+		}
+		secrets[prefix+"signing_algorithm"] = string(key.Algorithm)
+		secrets[prefix+"signing_key"] = string(data)
+		return nil
+	}
+	if err := add("", k.SigningKey); err != nil {
+		return err
+	}
+	if k.Retiring != nil {
+		secrets["retiring_jwt_secret"] = k.Retiring.JwtSecret
+		secrets["retiring_public_jwt"] = k.Retiring.PublicJwt
+		secrets["retiring_private_jwt"] = k.Retiring.PrivateJwt
+		if err := add("retiring_", k.Retiring.SigningKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotatedKeys the keys a rotation persisted in secrets (see addRotatedSecrets), re-minted; nil unless keys were rotated
+func rotatedKeys(secrets map[string]string) (*KeysConfig, error) {
+	if secrets["keys_rotated"] != "true" {
+		return nil, nil
+	}
+	key := func(prefix string) (*SigningKey, error) {
+		data := secrets[prefix+"signing_key"]
+		if data == "" {
+			return nil, nil
+		}
+		algorithm := SigningAlgorithm(secrets[prefix+"signing_algorithm"])
+		return StaticSigningKey(algorithm)([]byte(data))()
+	}
+	keys := &KeysConfig{JwtSecret: secrets["jwt_secret"], keyIDs: true, rotated: true}
+	var err error
+	if keys.SigningKey, err = key(""); err != nil {
+		return nil, err
+	}
+	if secrets["retiring_public_jwt"] != "" {
+		keys.Retiring = &RetiringKeysConfig{
+			JwtSecret:  secrets["retiring_jwt_secret"],
+			PublicJwt:  secrets["retiring_public_jwt"],
+			PrivateJwt: secrets["retiring_private_jwt"],
+		}
+		if keys.Retiring.SigningKey, err = key("retiring_"); err != nil {
+			return nil, err
+		}
+	}
+	if err := keys.mint(); err != nil {
+		return nil, fmt.Errorf("failed to mint rotated keys: %w", err)
+	}
+	return keys, nil
+}
+
+// applyKeys switches the config to keys, and recreates the services depending on them
+// The caller must hold sg.mu
+func (sg *SupaGo) applyKeys(ctx context.Context, keys KeysConfig) error {
+	previous := sg.config.Keys
+	sg.config.Keys = keys
+
+	// services not yet started pick up the keys whenever they are
+	if sg.docker == nil || sg.network == nil {
+		return nil
+	}
+
+	// the database only stores the secret for use by SQL (e.g., app.settings.jwt_secret)
+	if keys.JwtSecret != previous.JwtSecret {
+		if err := sg.updateDatabaseJwtSecret(ctx, keys.JwtSecret); err != nil {
+			return err
+		}
+	}
+
+	return sg.recreate(ctx, func(service *Service) bool {
+		return slices.ContainsFunc(keyDependentServices, service.hasAlias)
+	})
+}
+
+// updateDatabaseJwtSecret updates app.settings.jwt_secret (if the database is running)
+// The caller must hold sg.mu
+func (sg *SupaGo) updateDatabaseJwtSecret(ctx context.Context, secret string) error {
+	if db := sg.databaseService(); db == nil || db.container == nil {
+		return nil
+	}
+	sql := fmt.Sprintf(`ALTER DATABASE postgres SET "app.settings.jwt_secret" TO %s;`, utils.QuoteLiteral(secret))
+	if _, err := sg.psql(ctx, "supabase_admin", "postgres", "-c", sql); err != nil {
+		return fmt.Errorf("failed to update database jwt secret: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package supago
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRotateKeysPersisted(t *testing.T) {
+	dir := t.TempDir()
+	build := func() *Config {
+		t.Helper()
+		cfg, err := ConfigBuilder().Platform("rotationtest").DataDirectory(dir).SigningAlgorithm(SigningAlgorithmES256).BuildE()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+	cfg := build()
+	original, err := cfg.Keys.SigningKey.KeyID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a nil getter rotates to a new key of the same algorithm
+	sg := New(cfg)
+	keys, err := sg.RotateKeys(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if keys.SigningKey == nil || keys.SigningKey.Algorithm != SigningAlgorithmES256 {
+		t.Fatalf("expected a new ES256 signing key, got %+v", keys.SigningKey)
+	}
+	rotated, err := keys.SigningKey.KeyID()
+	if err != nil {
+		t.Fatal(err)
+	} else if rotated == original {
+		t.Fatal("expected a new signing key")
+	}
+
+	// building the config again (e.g., after a restart) restores the rotation
+	rebuilt := build()
+	if id, err := rebuilt.Keys.SigningKey.KeyID(); err != nil || id != rotated {
+		t.Errorf("expected the rotated signing key after a rebuild, got %q (%v)", id, err)
+	} else if rebuilt.Keys.Retiring == nil || rebuilt.Keys.Retiring.SigningKey == nil {
+		t.Errorf("expected the retiring key after a rebuild")
+	} else if id, err := rebuilt.Keys.Retiring.SigningKey.KeyID(); err != nil || id != original {
+		t.Errorf("expected the original key to be retiring, got %q (%v)", id, err)
+	} else if rebuilt.Keys.Retiring.PublicJwt != keys.Retiring.PublicJwt {
+		t.Errorf("expected the retiring anon key to be kept")
+	} else if _, err := rebuilt.VerifyToken(keys.PrivateJwt, VerifyOptions{AllowServiceRole: true}); err != nil {
+		t.Errorf("expected the rotated service key to be valid after a rebuild, got %v", err)
+	}
+
+	if err := sg.RetireKeys(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt = build()
+	if id, err := rebuilt.Keys.SigningKey.KeyID(); err != nil || id != rotated {
+		t.Errorf("expected the rotated signing key after retiring, got %q (%v)", id, err)
+	} else if rebuilt.Keys.Retiring != nil {
+		t.Errorf("expected no retiring keys after retiring")
+	}
+}
+
+func TestRotateKeysSharedSecret(t *testing.T) {
+	cfg, err := ConfigBuilder().Platform("rotationtest").DataDirectory(t.TempDir()).BuildE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := New(cfg).RotateKeys(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if keys.SigningKey != nil || keys.JwtSecret == cfg.Keys.JwtSecret {
+		t.Errorf("expected a new shared secret, got signing key %v", keys.SigningKey)
+	}
+}
@@ -0,0 +1,145 @@
+package supago
+
+import (
+	"context"
+	"fmt"
+	"github.com/train360-corp/supago/internal/migrations"
+	"github.com/train360-corp/supago/internal/utils"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// migrationsTableSQL the bookkeeping table (shared with the Supabase CLI, so either can apply migrations)
+const migrationsTableSQL = `
+CREATE SCHEMA IF NOT EXISTS supabase_migrations AUTHORIZATION postgres;
+CREATE TABLE IF NOT EXISTS supabase_migrations.schema_migrations (
+	version    text NOT NULL PRIMARY KEY,
+	statements text[],
+	name       text
+);
+ALTER TABLE supabase_migrations.schema_migrations OWNER TO postgres;
+`
+
+// migrationsContainerDirectory where migration files are copied to (inside the database container) to be applied
+const migrationsContainerDirectory = "/tmp/supago/migrations"
+
+// AddMigrations registers ordered SQL migrations (at the root of source; e.g., an embed.FS of supabase/migrations)
+// Files are named "<version>_<name>.sql" and applied in (numeric) version order, once started services are healthy.
+// Each file is applied (and recorded in supabase_migrations.schema_migrations) in its own transaction, so files
+// must not contain their own transaction control statements. Run fails if any migration does.
+func (sg *SupaGo) AddMigrations(source fs.FS) *SupaGo {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+	sg.migrations = append(sg.migrations, source)
+	return sg
+}
+
+// Migrate applies any pending migrations registered with AddMigrations (this happens automatically during Run)
+func (sg *SupaGo) Migrate(ctx context.Context) error {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+	_, err := sg.migrate(ctx)
+	return err
+}
+
+// migrate applies pending migrations, returning how many were applied
+// The caller must hold sg.mu
+func (sg *SupaGo) migrate(ctx context.Context) (int, error) {
+	if len(sg.migrations) == 0 {
+		return 0, nil
+	}
+
+	var pending []migrations.Migration
+	files := map[string]fs.FS{}
+	for _, source := range sg.migrations {
+		collected, err := migrations.Collect(source)
+		if err != nil {
+			return 0, err
+		}
+		for _, migration := range collected {
+			files[migration.Version] = source
+		}
+		pending = append(pending, collected...)
+	}
+	if err := migrations.Sort(pending); err != nil {
+		return 0, err
+	}
+
+	if _, err := sg.psql(ctx, "supabase_admin", "postgres", "-c", migrationsTableSQL); err != nil {
+		return 0, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	applied, err := sg.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, migration := range pending {
+		if applied[strings.TrimLeft(migration.Version, "0")] {
+			continue
+		}
+		data, err := fs.ReadFile(files[migration.Version], migration.Path)
+		if err != nil {
+			return count, fmt.Errorf("failed to read migration %s: %w", migration.File(), err)
+		}
+
+		sg.logger.Infof("applying migration %s", migration.File())
+		started := time.Now()
+		if err := sg.applyMigration(ctx, migration, data); err != nil {
+			return count, fmt.Errorf("migration %s failed: %w", migration.File(), err)
+		}
+		sg.logger.Debugf("applied migration %s (%v)", migration.File(), time.Since(started))
+		count++
+	}
+
+	if count > 0 {
+		sg.logger.Infof("applied %d migration(s)", count)
+		if err := sg.reloadSchemaCache(ctx); err != nil {
+			return count, err
+		}
+	} else {
+		sg.logger.Debugf("no pending migrations")
+	}
+	return count, nil
+}
+
+// appliedMigrations the (zero-trimmed) versions already recorded as applied
+// The caller must hold sg.mu
+func (sg *SupaGo) appliedMigrations(ctx context.Context) (map[string]bool, error) {
+	output, err := sg.psql(ctx, "postgres", "postgres", "-At", "-c", "SELECT version FROM supabase_migrations.schema_migrations;")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applied migrations: %w", err)
+	}
+	applied := map[string]bool{}
+	for _, line := range strings.Split(output, "\n") {
+		if version := strings.TrimSpace(line); version != "" {
+			applied[strings.TrimLeft(version, "0")] = true
+		}
+	}
+	return applied, nil
+}
+
+// applyMigration runs a single migration file, and records it, in one transaction
+// The caller must hold sg.mu
+func (sg *SupaGo) applyMigration(ctx context.Context, migration migrations.Migration, data []byte) error {
+	db := sg.databaseService()
+	file := path.Join(migrationsContainerDirectory, migration.File())
+	if err := utils.CopyToContainer(ctx, sg.docker, db.container.ID, EmbeddedFile{Data: data, Path: file}); err != nil {
+		return fmt.Errorf("failed to copy migration into container: %w", err)
+	}
+	defer func() {
+		_, _ = utils.ExecInContainer(context.Background(), sg.docker, db.container.ID, []string{"rm", "-f", file})
+	}()
+
+	_, err := sg.psql(ctx, "postgres", "postgres",
+		"--single-transaction",
+		"-f", file,
+		"-c", fmt.Sprintf(
+			"INSERT INTO supabase_migrations.schema_migrations (version, name) VALUES (%s, %s);",
+			utils.QuoteLiteral(migration.Version), utils.QuoteLiteral(migration.Name),
+		),
+	)
+	return err
+}
@@ -11,8 +11,12 @@ import (
 	"github.com/docker/go-connections/nat"
 	"github.com/train360-corp/supago/internal/utils"
 	"io"
+	"net"
 	"regexp"
+	"runtime"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -61,19 +65,16 @@ func (sg *SupaGo) ensureNetwork(ctx context.Context) error {
 		if nets, err := sg.docker.NetworkList(ctx, network.ListOptions{Filters: args}); err != nil {
 			sg.logger.Debugf("failed to list networks: %v", err)
 			return fmt.Errorf("failed to list networks: %v", err)
-		} else if len(nets) == 0 {
+		} else if nets = exactNetworks(nets, sg.config.Global.PlatformName); len(nets) == 0 {
 			if triedCreate { // guard for infinite recursion
 				sg.logger.Errorf("tried to create network but still not found")
 				return fmt.Errorf("tried to create network but still not found")
 			}
 			sg.logger.Debugf("no existing network found; attempting to create a new network")
 			if _, err := sg.docker.NetworkCreate(ctx, sg.config.Global.PlatformName, network.CreateOptions{
-				Driver: "bridge",
-				Scope:  "local",
-				IPAM: &network.IPAM{
-					Driver: "default",
-					Config: []network.IPAMConfig{{Subnet: "172.30.0.0/16"}},
-				},
+				Driver:     "bridge",
+				Scope:      "local",
+				IPAM:       ipam(sg.config.Global.Subnet),
 				EnableIPv4: utils.Pointer(true),
 				EnableIPv6: utils.Pointer(true),
 				Internal:   false, // true = no external connectivity (usually keep false)
@@ -100,16 +101,77 @@ func (sg *SupaGo) ensureNetwork(ctx context.Context) error {
 	return queryNets(false)
 }
 
+// exactNetworks the networks named name (docker's name filter also matches substrings, e.g., a clone's "app-preview"
+// for "app")
+func exactNetworks(nets []network.Summary, name string) []network.Summary {
+	return slices.DeleteFunc(nets, func(n network.Summary) bool { return n.Name != name })
+}
+
+// ipam the network's address management (a docker-assigned subnet if subnet is empty)
+func ipam(subnet string) *network.IPAM {
+	config := &network.IPAM{Driver: "default"}
+	if subnet != "" {
+		config.Config = []network.IPAMConfig{{Subnet: subnet}}
+	}
+	return config
+}
+
+// hostGateway the address containers on the network reach the host on: on Linux, the network's (IPv4) gateway, which
+// the host holds on the network's bridge; elsewhere (e.g., Docker Desktop, where the network lives in a VM), "" (docker's
+// host-gateway forwards to the host's loopback instead)
+func (sg *SupaGo) hostGateway(ctx context.Context) (string, error) {
+	if runtime.GOOS != "linux" {
+		return "", nil
+	} else if sg.network == nil {
+		return "", fmt.Errorf("network not initialized")
+	}
+	configs := sg.network.IPAM.Config
+	if len(configs) == 0 { // listed networks may omit their IPAM config
+		inspect, err := sg.docker.NetworkInspect(ctx, sg.network.ID, network.InspectOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to inspect network: %v", err)
+		}
+		configs = inspect.IPAM.Config
+	}
+	for _, config := range configs {
+		if ip := net.ParseIP(config.Gateway); ip != nil && ip.To4() != nil {
+			return config.Gateway, nil
+		}
+	}
+	return "", fmt.Errorf("network %s has no IPv4 gateway", sg.network.Name)
+}
+
+// extraHosts the service's extra hosts, with host-gateway resolved to the network's gateway (see hostGateway)
+func (sg *SupaGo) extraHosts(ctx context.Context, svc *Service) ([]string, error) {
+	hosts := make([]string, 0, len(svc.ExtraHosts))
+	for _, host := range svc.ExtraHosts {
+		if name, ok := strings.CutSuffix(host, ":host-gateway"); ok {
+			gateway, err := sg.hostGateway(ctx)
+			if err != nil {
+				return nil, err
+			} else if gateway != "" {
+				host = name + ":" + gateway
+			}
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
 func ports(svc *Service) (nat.PortSet, nat.PortMap) {
 	exposedPorts := nat.PortSet{}
 	portBindings := nat.PortMap{}
 	for _, p := range svc.Ports {
 		port := nat.Port(fmt.Sprintf("%d/tcp", p))
+		hostPort := p
+		if mapped, ok := svc.HostPorts[p]; ok {
+			hostPort = mapped
+		}
 		exposedPorts[port] = struct{}{}
 		portBindings[port] = []nat.PortBinding{
 			{
 				HostIP:   "127.0.0.1",
-				HostPort: strconv.Itoa(int(p)),
+				HostPort: strconv.Itoa(int(hostPort)),
 			},
 		}
 	}
@@ -159,13 +221,19 @@ func (sg *SupaGo) createContainer(ctx context.Context, svc *Service) (*container
 		svc.Labels["com.docker.compose.project"] = "supago"
 	}
 
+	extraHosts, err := sg.extraHosts(ctx, svc)
+	if err != nil {
+		sg.logger.Errorf("failed to resolve extra hosts for %v: %v", svc, err)
+		return nil, fmt.Errorf("failed to resolve extra hosts for %v: %v", svc, err)
+	}
+
 	exposedPorts, portBindings := ports(svc)
 	if resp, err := sg.docker.ContainerCreate(ctx,
 		&container.Config{
 			Image:        svc.Image,
 			Entrypoint:   svc.Entrypoint,
 			Cmd:          svc.Cmd,
-			Env:          svc.Env,
+			Env:          svc.environment(),
 			OpenStdin:    false,
 			StdinOnce:    false,
 			Tty:          false,
@@ -178,6 +246,7 @@ func (sg *SupaGo) createContainer(ctx context.Context, svc *Service) (*container
 			NetworkMode:   container.NetworkMode(sg.network.Name),
 			Mounts:        svc.Mounts,
 			PortBindings:  portBindings,
+			ExtraHosts:    extraHosts,
 		},
 		&network.NetworkingConfig{
 			EndpointsConfig: map[string]*network.EndpointSettings{
@@ -0,0 +1,16 @@
+package supago
+
+import (
+	"github.com/docker/docker/api/types/network"
+	"testing"
+)
+
+func TestExactNetworks(t *testing.T) {
+	nets := exactNetworks([]network.Summary{{Name: "app-preview"}, {Name: "app"}, {Name: "my-app"}}, "app")
+	if len(nets) != 1 || nets[0].Name != "app" {
+		t.Errorf("expected only the network named app, got %v", nets)
+	}
+	if nets := exactNetworks([]network.Summary{{Name: "app-preview"}}, "app"); len(nets) != 0 {
+		t.Errorf("expected no networks, got %v", nets)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/docker/docker/client"
 	"github.com/train360-corp/supago/internal/utils"
 	"go.uber.org/zap"
+	"io/fs"
+	"net/http"
 	"regexp"
 	"sync"
 )
@@ -25,6 +27,12 @@ type SupaGo struct {
 	mu       sync.Mutex
 	docker   *client.Client
 	network  *network.Summary
+	// migrations sources of SQL migrations applied once services are started
+	migrations []fs.FS
+	// seeds run after migrations when the database is freshly initialized
+	seeds []seed
+	// callbacks serves the auth container's hooks (while running)
+	callbacks *http.Server
 }
 
 func constructor(config Config) *SupaGo {
@@ -49,29 +57,42 @@ func (sg *SupaGo) SetLogger(logger *zap.SugaredLogger) *SupaGo {
 	return sg
 }
 
-func (sg *SupaGo) AddServices(constructors func() []ServiceConstructor) *SupaGo {
+// AddServices adds the services constructors returns (e.g., Services.All); none are added if one fails to construct
+func (sg *SupaGo) AddServices(constructors func() []ServiceConstructor) (*SupaGo, error) {
+	return sg.addServices(constructors())
+}
+
+// AddService adds services; none are added if one fails to construct
+func (sg *SupaGo) AddService(constructor ServiceConstructor, constructors ...ServiceConstructor) (*SupaGo, error) {
+	return sg.addServices(append([]ServiceConstructor{constructor}, constructors...))
+}
+
+func (sg *SupaGo) addServices(constructors []ServiceConstructor) (*SupaGo, error) {
 	sg.mu.Lock()
 	defer sg.mu.Unlock()
-	if sg.services == nil {
-		sg.services = []*Service{}
-	}
-	for _, constructor := range constructors() {
-		sg.services = append(sg.services, utils.Pointer(constructor(sg.config)))
+	services := make([]*Service, 0, len(constructors))
+	for _, constructor := range constructors {
+		service, err := sg.construct(constructor)
+		if err != nil {
+			return sg, err
+		}
+		services = append(services, service)
 	}
-	return sg
+	sg.services = append(sg.services, services...)
+	return sg, nil
 }
 
-func (sg *SupaGo) AddService(constructor ServiceConstructor, constructors ...ServiceConstructor) *SupaGo {
-	sg.mu.Lock()
-	defer sg.mu.Unlock()
-	if sg.services == nil {
-		sg.services = []*Service{}
+// construct builds a service from the current config, remembering its constructor so it can be recreated later
+func (sg *SupaGo) construct(constructor ServiceConstructor) (*Service, error) {
+	if constructor == nil {
+		return nil, errors.New("failed to construct service: nil constructor")
 	}
-	sg.services = append(sg.services, utils.Pointer(constructor(sg.config)))
-	for _, constructor := range constructors {
-		sg.services = append(sg.services, utils.Pointer(constructor(sg.config)))
+	service, err := constructor(sg.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct service: %w", err)
 	}
-	return sg
+	service.constructor = constructor
+	return &service, nil
 }
 
 // Run start and serve all services attached to the SupaGo instance
@@ -102,6 +123,7 @@ func (sg *SupaGo) Stop() {
 			}
 		}(sg.services[len(sg.services)-i-1]) // in reverse (for dependencies)
 	}
+	sg.stopAuthCallbacks()
 }
 
 func (sg *SupaGo) run(ctx context.Context, forcefully bool) error {
@@ -124,105 +146,206 @@ func (sg *SupaGo) run(ctx context.Context, forcefully bool) error {
 		return err
 	}
 
+	return sg.start(ctx, forcefully)
+}
+
+// start starts every service, then applies migrations (and seeds a freshly initialized database)
+// The caller must hold sg.mu (with docker and its network set up)
+func (sg *SupaGo) start(ctx context.Context, forcefully bool) error {
+
+	// refuse to start the database on a data directory of another postgres version
+	if err := sg.checkDataDirectoryVersion(ctx); err != nil {
+		sg.logger.Error(err.Error())
+		return err
+	}
+
+	// serve the auth container's hooks before it starts
+	if err := sg.serveAuthCallbacks(ctx); err != nil {
+		sg.logger.Error(err.Error())
+		return err
+	}
+
+	// whether the database will be initialized by this run (checked before it starts)
+	freshDatabase := sg.databaseService() != nil && isUninitializedDataDirectory(sg.config.Database.DataDirectory)
+
 	// start each service
 	for _, service := range sg.services {
-
-		// pull image
-		if err := sg.pullImage(ctx, service); err != nil {
-			e := fmt.Sprintf("failed to pull image: %v", err)
-			err := fmt.Errorf(e)
-			sg.logger.Error(e)
+		if err := sg.startService(ctx, service, forcefully); err != nil {
 			return err
 		}
+	}
 
-		if forcefully { // always pre-attempt to remove container when forceful
-			sg.removeContainerByName(ctx, service.Name)
-		}
+	sg.logger.Info("all services started")
 
-		// create container
-		if ctr, err := sg.createContainer(ctx, service); err != nil {
-			return err
-		} else if ctr == nil {
-			e := fmt.Sprintf("failed to create container: %v", "container unexpectedly nil")
+	// apply migrations
+	if _, err := sg.migrate(ctx); err != nil {
+		e := fmt.Sprintf("failed to apply migrations: %v", err)
+		err := fmt.Errorf(e)
+		sg.logger.Error(e)
+		return err
+	}
+
+	// load seeds
+	if freshDatabase {
+		if err := sg.seed(ctx); err != nil {
+			e := fmt.Sprintf("failed to load seeds: %v", err)
 			err := fmt.Errorf(e)
 			sg.logger.Error(e)
 			return err
-		} else {
-			service.container = ctr
 		}
+	} else if len(sg.seeds) > 0 {
+		sg.logger.Debug("skipping seeds (database already initialized)")
+	}
 
-		// write any embedded files
-		for _, file := range service.EmbeddedFiles {
-			if err := utils.CopyToContainer(
-				ctx,
-				sg.docker,
-				service.container.ID,
-				file,
-			); err != nil {
-				e := fmt.Sprintf("failed to create file in container: %v", err)
-				sg.logger.Error(e)
-				return errors.New(e)
-			}
-		}
+	return nil
+}
 
-		// start container
-		if err := sg.startContainer(ctx, service); err != nil {
-			e := fmt.Sprintf("failed to start container for %v: %v", service, err)
-			err := fmt.Errorf(e)
+// startService pulls, creates, starts, healthchecks and attaches to the container of a single service
+func (sg *SupaGo) startService(ctx context.Context, service *Service, forcefully bool) error {
+
+	// pull image
+	if err := sg.pullImage(ctx, service); err != nil {
+		e := fmt.Sprintf("failed to pull image: %v", err)
+		err := fmt.Errorf(e)
+		sg.logger.Error(e)
+		return err
+	}
+
+	if forcefully { // always pre-attempt to remove container when forceful
+		sg.removeContainerByName(ctx, service.Name)
+	}
+
+	// create container
+	if ctr, err := sg.createContainer(ctx, service); err != nil {
+		return err
+	} else if ctr == nil {
+		e := fmt.Sprintf("failed to create container: %v", "container unexpectedly nil")
+		err := fmt.Errorf(e)
+		sg.logger.Error(e)
+		return err
+	} else {
+		service.container = ctr
+	}
+
+	// write any embedded files
+	for _, file := range service.EmbeddedFiles {
+		if err := utils.CopyToContainer(
+			ctx,
+			sg.docker,
+			service.container.ID,
+			file,
+		); err != nil {
+			e := fmt.Sprintf("failed to create file in container: %v", err)
 			sg.logger.Error(e)
-			return err
+			return errors.New(e)
 		}
+	}
 
-		// listen to container status
-		sg.logger.Debugf("listening to %v container %s status", service, utils.ShortStr(service.container.ID))
-		statusCh, errCh := sg.docker.ContainerWait(context.Background(), service.container.ID, container.WaitConditionNotRunning)
-		go func() {
-			select {
-			case err := <-errCh:
-				if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
-					sg.logger.Errorf("wait error for %v container %s: %v", service, utils.ShortStr(service.container.ID), err)
-				} else {
-					sg.logger.Debugf("wait exited (context-cancelled) for %v container %s", service, utils.ShortStr(service.container.ID))
-				}
-			case st := <-statusCh: // container exited (possibly immediately)
-				sg.logger.Warnf("%v container %s exited with status: %v", service, utils.ShortStr(service.container.ID), st.StatusCode)
-			}
-		}()
+	// start container
+	if err := sg.startContainer(ctx, service); err != nil {
+		e := fmt.Sprintf("failed to start container for %v: %v", service, err)
+		err := fmt.Errorf(e)
+		sg.logger.Error(e)
+		return err
+	}
 
-		// healthcheck
-		if err := sg.healthcheckContainer(ctx, service, 0); err != nil {
-			e := fmt.Sprintf("failed to healthcheck container for %v: %v", service, err)
+	// healthcheck
+	if err := sg.healthcheckContainer(ctx, service, 0); err != nil {
+		e := fmt.Sprintf("failed to healthcheck container for %v: %v", service, err)
+		err := fmt.Errorf(e)
+		sg.logger.Error(e)
+		return err
+	}
+
+	// AfterStart
+	if service.AfterStart != nil {
+		sg.logger.Debugf("running AfterStart for %v", service)
+		if err := service.AfterStart(ctx, sg.docker, service.container.ID); err != nil {
+			e := fmt.Sprintf("AfterStart failed for %v: %v", service, err)
 			err := fmt.Errorf(e)
 			sg.logger.Error(e)
 			return err
 		}
+	}
 
-		// AfterStart
-		if service.AfterStart != nil {
-			sg.logger.Debugf("running AfterStart for %v", service)
-			if err := service.AfterStart(ctx, sg.docker, service.container.ID); err != nil {
-				e := fmt.Sprintf("AfterStart failed for %v: %v", service, err)
-				err := fmt.Errorf(e)
-				sg.logger.Error(e)
-				return err
+	// listen to container status (after AfterStart, which may restart the container, e.g., to preload libraries)
+	sg.logger.Debugf("listening to %v container %s status", service, utils.ShortStr(service.container.ID))
+	statusCh, errCh := sg.docker.ContainerWait(context.Background(), service.container.ID, container.WaitConditionNotRunning)
+	go func(cid string) { // container id captured, since a recreated service gets a new container
+		select {
+		case err := <-errCh:
+			if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+				sg.logger.Errorf("wait error for %v container %s: %v", service, utils.ShortStr(cid), err)
+			} else {
+				sg.logger.Debugf("wait exited (context-cancelled) for %v container %s", service, utils.ShortStr(cid))
 			}
+		case st := <-statusCh: // container exited (possibly immediately)
+			sg.logger.Warnf("%v container %s exited with status: %v", service, utils.ShortStr(cid), st.StatusCode)
 		}
+	}(service.container.ID)
+
+	// attach to container (keep this connection open while app is alive)
+	if att, err := sg.docker.ContainerAttach(context.Background(), service.container.ID, container.AttachOptions{
+		Stdin:  true,
+		Stream: true,
+		Stdout: false,
+		Stderr: false,
+	}); err != nil {
+		sg.logger.Errorf("attach failed for %v container %s: %v", service, utils.ShortStr(service.container.ID), err)
+	} else {
+		service.closeConn = att.Close
+		sg.logger.Infof("%v started (container %s)", service, utils.ShortStr(service.container.ID))
+	}
 
-		// attach to container (keep this connection open while app is alive)
-		if att, err := sg.docker.ContainerAttach(context.Background(), service.container.ID, container.AttachOptions{
-			Stdin:  true,
-			Stream: true,
-			Stdout: false,
-			Stderr: false,
-		}); err != nil {
-			sg.logger.Errorf("attach failed for %v container %s: %v", service, utils.ShortStr(service.container.ID), err)
-		} else {
-			service.closeConn = att.Close
-			sg.logger.Infof("%v started (container %s)", service, utils.ShortStr(service.container.ID))
+	return nil
+}
+
+// removeServices stops and removes the container of every service (in reverse, for dependencies)
+// The caller must hold sg.mu
+func (sg *SupaGo) removeServices() {
+	for i := range sg.services {
+		service := sg.services[len(sg.services)-i-1]
+		if service.closeConn != nil {
+			service.closeConn()
 		}
+		sg.stopContainer(service)
+		sg.removeContainer(service)
+		service.container, service.closeConn = nil, nil
 	}
+}
 
-	sg.logger.Info("all services started")
+// recreate rebuilds (from the current config), and restarts, every running service matching match; in start order
+// The caller must hold sg.mu
+func (sg *SupaGo) recreate(ctx context.Context, match func(service *Service) bool) error {
+	if sg.docker == nil || sg.network == nil {
+		return errors.New("services are not running")
+	}
+
+	for _, service := range sg.services {
+		if !match(service) {
+			continue
+		} else if service.constructor == nil {
+			sg.logger.Warnf("%v cannot be recreated (no constructor); skipping", service)
+			continue
+		}
+
+		sg.logger.Infof("recreating %v", service)
+		if service.closeConn != nil {
+			service.closeConn()
+		}
+		sg.stopContainer(service)
+		sg.removeContainer(service)
+
+		rebuilt, err := sg.construct(service.constructor)
+		if err != nil {
+			return fmt.Errorf("failed to recreate %v: %w", service, err)
+		}
+		*service = *rebuilt
+
+		if err := sg.startService(ctx, service, true); err != nil {
+			return fmt.Errorf("failed to recreate %v: %w", service, err)
+		}
+	}
 
 	return nil
 }
@@ -0,0 +1,56 @@
+package supago
+
+import (
+	"fmt"
+	"github.com/train360-corp/supago/internal/pgconf"
+	"maps"
+	"regexp"
+)
+
+const (
+	postgresBaseConfigFile = "/etc/postgresql/postgresql.conf"    // shipped with the image
+	postgresConfigFile     = "/etc/postgresql-custom/supago.conf" // generated (includes the image's)
+)
+
+// preloadLibrariesRegex a shared_preload_libraries line of a configuration file
+var preloadLibrariesRegex = regexp.MustCompile(`(?m)^\s*shared_preload_libraries\s*=`)
+
+// postgresDefaults settings SupaGo starts postgres with, unless overridden
+var postgresDefaults = map[string]string{
+	"log_min_messages": "error",
+}
+
+// postgresConfig the server configuration file: the image's, overridden by the defaults, Memory, ConfigFile and Settings
+func (d DatabaseConfig) postgresConfig() ([]byte, error) {
+	defaults := maps.Clone(postgresDefaults)
+	if d.Memory > 0 {
+		maps.Copy(defaults, pgconf.MemoryPreset(d.Memory))
+	}
+	return pgconf.Render(postgresBaseConfigFile, defaults, d.ConfigFile, d.Settings)
+}
+
+// validatePostgresConfig checks the server configuration overrides
+func (d DatabaseConfig) validatePostgresConfig() error {
+	if d.Memory < 0 {
+		return fmt.Errorf("database memory must not be negative, got %d", d.Memory)
+	} else if d.Memory > 0 && d.Memory < 256<<20 {
+		return fmt.Errorf("database memory must be at least 256MB, got %d bytes", d.Memory)
+	}
+	for name := range d.Settings {
+		if !pgconf.ValidName(name) {
+			return fmt.Errorf("invalid postgres setting name %q", name)
+		}
+		switch name {
+		case "config_file", "data_directory", "hba_file", "ident_file", "archive_mode", "archive_command", "restore_command":
+			return fmt.Errorf("postgres setting %q is managed by supago", name)
+		}
+	}
+	return nil
+}
+
+// explicitPreloadLibraries whether shared_preload_libraries is set explicitly (through Settings or ConfigFile), rather
+// than managed for the extensions
+func (d DatabaseConfig) explicitPreloadLibraries() bool {
+	_, ok := d.Settings["shared_preload_libraries"]
+	return ok || preloadLibrariesRegex.Match(d.ConfigFile)
+}
@@ -0,0 +1,21 @@
+package supago
+
+import "testing"
+
+func TestExplicitPreloadLibraries(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		database DatabaseConfig
+		explicit bool
+	}{
+		{"unset", DatabaseConfig{}, false},
+		{"other settings", DatabaseConfig{Settings: map[string]string{"max_connections": "200"}}, false},
+		{"setting", DatabaseConfig{Settings: map[string]string{"shared_preload_libraries": "pg_cron"}}, true},
+		{"config file", DatabaseConfig{ConfigFile: []byte("max_connections = 200\n  shared_preload_libraries = 'pg_cron'\n")}, true},
+		{"commented out", DatabaseConfig{ConfigFile: []byte("#shared_preload_libraries = 'pg_cron'\n")}, false},
+	} {
+		if got := tc.database.explicitPreloadLibraries(); got != tc.explicit {
+			t.Errorf("%s: expect %v, got %v", tc.name, tc.explicit, got)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package supago
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/client"
+	"github.com/train360-corp/supago/internal/utils"
+	"strings"
+)
+
+// psql runs psql (with args) inside the database container, as user against dbname
+// The caller must hold sg.mu
+func (sg *SupaGo) psql(ctx context.Context, user, dbname string, args ...string) (string, error) {
+	db := sg.databaseService()
+	if db == nil || db.container == nil || sg.docker == nil {
+		return "", errors.New("database is not running")
+	}
+	return execPsql(ctx, sg.docker, db.container.ID, user, dbname, args...)
+}
+
+// execPsql runs psql (with args) inside container cid, as user against dbname
+// It connects over the trusted local connection (PGPASSWORD is ignored), and stops on the first error.
+func execPsql(ctx context.Context, docker *client.Client, cid string, user, dbname string, args ...string) (string, error) {
+	cmd := append([]string{
+		"env", "-u", "PGPASSWORD",
+		"psql",
+		"-X", // ignore any psqlrc
+		"-h", "127.0.0.1",
+		"-U", user,
+		"-d", dbname,
+		"-v", "ON_ERROR_STOP=1",
+	}, args...)
+	output, err := utils.ExecInContainer(ctx, docker, cid, cmd)
+	if err != nil {
+		return output, fmt.Errorf("%v (%s)", err, strings.ReplaceAll(strings.TrimSpace(output), "\n", "\\n"))
+	}
+	return output, nil
+}
+
+// databaseService the service running the database (nil if not added)
+// The caller must hold sg.mu
+func (sg *SupaGo) databaseService() *Service {
+	for _, service := range sg.services {
+		if service.hasAlias("db") {
+			return service
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package supago
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/train360-corp/supago/internal/utils"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+type RecoveryResult struct {
+	// BaseBackup the base backup recovery started from
+	BaseBackup BaseBackup
+	// PreviousDataDirectory where the replaced data directory was moved to
+	PreviousDataDirectory string
+	Duration              time.Duration
+}
+
+// RecoverTo rebuilds the database's data directory as of target (point-in-time recovery), from the archive
+// The newest base backup completed before target is restored, and the archived WAL is replayed up to target (or to
+// the end of the archive if target is zero). With S3 configured, the archive is first completed from the bucket. The
+// stack is stopped meanwhile; the current data directory is moved aside (see RecoveryResult.PreviousDataDirectory).
+func (sg *SupaGo) RecoverTo(ctx context.Context, target time.Time) (*RecoveryResult, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	started := time.Now()
+	archive := sg.config.Database.Archive
+	db := sg.databaseService()
+	if archive == nil {
+		return nil, errors.New("archiving is not configured")
+	} else if db == nil {
+		return nil, errors.New("no database service")
+	} else if sg.docker == nil || sg.network == nil {
+		return nil, errors.New("services are not running")
+	}
+
+	if archive.S3 != nil {
+		bucket, err := archive.s3()
+		if err != nil {
+			return nil, err
+		}
+		sg.logger.Infof("downloading archive from s3")
+		if err := downloadArchive(ctx, *archive, bucket); err != nil {
+			return nil, err
+		}
+	}
+
+	// the newest base backup the target can be recovered from
+	backups, err := readBaseBackups(archive.Directory)
+	if err != nil {
+		return nil, err
+	}
+	result := &RecoveryResult{}
+	var found bool
+	for _, backup := range backups {
+		if target.IsZero() || !backup.StopTime.After(target) {
+			result.BaseBackup, found = backup, true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no base backup completed before %s", target.UTC().Format(time.RFC3339))
+	}
+
+	sg.logger.Infow("recovering database",
+		"target", target,
+		"base_backup", result.BaseBackup.Label,
+	)
+
+	// stop the stack, and move the data directory aside
+	sg.removeServices()
+	dir := sg.config.Database.DataDirectory
+	result.PreviousDataDirectory = fmt.Sprintf("%s.pre-recovery-%s", dir, time.Now().UTC().Format("20060102T150405Z"))
+	if err := os.Rename(dir, result.PreviousDataDirectory); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to move data directory aside: %w", err)
+	}
+	sg.logger.Infof("moved data directory \"%s\" to \"%s\"", dir, result.PreviousDataDirectory)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	// restore the base backup, and configure recovery (the settings are reset once recovered)
+	settings := []string{"recovery_target_action = 'promote'"}
+	if !target.IsZero() {
+		settings = append(settings, "recovery_target_time = "+utils.QuoteLiteral(target.UTC().Format("2006-01-02 15:04:05.999999Z")))
+	}
+	base := path.Join(archiveMountPath, archiveBaseDir, result.BaseBackup.Label)
+	script := strings.Join([]string{
+		"set -e",
+		fmt.Sprintf("tar -xzf %s/%s -C /var/lib/postgresql/data", base, baseBackupArchive),
+		fmt.Sprintf("cp %s/%s /var/lib/postgresql/data/", base, baseBackupLabel),
+		"mkdir -p /var/lib/postgresql/data/pg_wal",
+		"touch /var/lib/postgresql/data/recovery.signal",
+		fmt.Sprintf("printf '%%s\\n' %s >> /var/lib/postgresql/data/postgresql.auto.conf", shellQuote(settings...)),
+		"chown -R postgres:postgres /var/lib/postgresql/data",
+		"chmod 0700 /var/lib/postgresql/data",
+		"chown -R postgres " + archiveMountPath, // e.g., downloaded from s3
+	}, "\n")
+	definition, err := db.constructor(sg.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct postgres (previous data directory kept at \"%s\"): %w", result.PreviousDataDirectory, err)
+	}
+	if _, err := sg.runTask(ctx, Service{
+		Image:      definition.Image,
+		Name:       definition.Name + "-recovery",
+		Entrypoint: []string{"sh", "-c", script},
+		Mounts:     definition.Mounts,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to restore base backup (previous data directory kept at \"%s\"): %w", result.PreviousDataDirectory, err)
+	}
+
+	// start the database (replaying WAL), then everything else once it is promoted
+	rebuilt := definition
+	rebuilt.constructor = db.constructor
+	afterStart := rebuilt.AfterStart
+	rebuilt.AfterStart = func(ctx context.Context, docker *client.Client, cid string) error {
+		if err := awaitRecovery(ctx, docker, cid); err != nil {
+			return err
+		}
+		if afterStart != nil {
+			return afterStart(ctx, docker, cid)
+		}
+		return nil
+	}
+	*db = rebuilt
+	if err := sg.startService(ctx, db, true); err != nil {
+		return nil, fmt.Errorf("failed to recover database (previous data directory kept at \"%s\"): %w", result.PreviousDataDirectory, err)
+	}
+	if err := sg.recreate(ctx, func(service *Service) bool { return service != db }); err != nil {
+		return nil, err
+	}
+
+	result.Duration = time.Since(started)
+	sg.logger.Infow("recovery completed",
+		"duration", result.Duration,
+		"base_backup", result.BaseBackup.Label,
+		"previous_data_directory", result.PreviousDataDirectory,
+	)
+	return result, nil
+}
+
+// awaitRecovery waits for the database in container cid to finish recovery (and be promoted), then resets the
+// recovery target settings
+func awaitRecovery(ctx context.Context, docker *client.Client, cid string) error {
+	for {
+		output, err := execPsql(ctx, docker, cid, "supabase_admin", "postgres", "-t", "-A", "-c", "SELECT pg_is_in_recovery();")
+		if err == nil && strings.TrimSpace(output) == "f" {
+			break
+		} else if err != nil {
+			if inspected, inspectErr := docker.ContainerInspect(ctx, cid); inspectErr == nil && inspected.State != nil && !inspected.State.Running {
+				return fmt.Errorf("database exited during recovery (e.g., the target is past the end of the archive): %w", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+	if _, err := execPsql(ctx, docker, cid, "supabase_admin", "postgres",
+		"-c", "ALTER SYSTEM RESET recovery_target_time;",
+		"-c", "ALTER SYSTEM RESET recovery_target_action;",
+		"-c", "SELECT pg_reload_conf();",
+	); err != nil {
+		return fmt.Errorf("failed to reset recovery settings: %w", err)
+	}
+	return nil
+}
+
+// runTask runs a one-off container to completion, returning its output; failing if it exits with a non-zero status
+// The caller must hold sg.mu
+func (sg *SupaGo) runTask(ctx context.Context, task Service) (string, error) {
+	if err := sg.pullImage(ctx, &task); err != nil {
+		return "", err
+	}
+	sg.removeContainerByName(ctx, task.Name)
+	ctr, err := sg.createContainer(ctx, &task)
+	if err != nil {
+		return "", err
+	}
+	task.container = ctr
+	defer sg.removeContainer(&task)
+
+	statusCh, errCh := sg.docker.ContainerWait(ctx, ctr.ID, container.WaitConditionNextExit)
+	if err := sg.startContainer(ctx, &task); err != nil {
+		return "", fmt.Errorf("failed to start %v: %w", task, err)
+	}
+	var status container.WaitResponse
+	select {
+	case err := <-errCh:
+		return "", fmt.Errorf("failed to wait for %v: %w", task, err)
+	case status = <-statusCh:
+	}
+
+	var output strings.Builder
+	if logs, err := sg.docker.ContainerLogs(ctx, ctr.ID, container.LogsOptions{ShowStdout: true, ShowStderr: true}); err == nil {
+		_, _ = stdcopy.StdCopy(&output, &output, logs)
+		_ = logs.Close()
+	}
+	if status.StatusCode != 0 {
+		return output.String(), fmt.Errorf("%v exited with status %d (%s)", task, status.StatusCode, strings.ReplaceAll(strings.TrimSpace(output.String()), "\n", "\\n"))
+	}
+	return output.String(), nil
+}
+
+// shellQuote each argument single-quoted for sh, space-separated
+func shellQuote(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,120 @@
+package supago
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	// restNameRegex an unquoted schema or role name
+	restNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*$`)
+	// restFunctionRegex an (optionally schema-qualified) unquoted function name
+	restFunctionRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)?$`)
+)
+
+// RestConfig how PostgREST exposes the database (zero values keep PostgREST's, or Supabase's, defaults)
+type RestConfig struct {
+	// Schemas exposed through the API, the first being the default (defaults to public and graphql_public)
+	// Custom API schemas need USAGE (and table) grants for the anon, authenticated and service_role roles.
+	Schemas []string
+	// AnonRole the role unauthenticated requests run as (defaults to anon)
+	AnonRole string
+	// ExtraSearchPath schemas added to the search path of every request (defaults to public and extensions)
+	ExtraSearchPath []string
+	// MaxRows (optional) the most rows a request returns
+	MaxRows int
+	// PreRequest (optional) a function called before every request, e.g., "public.check_request"
+	PreRequest string
+	// PoolSize (optional) the number of database connections PostgREST keeps (defaults to 10)
+	PoolSize int
+}
+
+// schemas the exposed schemas
+func (r RestConfig) schemas() []string {
+	if len(r.Schemas) == 0 {
+		return []string{"public", "graphql_public"}
+	}
+	return r.Schemas
+}
+
+// anonRole the role of unauthenticated requests
+func (r RestConfig) anonRole() string {
+	if r.AnonRole == "" {
+		return "anon"
+	}
+	return r.AnonRole
+}
+
+// extraSearchPath the schemas added to every request's search path
+func (r RestConfig) extraSearchPath() []string {
+	if len(r.ExtraSearchPath) == 0 {
+		return []string{"public", "extensions"}
+	}
+	return r.ExtraSearchPath
+}
+
+// env PostgREST's environment variables for the config
+func (r RestConfig) env() map[string]string {
+	env := map[string]string{
+		"PGRST_DB_SCHEMAS":           strings.Join(r.schemas(), ","),
+		"PGRST_DB_ANON_ROLE":         r.anonRole(),
+		"PGRST_DB_EXTRA_SEARCH_PATH": strings.Join(r.extraSearchPath(), ","),
+	}
+	if r.MaxRows > 0 {
+		env["PGRST_DB_MAX_ROWS"] = strconv.Itoa(r.MaxRows)
+	}
+	if r.PreRequest != "" {
+		env["PGRST_DB_PRE_REQUEST"] = r.PreRequest
+	}
+	if r.PoolSize > 0 {
+		env["PGRST_DB_POOL"] = strconv.Itoa(r.PoolSize)
+	}
+	return env
+}
+
+func (r RestConfig) validate() error {
+	for _, schemas := range [][]string{r.Schemas, r.ExtraSearchPath} {
+		for i, schema := range schemas {
+			if !restNameRegex.MatchString(schema) {
+				return fmt.Errorf("invalid schema name %q", schema)
+			} else if slices.Contains(schemas[:i], schema) {
+				return fmt.Errorf("schema %q is listed more than once", schema)
+			}
+		}
+	}
+	if r.AnonRole != "" && !restNameRegex.MatchString(r.AnonRole) {
+		return fmt.Errorf("invalid anon role %q", r.AnonRole)
+	} else if r.PreRequest != "" && !restFunctionRegex.MatchString(r.PreRequest) {
+		return fmt.Errorf("invalid pre-request function %q (expected a name, e.g., \"public.check_request\")", r.PreRequest)
+	} else if r.MaxRows < 0 {
+		return fmt.Errorf("max rows must not be negative, got %d", r.MaxRows)
+	} else if r.PoolSize < 0 {
+		return fmt.Errorf("pool size must not be negative, got %d", r.PoolSize)
+	}
+	return nil
+}
+
+// ReloadSchemaCache has PostgREST reload its schema cache (NOTIFY pgrst), picking up tables, functions and grants
+// created since it started; this happens automatically after Run (or Migrate) applies migrations
+func (sg *SupaGo) ReloadSchemaCache(ctx context.Context) error {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+	return sg.reloadSchemaCache(ctx)
+}
+
+// reloadSchemaCache notifies PostgREST to reload its schema cache
+// The caller must hold sg.mu
+func (sg *SupaGo) reloadSchemaCache(ctx context.Context) error {
+	if sg.databaseService() == nil {
+		return errors.New("the stack has no database")
+	}
+	if _, err := sg.psql(ctx, "supabase_admin", "postgres", "-c", "NOTIFY pgrst, 'reload schema';"); err != nil {
+		return fmt.Errorf("failed to reload the schema cache: %w", err)
+	}
+	return nil
+}
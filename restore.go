@@ -0,0 +1,292 @@
+package supago
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/train360-corp/supago/internal/restore"
+	"github.com/train360-corp/supago/internal/utils"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+type RestoreOptions struct {
+	// NewDataDirectory restore into a freshly initialized database
+	// The stack is stopped, the current data directory is moved aside (see RestoreResult.PreviousDataDirectory), and
+	// the stack is restarted (re-running the database's initialization) before the backup is loaded. Otherwise, the
+	// objects in the backup are dropped and recreated within the running database.
+	NewDataDirectory bool
+}
+
+type RestoreResult struct {
+	// Backup the metadata of the restored backup (empty for plain pg_dump archives)
+	Backup BackupMetadata
+	// PreviousDataDirectory where the replaced data directory was moved to (only when RestoreOptions.NewDataDirectory)
+	PreviousDataDirectory string
+	Duration              time.Duration
+}
+
+// Restore loads a logical backup (see Backup), or a plain pg_dump custom-format archive (pg_dump -Fc, gzipped or not),
+// from src into the stack's database
+// The dump is streamed into the database container (never held in memory). Plain archives carry no roles: the roles
+// their objects belong to must exist already (e.g., created by migrations), and RestoreResult.Backup is left empty.
+// Schemas owned by the stack (auth, storage, realtime, extensions, etc.; see restore.ManagedSchemas) are not
+// recreated from the backup: their definitions come from the running database image and services, and only the auth
+// and storage data (users, identities, buckets, objects, ...) is loaded into them. Roles in the backup that do not
+// exist yet are created; existing (managed) roles keep their current attributes and passwords. The load runs in a
+// single transaction (nothing is changed if it fails), after which every service depending on the database is
+// restarted. The analytics database (_supabase) is not part of backups, and is left as is.
+func (sg *SupaGo) Restore(ctx context.Context, src io.Reader, opts RestoreOptions) (*RestoreResult, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+	return sg.restore(ctx, src, opts)
+}
+
+// restore loads a logical backup (see Restore)
+// The caller must hold sg.mu
+func (sg *SupaGo) restore(ctx context.Context, src io.Reader, opts RestoreOptions) (*RestoreResult, error) {
+	started := time.Now()
+	archive, err := readBackup(src)
+	if err != nil {
+		return nil, err
+	}
+	result := &RestoreResult{Backup: archive.metadata}
+
+	if sg.databaseService() == nil {
+		return nil, errors.New("no database service")
+	} else if opts.NewDataDirectory {
+		if result.PreviousDataDirectory, err = sg.reinitializeDatabase(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sg.database("supabase_admin", "postgres")
+	if err != nil {
+		return nil, err
+	}
+	if version, err := db.QueryValue(ctx, "SHOW server_version;"); err != nil {
+		return nil, fmt.Errorf("failed to get postgres version: %w", err)
+	} else if major(version) < major(archive.metadata.PostgresVersion) {
+		return nil, fmt.Errorf("backup is from postgres %s, which is newer than the running postgres %s", archive.metadata.PostgresVersion, version)
+	}
+
+	if archive.plain {
+		sg.logger.Infow("restoring pg_dump archive", "new_data_directory", opts.NewDataDirectory)
+	} else {
+		sg.logger.Infow("restoring backup",
+			"created", archive.metadata.CreatedAt,
+			"platform", archive.metadata.Platform,
+			"postgres", archive.metadata.PostgresVersion,
+			"new_data_directory", opts.NewDataDirectory,
+		)
+	}
+
+	// roles (outside the transaction below: roles are cluster-wide, and creating them is idempotent here)
+	if !archive.plain {
+		existing, err := queryNames(ctx, db, "SELECT rolname FROM pg_roles;")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list roles: %w", err)
+		}
+		if roles := restore.FilterRoles(string(archive.roles), existing); strings.TrimSpace(roles) != "" {
+			if err := db.ExecFile(ctx, backupRolesFile, []byte(roles)); err != nil {
+				return nil, fmt.Errorf("failed to restore roles: %w", err)
+			}
+		}
+	}
+
+	// plan the restore against what the database already holds
+	const dir = "/tmp/supago/restore"
+	dump, list, script := dir+"/"+backupDumpFile, dir+"/restore.list", dir+"/restore.sql"
+	defer func() {
+		_, _ = utils.ExecInContainer(context.Background(), db.docker, db.cid, []string{"rm", "-rf", dir})
+	}()
+	if output, err := utils.ExecInContainerStdin(ctx, db.docker, db.cid, []string{"sh", "-c", fmt.Sprintf("mkdir -p %s && cat > %s", dir, dump)}, archive.dump); err != nil {
+		return nil, fmt.Errorf("failed to copy dump into container: %w (%s)", err, strings.TrimSpace(output))
+	}
+	var toc bytes.Buffer
+	if err := db.stream(ctx, &toc, "pg_restore", "--list", dump); err != nil {
+		return nil, fmt.Errorf("failed to read dump contents: %w", err)
+	}
+	target := restore.Target{Clean: !opts.NewDataDirectory}
+	for _, query := range []struct {
+		sql  string
+		into *map[string]bool
+	}{
+		{"SELECT nspname FROM pg_namespace;", &target.Schemas},
+		{"SELECT extname FROM pg_extension;", &target.Extensions},
+		{"SELECT evtname FROM pg_event_trigger;", &target.EventTriggers},
+		{"SELECT pubname FROM pg_publication;", &target.Publications},
+	} {
+		if *query.into, err = queryNames(ctx, db, query.sql); err != nil {
+			return nil, fmt.Errorf("failed to inspect database: %w", err)
+		}
+	}
+	plan := restore.FilterTOC(toc.String(), target)
+	if err := utils.CopyToContainer(ctx, db.docker, db.cid, EmbeddedFile{Data: []byte(plan.List), Path: list}); err != nil {
+		return nil, fmt.Errorf("failed to copy restore list into container: %w", err)
+	}
+
+	// render the restore script, then load it in a single transaction
+	args := []string{"--use-list=" + list, "--file=" + script}
+	if target.Clean {
+		args = append(args, "--clean", "--if-exists")
+	}
+	if err := db.stream(ctx, io.Discard, "pg_restore", append(args, dump)...); err != nil {
+		return nil, fmt.Errorf("failed to render restore script: %w", err)
+	}
+	prelude := "SET session_replication_role = replica;" // no triggers or foreign key checks while loading data
+	if len(plan.DataTables) > 0 {
+		tables := make([]string, len(plan.DataTables))
+		for i, table := range plan.DataTables {
+			schema, name, _ := strings.Cut(table, ".")
+			tables[i] = utils.QuoteIdentifier(schema) + "." + utils.QuoteIdentifier(name)
+		}
+		prelude += " TRUNCATE " + strings.Join(tables, ", ") + " CASCADE;"
+	}
+	if _, err := execPsql(ctx, db.docker, db.cid, db.user, db.name, "--single-transaction", "-c", prelude, "-f", script); err != nil {
+		return nil, fmt.Errorf("failed to restore database: %w", err)
+	}
+
+	// the services cache (or migrate) against the database: restart them onto the restored data
+	dbService := sg.databaseService()
+	if err := sg.recreate(ctx, func(service *Service) bool { return service != dbService }); err != nil {
+		return nil, err
+	}
+
+	result.Duration = time.Since(started)
+	sg.logger.Infow("restore completed",
+		"duration", result.Duration,
+		"managed_tables", len(plan.DataTables),
+		"previous_data_directory", result.PreviousDataDirectory,
+	)
+	return result, nil
+}
+
+// RestoreFromFile loads a logical backup (see Restore) from a file at path
+func (sg *SupaGo) RestoreFromFile(ctx context.Context, path string, opts RestoreOptions) (*RestoreResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer file.Close()
+	return sg.Restore(ctx, file, opts)
+}
+
+// reinitializeDatabase stops the stack, moves the database's data directory aside, and restarts the stack
+// (initializing a new database); returning where the previous data directory was moved to
+// The caller must hold sg.mu
+func (sg *SupaGo) reinitializeDatabase(ctx context.Context) (string, error) {
+	if sg.docker == nil || sg.network == nil {
+		return "", errors.New("services are not running")
+	}
+
+	dir := sg.config.Database.DataDirectory
+	previous := fmt.Sprintf("%s.pre-restore-%s", dir, time.Now().UTC().Format("20060102T150405Z"))
+
+	sg.logger.Warnf("stopping all services to reinitialize the database")
+	sg.removeServices()
+
+	if err := os.Rename(dir, previous); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to move data directory aside: %w", err)
+	}
+	sg.logger.Infof("moved data directory \"%s\" to \"%s\"", dir, previous)
+
+	// every service is rebuilt (the database's constructor creates the new, empty data directory)
+	if err := sg.recreate(ctx, func(*Service) bool { return true }); err != nil {
+		return previous, fmt.Errorf("failed to reinitialize database (previous data directory kept at \"%s\"): %w", previous, err)
+	}
+	return previous, nil
+}
+
+// maxBackupMemberSize the largest member of a backup archive read into memory (anything but the dump)
+const maxBackupMemberSize = 64 << 20
+
+// pgDumpMagic the header of pg_dump's custom-format archives
+const pgDumpMagic = "PGDMP"
+
+type backupArchive struct {
+	metadata BackupMetadata
+	roles    []byte
+	// dump the pg_dump archive, read from the source as it is consumed
+	dump io.Reader
+	// plain whether the source is a plain pg_dump archive (without metadata or roles)
+	plain bool
+}
+
+// readBackup reads a backup archive, or a plain pg_dump custom-format archive (either gzipped or not), up to the dump
+// Backup archives hold their metadata and roles before the dump (see backup), so only those are read into memory.
+func readBackup(src io.Reader) (*backupArchive, error) {
+	buffered := bufio.NewReader(src)
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup archive: %w", err)
+		}
+		buffered = bufio.NewReader(gz)
+	}
+	if magic, err := buffered.Peek(len(pgDumpMagic)); err == nil && string(magic) == pgDumpMagic {
+		return &backupArchive{dump: buffered, plain: true}, nil
+	}
+
+	archive := &backupArchive{}
+	var hasMetadata bool
+	tr := tar.NewReader(buffered)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("not a backup archive (missing dump)")
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read backup archive: %w", err)
+		}
+		if header.Name == backupDumpFile {
+			if !hasMetadata {
+				return nil, errors.New("not a backup archive (missing metadata)")
+			}
+			archive.dump = tr
+			return archive, nil
+		}
+		if header.Size > maxBackupMemberSize {
+			return nil, fmt.Errorf("%s in backup archive is too large (%d bytes)", header.Name, header.Size)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from backup archive: %w", header.Name, err)
+		}
+		switch header.Name {
+		case backupMetadataFile:
+			if err := json.Unmarshal(data, &archive.metadata); err != nil {
+				return nil, fmt.Errorf("failed to decode backup metadata: %w", err)
+			}
+			hasMetadata = true
+		case backupRolesFile:
+			archive.roles = data
+		}
+	}
+}
+
+// queryNames runs a query returning a single column, as a set
+func queryNames(ctx context.Context, db *Database, sql string) (map[string]bool, error) {
+	rows, err := db.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		names[row[0]] = true
+	}
+	return names, nil
+}
+
+// major the major version of a postgres server_version (e.g., 17 for "17.4 (Ubuntu ...)"); 0 if unparsable
+func major(version string) int {
+	var v int
+	_, _ = fmt.Sscanf(version, "%d", &v)
+	return v
+}
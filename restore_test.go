@@ -0,0 +1,84 @@
+package supago
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func testBackupArchive(t *testing.T, members ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, member := range members {
+		if err := tw.WriteHeader(&tar.Header{Name: member[0], Typeflag: tar.TypeReg, Mode: 0o600, Size: int64(len(member[1]))}); err != nil {
+			t.Fatal(err)
+		} else if _, err := tw.Write([]byte(member[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testGzip(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	} else if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadBackup(t *testing.T) {
+	metadata, _ := json.Marshal(BackupMetadata{Platform: "app", PostgresVersion: "17.4"})
+	dump := "PGDMP\x01\x0f\x00 custom-format archive"
+	backup := testBackupArchive(t,
+		[2]string{backupMetadataFile, string(metadata)},
+		[2]string{backupRolesFile, "CREATE ROLE app;"},
+		[2]string{backupDumpFile, dump},
+	)
+
+	for _, tc := range []struct {
+		name  string
+		src   []byte
+		plain bool
+		err   string
+	}{
+		{name: "backup", src: backup},
+		{name: "gzipped backup", src: testGzip(t, backup)},
+		{name: "pg_dump archive", src: []byte(dump), plain: true},
+		{name: "gzipped pg_dump archive", src: testGzip(t, []byte(dump)), plain: true},
+		{name: "missing metadata", src: testBackupArchive(t, [2]string{backupDumpFile, dump}), err: "missing metadata"},
+		{name: "missing dump", src: testBackupArchive(t, [2]string{backupMetadataFile, string(metadata)}), err: "missing dump"},
+		{name: "not an archive", src: []byte("SELECT 1;"), err: "failed to read backup archive"},
+	} {
+		archive, err := readBackup(bytes.NewReader(tc.src))
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: expect error %q, got %v", tc.name, tc.err, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if archive.plain != tc.plain {
+			t.Errorf("%s: expect plain %v, got %v", tc.name, tc.plain, archive.plain)
+		} else if !tc.plain && (archive.metadata.Platform != "app" || string(archive.roles) != "CREATE ROLE app;") {
+			t.Errorf("%s: unexpected metadata %+v or roles %q", tc.name, archive.metadata, archive.roles)
+		}
+		if data, err := io.ReadAll(archive.dump); err != nil || string(data) != dump {
+			t.Errorf("%s: expect the dump streamed, got %q (%v)", tc.name, data, err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package supago
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+)
+
+// SeedFunc loads seed data using a handle to the database (connected as the postgres role)
+type SeedFunc func(ctx context.Context, db *Database) error
+
+type seed struct {
+	name   string
+	source fs.FS
+	fn     SeedFunc
+}
+
+// AddSeeds registers SQL seed files (at the root of source; e.g., an embed.FS holding supabase/seed.sql)
+// Seeds run after migrations, in registration order (files within a source in lexical order), only when the
+// database was freshly initialized by Run (or when Seed is called explicitly).
+func (sg *SupaGo) AddSeeds(source fs.FS) *SupaGo {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+	sg.seeds = append(sg.seeds, seed{name: "sql", source: source})
+	return sg
+}
+
+// AddSeedFunc registers a Go seed callback (see AddSeeds)
+func (sg *SupaGo) AddSeedFunc(name string, fn SeedFunc) *SupaGo {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+	sg.seeds = append(sg.seeds, seed{name: name, fn: fn})
+	return sg
+}
+
+// Seed runs all registered seeds, regardless of whether the database was freshly initialized
+func (sg *SupaGo) Seed(ctx context.Context) error {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+	return sg.seed(ctx)
+}
+
+// seed runs all registered seeds
+// The caller must hold sg.mu
+func (sg *SupaGo) seed(ctx context.Context) error {
+	if len(sg.seeds) == 0 {
+		return nil
+	}
+
+	db, err := sg.database("postgres", "postgres")
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sg.seeds {
+		if s.fn != nil {
+			sg.logger.Infof("running seed %s", s.name)
+			if err := s.fn(ctx, db); err != nil {
+				return fmt.Errorf("seed %s failed: %w", s.name, err)
+			}
+			continue
+		}
+
+		entries, err := fs.ReadDir(s.source, ".")
+		if err != nil {
+			return fmt.Errorf("failed to read seeds: %w", err)
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+				continue
+			}
+			data, err := fs.ReadFile(s.source, entry.Name())
+			if err != nil {
+				return fmt.Errorf("failed to read seed %s: %w", entry.Name(), err)
+			}
+			sg.logger.Infof("running seed %s", entry.Name())
+			if err := db.ExecFile(ctx, entry.Name(), data); err != nil {
+				return fmt.Errorf("seed %s failed: %w", entry.Name(), err)
+			}
+		}
+	}
+
+	sg.logger.Info("seeds loaded")
+	return nil
+}
+
+// isUninitializedDataDirectory whether a (postgres) data directory does not exist yet, or is empty
+// A directory that cannot be read (e.g., owned by the container's postgres user) has been initialized.
+func isUninitializedDataDirectory(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return errors.Is(err, fs.ErrNotExist)
+	}
+	return len(entries) == 0
+}
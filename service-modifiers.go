@@ -0,0 +1,116 @@
+package supago
+
+import (
+	"errors"
+	"fmt"
+	"github.com/docker/docker/api/types/mount"
+	"path/filepath"
+)
+
+// ServiceModifier patches a service built by a constructor (see ServiceConstructor.With)
+type ServiceModifier func(service *Service) error
+
+// With a constructor building the service as c does, then patching it with modifiers (in order)
+// The modifiers are re-applied whenever the service is rebuilt (e.g., after a password rotation), e.g.:
+//
+//	Services.Postgrest.With(SetEnv("PGRST_DB_SCHEMAS", "public,api"), Image("postgrest/postgrest:v12.2.12"))
+func (c ServiceConstructor) With(modifiers ...ServiceModifier) ServiceConstructor {
+	return func(config Config) (Service, error) {
+		service, err := c(config)
+		if err != nil {
+			return Service{}, err
+		}
+		for _, modify := range modifiers {
+			if err := modify(&service); err != nil {
+				return Service{}, fmt.Errorf("failed to modify %v: %w", service, err)
+			}
+		}
+		return service, nil
+	}
+}
+
+// SetEnv set an environment variable (replacing its value, if the service sets one)
+func SetEnv(name, value string) ServiceModifier {
+	return func(service *Service) error {
+		if name == "" {
+			return errors.New("environment variable has no name")
+		}
+		if service.Env == nil {
+			service.Env = map[string]string{}
+		}
+		service.Env[name] = value
+		return nil
+	}
+}
+
+// UnsetEnv remove environment variables
+func UnsetEnv(names ...string) ServiceModifier {
+	return func(service *Service) error {
+		for _, name := range names {
+			delete(service.Env, name)
+		}
+		return nil
+	}
+}
+
+// Image run another image (e.g., a newer version)
+func Image(image string) ServiceModifier {
+	return func(service *Service) error {
+		if image == "" {
+			return errors.New("no image")
+		}
+		service.Image = image
+		return nil
+	}
+}
+
+// Cmd replace the command the container runs
+func Cmd(cmd ...string) ServiceModifier {
+	return func(service *Service) error {
+		service.Cmd = cmd
+		return nil
+	}
+}
+
+// AddMount mount a host directory (or file, or volume) into the container
+func AddMount(m mount.Mount) ServiceModifier {
+	return func(service *Service) error {
+		if m.Type == mount.TypeBind && !filepath.IsAbs(m.Source) {
+			return fmt.Errorf("bind mount source \"%s\" is not an absolute path", m.Source)
+		} else if m.Target == "" {
+			return errors.New("mount has no target")
+		}
+		service.Mounts = append(service.Mounts, m)
+		return nil
+	}
+}
+
+// AddEmbeddedFile copy a file's contents into the container before it starts
+func AddEmbeddedFile(file EmbeddedFile) ServiceModifier {
+	return func(service *Service) error {
+		if file.Path == "" {
+			return errors.New("embedded file has no path")
+		}
+		service.EmbeddedFiles = append(service.EmbeddedFiles, file)
+		return nil
+	}
+}
+
+// SetLabel set a container label
+func SetLabel(name, value string) ServiceModifier {
+	return func(service *Service) error {
+		if service.Labels == nil {
+			service.Labels = map[string]string{}
+		}
+		service.Labels[name] = value
+		return nil
+	}
+}
+
+// Patch change the service arbitrarily
+func Patch(patch func(service *Service)) ServiceModifier {
+	return func(service *Service) error {
+		patch(service)
+		return nil
+	}
+}
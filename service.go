@@ -6,6 +6,7 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/client"
+	"slices"
 	"time"
 )
 
@@ -15,19 +16,46 @@ type Service struct {
 	Aliases    []string
 	Entrypoint []string
 	Cmd        []string
-	Env        []string
-	Labels     map[string]string
+	// Env environment variables, by name
+	Env    map[string]string
+	Labels map[string]string
 	// Mounts for local files/volumes mounted into the fs
 	Mounts []mount.Mount
 	// EmbeddedFiles for byte contents copied directly into the fs
 	EmbeddedFiles []EmbeddedFile
 	Ports         []uint16
-	Healthcheck   *container.HealthConfig
-	StopSignal    *string
-	StopTimeout   *time.Duration
-	AfterStart    func(ctx context.Context, docker *client.Client, containerID string) error
-	container     *container.CreateResponse
-	closeConn     func()
+	// ExtraHosts (optional) additional /etc/hosts entries, as "host:ip" (e.g., "host.docker.internal:host-gateway", where
+	// host-gateway is the platform network's gateway on Linux)
+	ExtraHosts []string
+	// HostPorts (optional) the host ports Ports are published on (by container port); defaults to the same port
+	HostPorts   map[uint16]uint16
+	Healthcheck *container.HealthConfig
+	StopSignal  *string
+	StopTimeout *time.Duration
+	AfterStart  func(ctx context.Context, docker *client.Client, containerID string) error
+	container   *container.CreateResponse
+	closeConn   func()
+	constructor ServiceConstructor
+}
+
+// hasAlias whether the service is reachable on the network under alias
+func (s Service) hasAlias(alias string) bool {
+	for _, a := range s.Aliases {
+		if a == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// environment the service's environment variables, as NAME=value (sorted, for stable container configs)
+func (s Service) environment() []string {
+	env := make([]string, 0, len(s.Env))
+	for name, value := range s.Env {
+		env = append(env, name+"="+value)
+	}
+	slices.Sort(env)
+	return env
 }
 
 func (s Service) String() string {
@@ -35,7 +63,7 @@ func (s Service) String() string {
 }
 
 func (s Service) Build() ServiceConstructor {
-	return func(Config) Service {
-		return s
+	return func(Config) (Service, error) {
+		return s, nil
 	}
 }
@@ -9,12 +9,15 @@ import (
 	"github.com/train360-corp/supago/internal/services/kong"
 	postgres "github.com/train360-corp/supago/internal/services/postgres/embeds"
 	"github.com/train360-corp/supago/internal/utils"
+	"maps"
 	"os"
 	"strings"
 	"time"
 )
 
-type ServiceConstructor func(Config) Service
+// ServiceConstructor builds a service from the config; failing (e.g., when a data directory cannot be created) with
+// an error rather than a panic
+type ServiceConstructor func(Config) (Service, error)
 
 type PreBuiltServices struct {
 	Analytics ServiceConstructor
@@ -31,7 +34,7 @@ type PreBuiltServices struct {
 
 var Services PreBuiltServices = PreBuiltServices{
 
-	Analytics: func(config Config) Service {
+	Analytics: withDatabaseRole("supabase_admin", func(config Config) (Service, error) {
 		return Service{
 			Image:   "supabase/logflare:1.14.2",
 			Name:    containerName(config, "supago-analytics"),
@@ -46,29 +49,28 @@ var Services PreBuiltServices = PreBuiltServices{
 				Timeout:  5 * time.Second,
 				Retries:  10,
 			},
-			Env: []string{
-				fmt.Sprintf("%s=%s", "LOGFLARE_NODE_HOST", "127.0.0.1"),
-				fmt.Sprintf("%s=%s", "DB_USERNAME", "supabase_admin"),
-				fmt.Sprintf("%s=%s", "DB_DATABASE", "_supabase"),
-				fmt.Sprintf("%s=%s", "DB_HOSTNAME", containerName(config, dbContainerName)),
-				fmt.Sprintf("%s=%s", "DB_PORT", "5432"),
-				fmt.Sprintf("%s=%s", "DB_PASSWORD", config.Database.Password),
-				fmt.Sprintf("%s=%s", "DB_SCHEMA", "_analytics"),
-				fmt.Sprintf("%s=%s", "LOGFLARE_PUBLIC_ACCESS_TOKEN", config.LogFlare.PublicKey),
-				fmt.Sprintf("%s=%s", "LOGFLARE_PRIVATE_ACCESS_TOKEN", config.LogFlare.PrivateKey),
-				fmt.Sprintf("%s=%s", "LOGFLARE_SINGLE_TENANT", "true"),
-				fmt.Sprintf("%s=%s", "LOGFLARE_SUPABASE_MODE", "true"),
-				fmt.Sprintf("%s=%s", "LOGFLARE_MIN_CLUSTER_SIZE", "1"),
-				fmt.Sprintf("%s=%s", "POSTGRES_BACKEND_URL",
-					fmt.Sprintf("postgresql://supabase_admin:%s@%s:5432/_supabase", config.Database.Password, containerName(config, dbContainerName))),
-				fmt.Sprintf("%s=%s", "POSTGRES_BACKEND_SCHEMA", "_analytics"),
-				fmt.Sprintf("%s=%s", "LOGFLARE_FEATURE_FLAG_OVERRIDE", "multibackend=true"),
+			Env: map[string]string{
+				"LOGFLARE_NODE_HOST":             "127.0.0.1",
+				"DB_USERNAME":                    "supabase_admin",
+				"DB_DATABASE":                    "_supabase",
+				"DB_HOSTNAME":                    containerName(config, dbContainerName),
+				"DB_PORT":                        "5432",
+				"DB_PASSWORD":                    config.Database.RolePassword("supabase_admin"),
+				"DB_SCHEMA":                      "_analytics",
+				"LOGFLARE_PUBLIC_ACCESS_TOKEN":   config.LogFlare.PublicKey,
+				"LOGFLARE_PRIVATE_ACCESS_TOKEN":  config.LogFlare.PrivateKey,
+				"LOGFLARE_SINGLE_TENANT":         "true",
+				"LOGFLARE_SUPABASE_MODE":         "true",
+				"LOGFLARE_MIN_CLUSTER_SIZE":      "1",
+				"POSTGRES_BACKEND_URL":           fmt.Sprintf("postgresql://supabase_admin:%s@%s:5432/_supabase", config.Database.RolePassword("supabase_admin"), containerName(config, dbContainerName)),
+				"POSTGRES_BACKEND_SCHEMA":        "_analytics",
+				"LOGFLARE_FEATURE_FLAG_OVERRIDE": "multibackend=true",
 			},
-		}
-	},
+		}, nil
+	}),
 
-	Auth: func(config Config) Service {
-		return Service{
+	Auth: withDatabaseRole("supabase_auth_admin", func(config Config) (Service, error) {
+		svc := Service{
 			Name:    containerName(config, "supago-auth"),
 			Aliases: []string{"auth", "gotrue"},
 			Image:   "supabase/gotrue:v2.177.0",
@@ -85,55 +87,44 @@ var Services PreBuiltServices = PreBuiltServices{
 				Timeout:  5 * time.Second,
 				Retries:  3,
 			},
-			Env: []string{
-				fmt.Sprintf("%s=%s", "GOTRUE_API_HOST", "0.0.0.0"),
-				fmt.Sprintf("%s=%s", "GOTRUE_API_PORT", "9999"),
-				fmt.Sprintf("%s=%s", "API_EXTERNAL_URL", config.Kong.URLs.Kong),
-
-				fmt.Sprintf("%s=%s", "GOTRUE_DB_DRIVER", "postgres"),
-				fmt.Sprintf("%s=%s", "GOTRUE_DB_DATABASE_URL",
-					fmt.Sprintf("postgres://supabase_auth_admin:%s@%s:5432/postgres", config.Database.Password, containerName(config, dbContainerName))),
-
-				fmt.Sprintf("%s=%s", "GOTRUE_SITE_URL", config.Kong.URLs.Site),
-				fmt.Sprintf("%s=%s", "GOTRUE_URI_ALLOW_LIST", ""),
-				fmt.Sprintf("%s=%s", "GOTRUE_DISABLE_SIGNUP", "false"),
-
-				fmt.Sprintf("%s=%s", "GOTRUE_JWT_ADMIN_ROLES", "service_role"),
-				fmt.Sprintf("%s=%s", "GOTRUE_JWT_AUD", "authenticated"),
-				fmt.Sprintf("%s=%s", "GOTRUE_JWT_DEFAULT_GROUP_NAME", "authenticated"),
-				fmt.Sprintf("%s=%s", "GOTRUE_JWT_EXP", "3600"),
-				fmt.Sprintf("%s=%s", "GOTRUE_JWT_SECRET", config.Keys.JwtSecret),
-
-				fmt.Sprintf("%s=%s", "GOTRUE_EXTERNAL_EMAIL_ENABLED", "true"),
-				fmt.Sprintf("%s=%s", "GOTRUE_EXTERNAL_ANONYMOUS_USERS_ENABLED", "false"),
-				fmt.Sprintf("%s=%s", "GOTRUE_MAILER_AUTOCONFIRM", "false"),
-				fmt.Sprintf("%s=%s", "GOTRUE_SMTP_ADMIN_EMAIL", config.Kong.SMTP.From.Email),
-				fmt.Sprintf("%s=%s", "GOTRUE_SMTP_HOST", config.Kong.SMTP.Host),
-				fmt.Sprintf("%s=%d", "GOTRUE_SMTP_PORT", config.Kong.SMTP.Port),
-				fmt.Sprintf("%s=%s", "GOTRUE_SMTP_USER", config.Kong.SMTP.User),
-				fmt.Sprintf("%s=%s", "GOTRUE_SMTP_PASS", config.Kong.SMTP.Pass),
-				fmt.Sprintf("%s=%s", "GOTRUE_SMTP_SENDER_NAME", config.Kong.SMTP.From.Name),
-				fmt.Sprintf("%s=%s", "GOTRUE_MAILER_URLPATHS_INVITE", "/auth/v1/verify"),
-				fmt.Sprintf("%s=%s", "GOTRUE_MAILER_URLPATHS_CONFIRMATION", "/auth/v1/verify"),
-				fmt.Sprintf("%s=%s", "GOTRUE_MAILER_URLPATHS_RECOVERY", "/auth/v1/verify"),
-				fmt.Sprintf("%s=%s", "GOTRUE_MAILER_URLPATHS_EMAIL_CHANGE", "/auth/v1/verify"),
-				fmt.Sprintf("%s=%s", "GOTRUE_EXTERNAL_PHONE_ENABLED", "false"),
-				fmt.Sprintf("%s=%s", "GOTRUE_SMS_AUTOCONFIRM", "false"),
+			Env: map[string]string{
+				"GOTRUE_API_HOST":  "0.0.0.0",
+				"GOTRUE_API_PORT":  "9999",
+				"API_EXTERNAL_URL": config.Kong.URLs.Kong,
+
+				"GOTRUE_DB_DRIVER":       "postgres",
+				"GOTRUE_DB_DATABASE_URL": fmt.Sprintf("postgres://supabase_auth_admin:%s@%s:5432/postgres", config.Database.RolePassword("supabase_auth_admin"), containerName(config, dbContainerName)),
+
+				"GOTRUE_SITE_URL": config.Kong.URLs.Site,
+
+				"GOTRUE_JWT_ADMIN_ROLES":        "service_role",
+				"GOTRUE_JWT_AUD":                "authenticated",
+				"GOTRUE_JWT_DEFAULT_GROUP_NAME": "authenticated",
+				"GOTRUE_JWT_SECRET":             config.Keys.legacySecret(),
+
+				"GOTRUE_EXTERNAL_EMAIL_ENABLED": "true",
+				"GOTRUE_SMTP_ADMIN_EMAIL":       config.Kong.SMTP.From.Email,
+				"GOTRUE_SMTP_HOST":              config.Kong.SMTP.Host,
+				"GOTRUE_SMTP_PORT":              fmt.Sprint(config.Kong.SMTP.Port),
+				"GOTRUE_SMTP_USER":              config.Kong.SMTP.User,
+				"GOTRUE_SMTP_PASS":              config.Kong.SMTP.Pass,
+				"GOTRUE_SMTP_SENDER_NAME":       config.Kong.SMTP.From.Name,
 			},
 		}
-	},
+		if config.Keys.signingJWKs != "" {
+			svc.Env["GOTRUE_JWT_KEYS"] = config.Keys.signingJWKs
+			svc.Env["GOTRUE_JWT_VALID_METHODS"] = "HS256,RS256,ES256"
+		}
+		maps.Copy(svc.Env, config.Auth.env(config.Kong))
+		if config.Auth.ServesCallbacks() {
+			svc.ExtraHosts = append(svc.ExtraHosts, authCallbacksHost+":host-gateway")
+		}
+		return svc, nil
+	}),
 
-	ImgProxy: func(config Config) Service {
-		if info, err := os.Stat(config.Storage.DataDirectory); err != nil {
-			if os.IsNotExist(err) {
-				if err := os.MkdirAll(config.Storage.DataDirectory, 0o700); err != nil {
-					panic(fmt.Sprintf("storage data directory \"%s\" does not exist and an error occurred while trying to create it: %v", config.Storage.DataDirectory, err))
-				}
-			} else {
-				panic(fmt.Sprintf("error checking storage data directory \"%s\" exists: %v", config.Storage.DataDirectory, err))
-			}
-		} else if !info.IsDir() {
-			panic(fmt.Sprintf("storage directory \"%s\" exists but is not a directory", config.Storage.DataDirectory))
+	ImgProxy: withoutDatabaseRoles(func(config Config) (Service, error) {
+		if err := ensureDirectory("storage data directory", config.Storage.DataDirectory, 0o700); err != nil {
+			return Service{}, err
 		}
 
 		return Service{
@@ -157,23 +148,26 @@ var Services PreBuiltServices = PreBuiltServices{
 					Target: "/var/lib/storage",
 				},
 			},
-			Env: []string{
-				"IMGPROXY_BIND=:5001",
-				"IMGPROXY_LOCAL_FILESYSTEM_ROOT=/",
-				"IMGPROXY_USE_ETAG=true",
-				"IMGPROXY_ENABLE_WEBP_DETECTION=true",
+			Env: map[string]string{
+				"IMGPROXY_BIND":                  ":5001",
+				"IMGPROXY_LOCAL_FILESYSTEM_ROOT": "/",
+				"IMGPROXY_USE_ETAG":              "true",
+				"IMGPROXY_ENABLE_WEBP_DETECTION": "true",
 			},
-		}
-	},
+		}, nil
+	}),
 
-	Kong: func(config Config) Service {
-		return Service{
+	Kong: withoutDatabaseRoles(func(config Config) (Service, error) {
+		svc := Service{
 			Image:   "kong:2.8.1",
 			Name:    containerName(config, kong.ContainerName),
 			Aliases: []string{"kong"},
 			Ports: []uint16{
 				8000,
 			},
+			HostPorts: map[uint16]uint16{
+				8000: config.Kong.hostPort(),
+			},
 			EmbeddedFiles: []EmbeddedFile{
 				{
 					Data: kong.ConfigFile,
@@ -186,62 +180,77 @@ var Services PreBuiltServices = PreBuiltServices{
 eval "echo \"$(cat /usr/local/kong-template.yml)\"" > "$HOME/kong.yml"
 exec /docker-entrypoint.sh kong docker-start`,
 			},
-			Env: []string{
-				fmt.Sprintf("%s=%s", "KONG_DATABASE", "off"),
-				fmt.Sprintf("%s=%s", "KONG_DECLARATIVE_CONFIG", "/home/kong/kong.yml"),
-				fmt.Sprintf("%s=%s", "KONG_DNS_ORDER", "LAST,A,CNAME"),
-				fmt.Sprintf("%s=%s", "KONG_PLUGINS", "request-transformer,cors,key-auth,acl,basic-auth"),
-				fmt.Sprintf("%s=%s", "KONG_NGINX_PROXY_PROXY_BUFFER_SIZE", "160k"),
-				fmt.Sprintf("%s=%s", "KONG_NGINX_PROXY_PROXY_BUFFERS", "64 160k"),
-				fmt.Sprintf("%s=%s", "SUPABASE_ANON_KEY", config.Keys.PublicJwt),
-				fmt.Sprintf("%s=%s", "SUPABASE_SERVICE_KEY", config.Keys.PrivateJwt),
-				fmt.Sprintf("%s=%s", "DASHBOARD_USERNAME", config.Dashboard.Username),
-				fmt.Sprintf("%s=%s", "DASHBOARD_PASSWORD", config.Dashboard.Password),
+			Env: map[string]string{
+				"KONG_DATABASE":                      "off",
+				"KONG_DECLARATIVE_CONFIG":            "/home/kong/kong.yml",
+				"KONG_DNS_ORDER":                     "LAST,A,CNAME",
+				"KONG_PLUGINS":                       "request-transformer,cors,key-auth,acl,basic-auth",
+				"KONG_NGINX_PROXY_PROXY_BUFFER_SIZE": "160k",
+				"KONG_NGINX_PROXY_PROXY_BUFFERS":     "64 160k",
+				"SUPABASE_ANON_KEY":                  config.Keys.PublicJwt,
+				"SUPABASE_SERVICE_KEY":               config.Keys.PrivateJwt,
+				"DASHBOARD_USERNAME":                 config.Dashboard.Username,
+				"DASHBOARD_PASSWORD":                 config.Dashboard.Password,
 			},
 		}
-	},
+		if config.Keys.Retiring != nil { // keep accepting the retiring keys during a rotation
+			svc.Env["SUPABASE_ANON_KEY_RETIRING"] = config.Keys.Retiring.PublicJwt
+			svc.Env["SUPABASE_SERVICE_KEY_RETIRING"] = config.Keys.Retiring.PrivateJwt
+		}
+		return svc, nil
+	}),
 
-	Meta: func(config Config) Service {
+	Meta: withDatabaseRole("supabase_admin", func(config Config) (Service, error) {
 		return Service{
 			Image:   "supabase/postgres-meta:v0.91.0",
 			Name:    containerName(config, "supago-meta"),
 			Aliases: []string{"meta"},
-			Env: []string{
-				fmt.Sprintf("%s=%s", "PG_META_PORT", "8080"),
-				fmt.Sprintf("%s=%s", "PG_META_DB_HOST", containerName(config, dbContainerName)),
-				fmt.Sprintf("%s=%s", "PG_META_DB_PORT", "5432"),
-				fmt.Sprintf("%s=%s", "PG_META_DB_NAME", "postgres"),
-				fmt.Sprintf("%s=%s", "PG_META_DB_USER", "supabase_admin"),
-				fmt.Sprintf("%s=%s", "PG_META_DB_PASSWORD", config.Database.Password),
+			Env: map[string]string{
+				"PG_META_PORT":        "8080",
+				"PG_META_DB_HOST":     containerName(config, dbContainerName),
+				"PG_META_DB_PORT":     "5432",
+				"PG_META_DB_NAME":     "postgres",
+				"PG_META_DB_USER":     "supabase_admin",
+				"PG_META_DB_PASSWORD": config.Database.RolePassword("supabase_admin"),
 			},
-		}
-	},
+		}, nil
+	}),
 
-	Postgres: func(config Config) Service {
+	Postgres: func(config Config) (Service, error) {
 
 		// folder for storing database data
-		if info, err := os.Stat(config.Database.DataDirectory); err != nil {
-			if os.IsNotExist(err) {
-				if err := os.MkdirAll(config.Database.DataDirectory, 0o700); err != nil {
-					panic(fmt.Sprintf("postgres data directory \"%s\" does not exist and an error occurred while trying to create it: %v", config.Database.DataDirectory, err))
-				}
-			} else {
-				panic(fmt.Sprintf("error checking postgres data directory \"%s\" exists: %v", config.Database.DataDirectory, err))
+		if err := ensureDirectory("postgres data directory", config.Database.DataDirectory, 0o700); err != nil {
+			return Service{}, err
+		}
+
+		// server configuration (the image's, overridden per deployment)
+		conf, err := config.Database.postgresConfig()
+		if err != nil {
+			return Service{}, fmt.Errorf("invalid postgres configuration: %w", err)
+		}
+
+		mounts := []mount.Mount{
+			{
+				Type:   mount.TypeBind,
+				Source: config.Database.DataDirectory,
+				Target: "/var/lib/postgresql/data",
+			},
+		}
+		if archive := config.Database.Archive; archive != nil {
+			if err := ensureDirectory("archive directory", archive.Directory, 0o770); err != nil {
+				return Service{}, err
 			}
-		} else if !info.IsDir() {
-			panic(fmt.Sprintf("postgres data directory \"%s\" exists but is not a directory", config.Database.DataDirectory))
+			mounts = append(mounts, mount.Mount{
+				Type:   mount.TypeBind,
+				Source: archive.Directory,
+				Target: archiveMountPath,
+			})
 		}
 
 		return Service{
-			Image: "supabase/postgres:17.4.1.055",
-			Name:  containerName(config, dbContainerName),
-			Mounts: []mount.Mount{
-				{
-					Type:   mount.TypeBind,
-					Source: config.Database.DataDirectory,
-					Target: "/var/lib/postgresql/data",
-				},
-			},
+			Image:       "supabase/postgres:17.4.1.055",
+			Name:        containerName(config, dbContainerName),
+			Mounts:      mounts,
 			Ports:       make([]uint16, 0),
 			StopTimeout: utils.Pointer(10 * time.Second),
 			Aliases:     []string{"db"},
@@ -251,54 +260,46 @@ exec /docker-entrypoint.sh kong docker-start`,
 				Timeout:  5 * time.Second,
 				Retries:  10,
 			},
-			Cmd: []string{
+			Cmd: append([]string{
 				"postgres",
-				"-c", "config_file=/etc/postgresql/postgresql.conf",
-				"-c", "log_min_messages=error",
-				"-c", "archive_mode=off",
-			},
-			Env: []string{
-				"POSTGRES_HOST=/var/run/postgresql",
-				"PGPORT=5432",
-				"POSTGRES_PORT=5432",
-				fmt.Sprintf("PGPASSWORD=%s", config.Database.Password),
-				fmt.Sprintf("POSTGRES_PASSWORD=%s", config.Database.Password),
-				"PGDATABASE=postgres",
-				"POSTGRES_DB=postgres",
-				fmt.Sprintf("JWT_SECRET=%s", config.Keys.JwtSecret),
-				"JWT_EXP=3600",
+				"-c", "config_file=" + postgresConfigFile,
+			}, config.Database.Archive.postgresSettings()...),
+			Env: map[string]string{
+				"POSTGRES_HOST":     "/var/run/postgresql",
+				"PGPORT":            "5432",
+				"POSTGRES_PORT":     "5432",
+				"PGPASSWORD":        config.Database.Password,
+				"POSTGRES_PASSWORD": config.Database.Password,
+				"PGDATABASE":        "postgres",
+				"POSTGRES_DB":       "postgres",
+				"JWT_SECRET":        config.Keys.JwtSecret,
+				"JWT_EXP":           "3600",
 			},
 			AfterStart: func(ctx context.Context, docker *client.Client, cid string) error {
-				// patch postgres password
-				p := config.Database.Password
+				// patch role passwords (each role has its own)
 				output, err := utils.ExecInContainer(ctx, docker, cid, []string{
 					"psql",
 					"-h", "127.0.0.1",
 					"-U", "supabase_admin",
 					"-d", "postgres",
 					"-v", "ON_ERROR_STOP=1",
-					"-c",
-					fmt.Sprintf(`
-ALTER USER anon                    WITH PASSWORD '%s';
-ALTER USER authenticated           WITH PASSWORD '%s';
-ALTER USER authenticator           WITH PASSWORD '%s';
-ALTER USER dashboard_user          WITH PASSWORD '%s';
-ALTER USER pgbouncer               WITH PASSWORD '%s';
-ALTER USER postgres                WITH PASSWORD '%s';
-ALTER USER service_role            WITH PASSWORD '%s';
-ALTER USER supabase_admin          WITH PASSWORD '%s';
-ALTER USER supabase_auth_admin     WITH PASSWORD '%s';
-ALTER USER supabase_read_only_user WITH PASSWORD '%s';
-ALTER USER supabase_replication_admin WITH PASSWORD '%s';
-ALTER USER supabase_storage_admin  WITH PASSWORD '%s';
-`, p, p, p, p, p, p, p, p, p, p, p, p),
+					"-c", alterRolePasswordsSQL(config.Database),
 				})
 				if err != nil {
-					return fmt.Errorf("failed to patch postgres password: %v (%s)", err, strings.ReplaceAll(strings.TrimSpace(output), "\n", "\\n"))
+					return fmt.Errorf("failed to patch postgres passwords: %v (%s)", err, strings.ReplaceAll(strings.TrimSpace(output), "\n", "\\n"))
 				}
-				return nil
+				if config.Database.Archive != nil {
+					if err := shareArchive(ctx, docker, cid); err != nil {
+						return err
+					}
+				}
+				return provisionExtensions(ctx, docker, cid, config.Database)
 			},
 			EmbeddedFiles: []EmbeddedFile{
+				{
+					Path: postgresConfigFile,
+					Data: conf,
+				},
 				{
 					Path: "/etc/postgresql-custom/pgsodium_root.key",
 					Data: []byte(config.Keys.PgSodiumEncryption),
@@ -311,10 +312,6 @@ ALTER USER supabase_storage_admin  WITH PASSWORD '%s';
 					Data: postgres.WebhooksSQL,
 					Path: "/docker-entrypoint-initdb.d/init-scripts/98-webhooks.sql",
 				},
-				{
-					Data: postgres.RolesSQL,
-					Path: "/docker-entrypoint-initdb.d/init-scripts/99-roles.sql",
-				},
 				{
 					Data: postgres.JwtSQL,
 					Path: "/docker-entrypoint-initdb.d/init-scripts/99-jwt.sql",
@@ -332,35 +329,35 @@ ALTER USER supabase_storage_admin  WITH PASSWORD '%s';
 					Path: "/docker-entrypoint-initdb.d/migrations/99-pooler.sql",
 				},
 			},
-		}
+		}, nil
 	},
 
-	Postgrest: func(config Config) Service {
-		return Service{
+	Postgrest: withDatabaseRole("authenticator", func(config Config) (Service, error) {
+		svc := Service{
 			Image:   "postgrest/postgrest:v12.2.12",
 			Name:    containerName(config, "supago-rest"),
 			Aliases: []string{"rest"},
 			Cmd:     []string{"postgrest"},
-			Env: []string{
-				fmt.Sprintf("PGRST_DB_URI=postgres://authenticator:%s@%s:5432/postgres", config.Database.Password, containerName(config, dbContainerName)),
-				"PGRST_DB_SCHEMAS=public",
-				"PGRST_DB_ANON_ROLE=anon",
-				fmt.Sprintf("PGRST_JWT_SECRET=%s", config.Keys.JwtSecret),
-				"PGRST_DB_USE_LEGACY_GUCS=false",
-				fmt.Sprintf("PGRST_APP_SETTINGS_JWT_SECRET=%s", config.Keys.JwtSecret),
-				"PGRST_APP_SETTINGS_JWT_EXP=3600",
-				"PGRST_ADMIN_SERVER_PORT=3001",
+			Env: map[string]string{
+				"PGRST_DB_URI":                  fmt.Sprintf("postgres://authenticator:%s@%s:5432/postgres", config.Database.RolePassword("authenticator"), containerName(config, dbContainerName)),
+				"PGRST_JWT_SECRET":              config.Keys.verifier(),
+				"PGRST_DB_USE_LEGACY_GUCS":      "false",
+				"PGRST_APP_SETTINGS_JWT_SECRET": config.Keys.JwtSecret,
+				"PGRST_APP_SETTINGS_JWT_EXP":    "3600",
+				"PGRST_ADMIN_SERVER_PORT":       "3001",
 			},
 		}
-	},
+		maps.Copy(svc.Env, config.Rest.env())
+		return svc, nil
+	}),
 
-	Realtime: func(config Config) Service {
-		return Service{
-			Name:  "realtime-dev.supabase-realtime",
+	Realtime: withDatabaseRole("supabase_admin", func(config Config) (Service, error) {
+		svc := Service{
+			Name:  containerName(config, "supago-realtime"),
 			Image: "supabase/realtime:v2.34.47",
 			Aliases: []string{
 				"supago-realtime",
-				"realtime-dev.supabase-realtime",
+				"realtime-dev.supabase-realtime", // Kong proxies to it: Realtime takes its tenant from the subdomain
 				"realtime",
 			},
 			Healthcheck: &container.HealthConfig{
@@ -379,41 +376,37 @@ ALTER USER supabase_storage_admin  WITH PASSWORD '%s';
 				Timeout:  5 * time.Second,
 				Retries:  3,
 			},
-			Env: []string{
-				fmt.Sprintf("%s=%s", "PORT", "4000"),
-				fmt.Sprintf("%s=%s", "DB_HOST", containerName(config, dbContainerName)),
-				fmt.Sprintf("%s=%s", "DB_PORT", "5432"),
-				fmt.Sprintf("%s=%s", "DB_USER", "supabase_admin"),
-				fmt.Sprintf("%s=%s", "DB_PASSWORD", config.Database.Password),
-				fmt.Sprintf("%s=%s", "DB_NAME", "postgres"),
-				fmt.Sprintf("%s=%s", "DB_AFTER_CONNECT_QUERY", "SET search_path TO _realtime"),
-				fmt.Sprintf("%s=%s", "DB_ENC_KEY", "supabaserealtime"),
-				fmt.Sprintf("%s=%s", "API_JWT_SECRET", config.Keys.JwtSecret),
-				fmt.Sprintf("%s=%s", "SECRET_KEY_BASE", utils.RandomString(64)),
-				fmt.Sprintf("%s=%s", "ERL_AFLAGS", "-proto_dist inet_tcp"),
-				fmt.Sprintf("%s=%s", "DNS_NODES", "''"),
-				fmt.Sprintf("%s=%s", "RLIMIT_NOFILE", "10000"),
-				fmt.Sprintf("%s=%s", "APP_NAME", "realtime"),
-				fmt.Sprintf("%s=%s", "SEED_SELF_HOST", "true"),
-				fmt.Sprintf("%s=%s", "RUN_JANITOR", "true"),
+			Env: map[string]string{
+				"PORT":                   "4000",
+				"DB_HOST":                containerName(config, dbContainerName),
+				"DB_PORT":                "5432",
+				"DB_USER":                "supabase_admin",
+				"DB_PASSWORD":            config.Database.RolePassword("supabase_admin"),
+				"DB_NAME":                "postgres",
+				"DB_AFTER_CONNECT_QUERY": "SET search_path TO _realtime",
+				"DB_ENC_KEY":             "supabaserealtime",
+				"API_JWT_SECRET":         config.Keys.legacySecret(),
+				"SECRET_KEY_BASE":        config.Keys.derivedSecret("realtime secret key base"),
+				"ERL_AFLAGS":             "-proto_dist inet_tcp",
+				"DNS_NODES":              "''",
+				"RLIMIT_NOFILE":          "10000",
+				"APP_NAME":               "realtime",
+				"SEED_SELF_HOST":         "true",
+				"RUN_JANITOR":            "true",
 			},
 		}
-	},
+		if config.Keys.verificationJWKS != "" {
+			svc.Env["API_JWT_JWKS"] = config.Keys.verificationJWKS
+		}
+		return svc, nil
+	}),
 
-	Storage: func(config Config) Service {
-		if info, err := os.Stat(config.Storage.DataDirectory); err != nil {
-			if os.IsNotExist(err) {
-				if err := os.MkdirAll(config.Storage.DataDirectory, 0o700); err != nil {
-					panic(fmt.Sprintf("storage data directory \"%s\" does not exist and an error occurred while trying to create it: %v", config.Storage.DataDirectory, err))
-				}
-			} else {
-				panic(fmt.Sprintf("error checking storage data directory \"%s\" exists: %v", config.Storage.DataDirectory, err))
-			}
-		} else if !info.IsDir() {
-			panic(fmt.Sprintf("storage directory \"%s\" exists but is not a directory", config.Storage.DataDirectory))
+	Storage: withDatabaseRole("supabase_storage_admin", func(config Config) (Service, error) {
+		if err := ensureDirectory("storage data directory", config.Storage.DataDirectory, 0o700); err != nil {
+			return Service{}, err
 		}
 
-		return Service{
+		svc := Service{
 			Name:    containerName(config, "supabase-storage"),
 			Image:   "supabase/storage-api:v1.25.7",
 			Aliases: []string{"storage"},
@@ -437,26 +430,29 @@ ALTER USER supabase_storage_admin  WITH PASSWORD '%s';
 					Target: "/var/lib/storage",
 				},
 			},
-			Env: []string{
-				fmt.Sprintf("%s=%s", "ANON_KEY", config.Keys.PublicJwt),
-				fmt.Sprintf("%s=%s", "SERVICE_KEY", config.Keys.PrivateJwt),
-				fmt.Sprintf("%s=%s", "POSTGREST_URL", "http://rest:3000"),
-				fmt.Sprintf("%s=%s", "PGRST_JWT_SECRET", config.Keys.JwtSecret),
-				fmt.Sprintf("%s=%s", "DATABASE_URL",
-					fmt.Sprintf("postgres://supabase_storage_admin:%s@%s:5432/postgres", config.Database.Password, containerName(config, dbContainerName))),
-				fmt.Sprintf("%s=%s", "FILE_SIZE_LIMIT", "52428800"),
-				fmt.Sprintf("%s=%s", "STORAGE_BACKEND", "file"),
-				fmt.Sprintf("%s=%s", "FILE_STORAGE_BACKEND_PATH", "/var/lib/storage"),
-				fmt.Sprintf("%s=%s", "TENANT_ID", "stub"),
-				fmt.Sprintf("%s=%s", "REGION", "stub"),
-				fmt.Sprintf("%s=%s", "GLOBAL_S3_BUCKET", "stub"),
-				fmt.Sprintf("%s=%s", "ENABLE_IMAGE_TRANSFORMATION", "true"),
-				fmt.Sprintf("%s=%s", "IMGPROXY_URL", "http://imgproxy:5001"),
+			Env: map[string]string{
+				"ANON_KEY":                    config.Keys.PublicJwt,
+				"SERVICE_KEY":                 config.Keys.PrivateJwt,
+				"POSTGREST_URL":               "http://rest:3000",
+				"PGRST_JWT_SECRET":            config.Keys.legacySecret(),
+				"DATABASE_URL":                fmt.Sprintf("postgres://supabase_storage_admin:%s@%s:5432/postgres", config.Database.RolePassword("supabase_storage_admin"), containerName(config, dbContainerName)),
+				"FILE_SIZE_LIMIT":             "52428800",
+				"STORAGE_BACKEND":             "file",
+				"FILE_STORAGE_BACKEND_PATH":   "/var/lib/storage",
+				"TENANT_ID":                   "stub",
+				"REGION":                      "stub",
+				"GLOBAL_S3_BUCKET":            "stub",
+				"ENABLE_IMAGE_TRANSFORMATION": "true",
+				"IMGPROXY_URL":                "http://imgproxy:5001",
 			},
 		}
-	},
+		if config.Keys.verificationJWKS != "" {
+			svc.Env["JWT_JWKS"] = config.Keys.verificationJWKS
+		}
+		return svc, nil
+	}),
 
-	Studio: func(config Config) Service {
+	Studio: withDatabaseRole("postgres", func(config Config) (Service, error) {
 		return Service{
 			Image:   "supabase/studio:2025.06.30-sha-6f5982d",
 			Name:    containerName(config, "supabase-studio"),
@@ -472,34 +468,77 @@ ALTER USER supabase_storage_admin  WITH PASSWORD '%s';
 				Timeout:  10 * time.Second,
 				Retries:  3,
 			},
-			Env: []string{
+			Env: map[string]string{
+				"HOSTNAME": "0.0.0.0",
 
-				"HOSTNAME=0.0.0.0",
+				"STUDIO_PG_META_URL": "http://meta:8080",
+				"POSTGRES_PASSWORD":  config.Database.RolePassword("postgres"),
 
-				fmt.Sprintf("%s=%s", "STUDIO_PG_META_URL", "http://meta:8080"),
-				fmt.Sprintf("%s=%s", "POSTGRES_PASSWORD", config.Database.Password),
+				"DEFAULT_ORGANIZATION_NAME": "Supago",
+				"DEFAULT_PROJECT_NAME":      "Supago",
+				//"OPENAI_API_KEY": "",
 
-				fmt.Sprintf("%s=%s", "DEFAULT_ORGANIZATION_NAME", "Supago"),
-				fmt.Sprintf("%s=%s", "DEFAULT_PROJECT_NAME", "Supago"),
-				//fmt.Sprintf("%s=%s", "OPENAI_API_KEY", ""),
+				"SUPABASE_URL":         "http://kong:8000",
+				"SUPABASE_PUBLIC_URL":  fmt.Sprintf("http://127.0.0.1:%d", config.Kong.hostPort()),
+				"SUPABASE_ANON_KEY":    config.Keys.PublicJwt,
+				"SUPABASE_SERVICE_KEY": config.Keys.PrivateJwt,
+				"AUTH_JWT_SECRET":      config.Keys.JwtSecret,
 
-				fmt.Sprintf("%s=%s", "SUPABASE_URL", "http://kong:8000"),
-				fmt.Sprintf("%s=%s", "SUPABASE_PUBLIC_URL", "http://127.0.0.1:8000"),
-				fmt.Sprintf("%s=%s", "SUPABASE_ANON_KEY", config.Keys.PublicJwt),
-				fmt.Sprintf("%s=%s", "SUPABASE_SERVICE_KEY", config.Keys.PrivateJwt),
-				fmt.Sprintf("%s=%s", "AUTH_JWT_SECRET", config.Keys.JwtSecret),
-
-				fmt.Sprintf("%s=%s", "LOGFLARE_PRIVATE_ACCESS_TOKEN", config.LogFlare.PrivateKey),
-				fmt.Sprintf("%s=%s", "LOGFLARE_URL", "http://analytics:4000"),
-				fmt.Sprintf("%s=%s", "NEXT_PUBLIC_ENABLE_LOGS", "true"),
-				fmt.Sprintf("%s=%s", "NEXT_ANALYTICS_BACKEND_PROVIDER", "postgres"),
+				"LOGFLARE_PRIVATE_ACCESS_TOKEN":   config.LogFlare.PrivateKey,
+				"LOGFLARE_URL":                    "http://analytics:4000",
+				"NEXT_PUBLIC_ENABLE_LOGS":         "true",
+				"NEXT_ANALYTICS_BACKEND_PROVIDER": "postgres",
 			},
-		}
-	},
+		}, nil
+	}),
 }
 
 const dbContainerName = "supago-db"
 
+// withDatabaseRole restricts the database credentials a constructor receives to those of the role it connects as
+func withDatabaseRole(role string, constructor ServiceConstructor) ServiceConstructor {
+	return func(config Config) (Service, error) {
+		config.Database = config.Database.scopedTo(role)
+		return constructor(config)
+	}
+}
+
+// withoutDatabaseRoles withholds all database credentials from a constructor (for services not connecting to it)
+func withoutDatabaseRoles(constructor ServiceConstructor) ServiceConstructor {
+	return func(config Config) (Service, error) {
+		config.Database = config.Database.scopedTo()
+		return constructor(config)
+	}
+}
+
+// ensureDirectory creates dir (described by kind in errors) unless it exists, failing if it is not a directory
+func ensureDirectory(kind, dir string, perm os.FileMode) error {
+	if info, err := os.Stat(dir); err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("error checking %s \"%s\" exists: %w", kind, dir, err)
+		} else if err := os.MkdirAll(dir, perm); err != nil {
+			return fmt.Errorf("%s \"%s\" does not exist and an error occurred while trying to create it: %w", kind, dir, err)
+		}
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s \"%s\" exists but is not a directory", kind, dir)
+	}
+	return nil
+}
+
+// alterRolePasswordsSQL sets the password of every managed role
+func alterRolePasswordsSQL(database DatabaseConfig) string {
+	var sql strings.Builder
+	sql.WriteString("BEGIN;\n")
+	for _, role := range databaseRoles {
+		sql.WriteString(fmt.Sprintf(
+			"DO $$ BEGIN IF EXISTS (SELECT 1 FROM pg_roles WHERE rolname = %s) THEN ALTER ROLE %s WITH PASSWORD %s; END IF; END $$;\n",
+			utils.QuoteLiteral(role), utils.QuoteIdentifier(role), utils.QuoteLiteral(database.RolePassword(role)),
+		))
+	}
+	sql.WriteString("COMMIT;\n")
+	return sql.String()
+}
+
 func containerName(config Config, name string) string {
 	if !IsValidPlatformName(config.Global.PlatformName) {
 		return name
@@ -0,0 +1,29 @@
+package supago
+
+import (
+	"maps"
+	"testing"
+)
+
+// rebuilding a service from an unchanged config must not change its definition (it would be needlessly recreated)
+func TestServicesRebuildDeterministically(t *testing.T) {
+	cfg, err := newBaseConfig("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Database.DataDirectory = t.TempDir()
+	cfg.Storage.DataDirectory = t.TempDir()
+	for _, constructor := range Services.All() {
+		a, err := constructor(*cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := constructor(*cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !maps.Equal(a.Env, b.Env) {
+			t.Errorf("%s: env differs between constructions", a.Name)
+		}
+	}
+}
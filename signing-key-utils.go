@@ -0,0 +1,140 @@
+package supago
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/train360-corp/supago/internal/jwk"
+	"os"
+	"path/filepath"
+)
+
+func createSigningKeyFile(path string, algorithm SigningAlgorithm) error {
+	key, err := jwk.Generate(string(algorithm))
+	if err != nil {
+		return fmt.Errorf("key file \"%s\" does not exist and an error occurred while trying to create it: %v", path, err)
+	}
+	data, err := jwk.EncodePEM(key)
+	if err != nil {
+		return fmt.Errorf("key file \"%s\" does not exist and an error occurred while trying to create it: %v", path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("key file \"%s\" does not exist and an error occurred while trying to create it: %v", path, err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("key file \"%s\" does not exist and an error occurred while trying to create it: %v", path, err)
+	}
+	return nil
+}
+
+// readSigningKeyFile returns the parsed signing key.
+// It enforces perms <= 0600 and a PKCS#8 key matching the algorithm.
+func readSigningKeyFile(path string, algorithm SigningAlgorithm) (*SigningKey, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("key file %q does not exist", path)
+		}
+		return nil, fmt.Errorf("error statting key file %q: %w", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("key file %q exists but is not a regular file", path)
+	}
+
+	// Enforce strict permissions: owner rw only (0600). Reject if group/others have bits.
+	if info.Mode().Perm()&0o177 != 0 {
+		return nil, fmt.Errorf("insecure permissions on %q: got %o, want 0600", path, info.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key file %q: %w", path, err)
+	}
+
+	if key, err := jwk.DecodePEM(data, string(algorithm)); err != nil {
+		return nil, fmt.Errorf("invalid key file %q: %w", path, err)
+	} else {
+		return &SigningKey{Algorithm: algorithm, Private: key}, nil
+	}
+}
+
+// signer the method, key and key id the current keys sign JWTs with
+func (k KeysConfig) signer() (jwt.SigningMethod, any, string, error) {
+	if k.SigningKey != nil {
+		kid, err := k.SigningKey.KeyID()
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("failed to derive signing key id: %v", err)
+		}
+		return k.SigningKey.method(), k.SigningKey.Private, kid, nil
+	}
+	if !k.keyIDs {
+		return jwt.SigningMethodHS256, []byte(k.JwtSecret), "", nil
+	}
+	oct, err := jwk.Symmetric([]byte(k.JwtSecret))
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to derive signing key id: %v", err)
+	}
+	return jwt.SigningMethodHS256, []byte(k.JwtSecret), oct.Kid, nil
+}
+
+// deriveJWKS constructs the public, signing and verification key sets from the current (and any retiring) keys
+func (k *KeysConfig) deriveJWKS() error {
+	k.JWKS, k.signingJWKs, k.verificationJWKS = "", "", ""
+	if !k.keyIDs {
+		return nil
+	}
+
+	public := jwk.Set{Keys: []jwk.Key{}}
+	verification := jwk.Set{Keys: []jwk.Key{}}
+	signing := []jwk.Key{}
+
+	add := func(secret string, key *SigningKey, sign bool) error {
+		if key != nil {
+			pub, err := jwk.Public(key.Private, string(key.Algorithm))
+			if err != nil {
+				return fmt.Errorf("failed to construct public jwk: %v", err)
+			}
+			priv, err := jwk.Private(key.Private, string(key.Algorithm))
+			if err != nil {
+				return fmt.Errorf("failed to construct private jwk: %v", err)
+			}
+			if !sign {
+				priv.KeyOps = []string{"verify"}
+			}
+			public.Keys = append(public.Keys, pub)
+			verification.Keys = append(verification.Keys, pub)
+			signing = append(signing, priv)
+		} else if secret != "" {
+			ops := []string{"verify"}
+			if sign {
+				ops = []string{"sign", "verify"}
+			}
+			oct, err := jwk.Symmetric([]byte(secret), ops...)
+			if err != nil {
+				return fmt.Errorf("failed to construct symmetric jwk: %v", err)
+			}
+			verification.Keys = append(verification.Keys, oct)
+			signing = append(signing, oct)
+		}
+		return nil
+	}
+
+	if err := add(k.JwtSecret, k.SigningKey, true); err != nil {
+		return err
+	}
+	if k.Retiring != nil {
+		if err := add(k.Retiring.JwtSecret, k.Retiring.SigningKey, false); err != nil {
+			return err
+		}
+	}
+
+	for dst, src := range map[*string]any{&k.JWKS: public, &k.signingJWKs: signing, &k.verificationJWKS: verification} {
+		data, err := json.Marshal(src)
+		if err != nil {
+			return fmt.Errorf("failed to marshal jwks: %v", err)
+		}
+		*dst = string(data)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package supago
+
+import (
+	"crypto"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/train360-corp/supago/internal/jwk"
+	"os"
+	"path/filepath"
+)
+
+type SigningAlgorithm string
+
+const (
+	SigningAlgorithmRS256 SigningAlgorithm = jwk.RS256
+	SigningAlgorithmES256 SigningAlgorithm = jwk.ES256
+)
+
+// SigningKey is an asymmetric key used to sign JWTs in place of the shared KeysConfig.JwtSecret
+type SigningKey struct {
+	Algorithm SigningAlgorithm
+	Private   crypto.Signer
+}
+
+// KeyID the RFC 7638 thumbprint of the public key (used as the JWT "kid" header)
+func (k SigningKey) KeyID() (string, error) {
+	pub, err := jwk.Public(k.Private, string(k.Algorithm))
+	if err != nil {
+		return "", err
+	}
+	return pub.Kid, nil
+}
+
+func (k SigningKey) method() jwt.SigningMethod {
+	if k.Algorithm == SigningAlgorithmES256 {
+		return jwt.SigningMethodES256
+	}
+	return jwt.SigningMethodRS256
+}
+
+type SigningKeyGetter func() (*SigningKey, error)
+
+type GetSigningKeyFrom[T any] func(T) SigningKeyGetter
+
+// StaticSigningKey pass a static (or self-retrieved, from external means/methods) PKCS#8 PEM-encoded signing key
+func StaticSigningKey(algorithm SigningAlgorithm) GetSigningKeyFrom[[]byte] {
+	return func(data []byte) SigningKeyGetter {
+		return func() (*SigningKey, error) {
+			key, err := jwk.DecodePEM(data, string(algorithm))
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s signing key: %v", algorithm, err)
+			}
+			return &SigningKey{Algorithm: algorithm, Private: key}, nil
+		}
+	}
+}
+
+// SigningKeyFromConfig construct a signing key from a Config
+func SigningKeyFromConfig(algorithm SigningAlgorithm) GetSigningKeyFrom[Config] {
+	return func(config Config) SigningKeyGetter {
+		// save the file one level up from the database's own data directory (next to the pgsodium key)
+		name := fmt.Sprintf("jwt_signing_%s.pem", algorithm)
+		return SigningKeyFromFile(algorithm)(filepath.Join(filepath.Dir(config.Database.DataDirectory), name))
+	}
+}
+
+// SigningKeyFromFile retrieve a PKCS#8 PEM-encoded signing key from a file (at `path`)
+// If `path` does not exist, SigningKeyFromFile will attempt to generate a new key there
+func SigningKeyFromFile(algorithm SigningAlgorithm) GetSigningKeyFrom[string] {
+	return func(path string) SigningKeyGetter {
+		return func() (*SigningKey, error) {
+			if info, err := os.Stat(path); err != nil {
+				if os.IsNotExist(err) {
+					// create the file
+					if err := createSigningKeyFile(path, algorithm); err != nil {
+						return nil, err
+					}
+
+					// read from the created file
+					return readSigningKeyFile(path, algorithm)
+				} else {
+					return nil, fmt.Errorf("error checking jwt signing key file \"%s\" exists: %v", path, err)
+				}
+			} else if info.IsDir() {
+				return nil, fmt.Errorf("jwt signing key file \"%s\" exists but is not a file", path)
+			} else {
+				// read from the file
+				return readSigningKeyFile(path, algorithm)
+			}
+		}
+	}
+}
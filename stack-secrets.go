@@ -0,0 +1,66 @@
+package supago
+
+import (
+	"path/filepath"
+)
+
+// SecretsStore persists a stack's generated secrets (by name; see Config.secrets) across restarts and processes, so
+// that every process building the stack's config (e.g., the supago CLI, next to the program running the stack) agrees
+// on them; database passwords are persisted separately (see DatabaseCredentialsStore)
+type SecretsStore interface {
+	// Load returns the stored secrets (nil, without error, when none have been stored yet)
+	Load() (map[string]string, error)
+	// Save replaces the stored secrets
+	Save(secrets map[string]string) error
+}
+
+// SecretsFromConfig store secrets next to the database's own data directory
+func SecretsFromConfig(config Config) SecretsStore {
+	// save the file one level up from the database's own data directory (next to the database credentials)
+	return SecretsFile(filepath.Join(filepath.Dir(config.Database.DataDirectory), "stack_secrets.json"))
+}
+
+// SecretsFile store secrets as JSON in a file (at `path`, created with 0600 permissions)
+func SecretsFile(path string) SecretsStore {
+	return databaseCredentialsFile(path) // the same format (names to values), and permissions
+}
+
+// secrets the config's generated secrets (and the keys of any rotation), by name
+func (c Config) secrets() (map[string]string, error) {
+	secrets := c.generatedSecrets()
+	if err := c.Keys.addRotatedSecrets(secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+// generatedSecrets the config's secrets SupaGo generates unless set, by name
+func (c Config) generatedSecrets() map[string]string {
+	return map[string]string{
+		"jwt_secret":           c.Keys.JwtSecret,
+		"dashboard_username":   c.Dashboard.Username,
+		"dashboard_password":   c.Dashboard.Password,
+		"logflare_public_key":  c.LogFlare.PublicKey,
+		"logflare_private_key": c.LogFlare.PrivateKey,
+		"auth_hooks_secret":    c.Auth.Hooks.Secret,
+	}
+}
+
+// withSecrets a copy of the config using secrets (those missing from secrets are kept)
+// The anon and service keys are not re-signed with a changed JWT secret, and rotated keys are not restored (see
+// rotatedKeys).
+func (c Config) withSecrets(secrets map[string]string) Config {
+	for name, field := range map[string]*string{
+		"jwt_secret":           &c.Keys.JwtSecret,
+		"dashboard_username":   &c.Dashboard.Username,
+		"dashboard_password":   &c.Dashboard.Password,
+		"logflare_public_key":  &c.LogFlare.PublicKey,
+		"logflare_private_key": &c.LogFlare.PrivateKey,
+		"auth_hooks_secret":    &c.Auth.Hooks.Secret,
+	} {
+		if secret := secrets[name]; secret != "" {
+			*field = secret
+		}
+	}
+	return c
+}
@@ -0,0 +1,217 @@
+package supago
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/train360-corp/supago/internal/utils"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// ServiceStatus the state of a service's container
+type ServiceStatus struct {
+	Service string // the service's (container) name
+	Image   string
+	State   string   // e.g., "running" or "exited"; empty if the service has no container
+	Health  string   // e.g., "healthy" or "starting"; empty if the container has no health check
+	Ports   []string // published ports (e.g., "127.0.0.1:8000->8000/tcp")
+}
+
+type LogsOptions struct {
+	// Follow keep streaming new output
+	Follow bool
+	// Tail the number of lines to show from the end of the logs (all if zero)
+	Tail int
+	// Timestamps prefix every line with its timestamp
+	Timestamps bool
+}
+
+// Attach binds the instance to the containers of an already running stack (e.g., started by another process), so
+// operations such as Backup, Restore or Restart act on them; services without a running container stay unattached
+func (sg *SupaGo) Attach(ctx context.Context) error {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	if err := sg.connect(); err != nil {
+		return err
+	} else if err := sg.ensureNetwork(ctx); err != nil {
+		return fmt.Errorf("failed to setup docker network: %w", err)
+	}
+	for _, service := range sg.services {
+		inspected, err := sg.docker.ContainerInspect(ctx, service.Name)
+		if client.IsErrNotFound(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to inspect %v: %w", service, err)
+		}
+		if inspected.State != nil && inspected.State.Running {
+			service.container = &container.CreateResponse{ID: inspected.ID}
+			sg.logger.Debugf("attached to %v container %s", service, utils.ShortStr(inspected.ID))
+		}
+	}
+	return nil
+}
+
+// Down stops and removes the container of every service (whether this instance started it or not), in reverse
+func (sg *SupaGo) Down(ctx context.Context) error {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	if err := sg.connect(); err != nil {
+		return err
+	}
+	for i := range sg.services {
+		service := sg.services[len(sg.services)-i-1]
+		if service.container != nil {
+			if service.closeConn != nil {
+				service.closeConn()
+			}
+			sg.stopContainer(service)
+			sg.removeContainer(service)
+			service.container, service.closeConn = nil, nil
+		} else {
+			sg.removeContainerByName(ctx, service.Name)
+		}
+	}
+	sg.stopAuthCallbacks()
+	return nil
+}
+
+// Status the state of every service's container, in start order
+func (sg *SupaGo) Status(ctx context.Context) ([]ServiceStatus, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	if err := sg.connect(); err != nil {
+		return nil, err
+	}
+	statuses := make([]ServiceStatus, 0, len(sg.services))
+	for _, service := range sg.services {
+		status := ServiceStatus{Service: service.Name, Image: service.Image}
+		inspected, err := sg.docker.ContainerInspect(ctx, service.Name)
+		if client.IsErrNotFound(err) {
+			statuses = append(statuses, status)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to inspect %v: %w", service, err)
+		}
+		if inspected.Config != nil {
+			status.Image = inspected.Config.Image
+		}
+		if inspected.State != nil {
+			status.State = inspected.State.Status
+			if inspected.State.Health != nil {
+				status.Health = inspected.State.Health.Status
+			}
+		}
+		if inspected.NetworkSettings != nil {
+			for port, bindings := range inspected.NetworkSettings.Ports {
+				for _, binding := range bindings {
+					status.Ports = append(status.Ports, fmt.Sprintf("%s:%s->%s", binding.HostIP, binding.HostPort, port))
+				}
+			}
+			sort.Strings(status.Ports)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Logs writes the output of a service's container to w (see Restart for how services are looked up)
+func (sg *SupaGo) Logs(ctx context.Context, name string, w io.Writer, opts LogsOptions) error {
+	sg.mu.Lock()
+	service := sg.service(name)
+	err := sg.connect()
+	sg.mu.Unlock()
+	if service == nil {
+		return fmt.Errorf("no service %q", name)
+	} else if err != nil {
+		return err
+	}
+
+	tail := "all"
+	if opts.Tail > 0 {
+		tail = strconv.Itoa(opts.Tail)
+	}
+	logs, err := sg.docker.ContainerLogs(ctx, service.Name, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opts.Follow,
+		Tail:       tail,
+		Timestamps: opts.Timestamps,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read logs of %v: %w", service, err)
+	}
+	defer logs.Close()
+	if _, err := stdcopy.StdCopy(w, w, logs); err != nil && !errors.Is(err, context.Canceled) {
+		return fmt.Errorf("failed to read logs of %v: %w", service, err)
+	}
+	return nil
+}
+
+// Restart restarts a running service's container in place (keeping its configuration), and waits for it to be healthy
+// The service is looked up by its container name, or by a network alias (e.g., "db", "kong" or "rest").
+func (sg *SupaGo) Restart(ctx context.Context, name string) error {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	service := sg.service(name)
+	if service == nil {
+		return fmt.Errorf("no service %q", name)
+	} else if service.container == nil || sg.docker == nil {
+		return fmt.Errorf("%v is not running", service)
+	}
+	sg.logger.Infof("restarting %v", service)
+	timeout := 15
+	if service.StopTimeout != nil {
+		timeout = int(service.StopTimeout.Seconds())
+	}
+	if err := sg.docker.ContainerRestart(ctx, service.container.ID, container.StopOptions{Timeout: &timeout}); err != nil {
+		return fmt.Errorf("failed to restart %v: %w", service, err)
+	} else if err := sg.healthcheckContainer(ctx, service, 0); err != nil {
+		return fmt.Errorf("failed to restart %v: %w", service, err)
+	}
+	return nil
+}
+
+// Services the definitions (image, ports, mounts, env, etc.) of the stack's services, in start order
+func (sg *SupaGo) Services() []Service {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	services := make([]Service, len(sg.services))
+	for i, service := range sg.services {
+		services[i] = *service
+		services[i].container, services[i].closeConn = nil, nil
+	}
+	return services
+}
+
+// service the service named name: its container name (e.g., "platform-supago-db"), the same without the platform
+// prefix ("supago-db"), or one of its network aliases ("db")
+// The caller must hold sg.mu
+func (sg *SupaGo) service(name string) *Service {
+	for _, service := range sg.services {
+		if service.Name == name || service.Name == containerName(sg.config, name) || service.hasAlias(name) {
+			return service
+		}
+	}
+	return nil
+}
+
+// connect connects to docker, unless already connected
+// The caller must hold sg.mu
+func (sg *SupaGo) connect() error {
+	if sg.docker != nil {
+		return nil
+	} else if err := sg.setupDocker(); err != nil {
+		return fmt.Errorf("failed to setup docker connection: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+// Package supagotest runs integration tests against a SupaGo stack
+// The stack is booted once per test binary (on first use), and every test gets its own database, copied from a
+// template of the stack's migrated database, which is dropped when the test ends:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(supagotest.Main(m, supagotest.Options{Migrations: []fs.FS{migrations}}))
+//	}
+//
+//	func TestSomething(t *testing.T) {
+//		env := supagotest.New(t)
+//		rows, err := env.DB.Query(ctx, "SELECT ...")
+//	}
+//
+// Only databases are isolated: the stack's APIs (PostgREST, GoTrue, Storage) serve the stack's own "postgres" database,
+// which every test would share, so Env offers no API URLs or keys.
+package supagotest
+
+import (
+	"context"
+	"fmt"
+	"github.com/train360-corp/supago"
+	"go.uber.org/zap"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// prefix of every database supagotest creates (dropped when the stack boots, in case a run was interrupted)
+const prefix = "supagotest_"
+
+// template the database every test database is copied from
+const template = prefix + "template"
+
+type Options struct {
+	// Platform the name of the test stack (defaults to "supagotest")
+	Platform string
+	// Directory the stack's data is kept in, across runs (defaults to a directory in os.TempDir)
+	Directory string
+	// KongPort the host port of the stack's Kong (defaults to 58000, so a development stack can run alongside)
+	KongPort uint16
+	// Services the services of the stack (defaults to supago.Services.All)
+	Services func() []supago.ServiceConstructor
+	// Migrations applied to the stack's database (and so to every test database)
+	Migrations []fs.FS
+	// Seeds loaded when the stack's database is first initialized
+	Seeds []fs.FS
+	// Configure (optional) adjusts the stack's config before it boots
+	Configure func(config *supago.Config)
+	// Logger (optional) the stack's logger (defaults to none)
+	Logger *zap.SugaredLogger
+	// Timeout for the stack to boot (defaults to 5 minutes)
+	Timeout time.Duration
+}
+
+var (
+	options Options
+	once    sync.Once
+	stack   *supago.SupaGo
+	bootErr error
+	counter atomic.Int64
+)
+
+// Main runs the tests (call it from TestMain), then stops the stack if a test booted it
+func Main(m *testing.M, opts Options) int {
+	options = opts
+	code := m.Run()
+	if stack != nil {
+		stack.Stop()
+	}
+	return code
+}
+
+// Env a test's view of the shared stack
+type Env struct {
+	// Stack the shared stack (shared with every other test, as is everything reached through it other than DB)
+	Stack *supago.SupaGo
+	// DB the test's own database (connected as postgres), dropped when the test ends
+	DB *supago.Database
+}
+
+// New returns the test's environment, booting the shared stack on first use (failing the test if it cannot boot)
+func New(t testing.TB) *Env {
+	t.Helper()
+	once.Do(func() {
+		stack, bootErr = boot()
+	})
+	if bootErr != nil {
+		t.Fatalf("supagotest: failed to boot stack: %v", bootErr)
+	}
+
+	ctx := context.Background()
+	name := databaseName(t.Name(), counter.Add(1))
+	db, err := stack.CloneDatabase(ctx, name, supago.CloneDatabaseOptions{Template: template})
+	if err != nil {
+		t.Fatalf("supagotest: failed to create test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := stack.DropDatabase(context.Background(), name); err != nil {
+			t.Errorf("supagotest: failed to drop test database %q: %v", name, err)
+		}
+	})
+
+	return &Env{Stack: stack, DB: db}
+}
+
+// withDefaults opts, with defaults for the options left unset
+func withDefaults(opts Options) Options {
+	if opts.Platform == "" {
+		opts.Platform = "supagotest"
+	}
+	if opts.Directory == "" {
+		opts.Directory = filepath.Join(os.TempDir(), opts.Platform)
+	}
+	if opts.KongPort == 0 {
+		opts.KongPort = 58000
+	}
+	if opts.Services == nil {
+		opts.Services = supago.Services.All
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Minute
+	}
+	return opts
+}
+
+// boot builds and runs the shared stack, then (re)creates the template of test databases
+func boot() (*supago.SupaGo, error) {
+	opts := withDefaults(options)
+	cfg, err := supago.ConfigBuilder().
+		Platform(opts.Platform).
+		DataDirectory(opts.Directory).
+		KongPort(opts.KongPort).
+		BuildE()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build config: %w", err)
+	}
+	if opts.Configure != nil {
+		opts.Configure(cfg)
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid config: %w", err)
+		}
+	}
+
+	sg, err := supago.New(cfg).AddServices(opts.Services)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Logger != nil {
+		sg.SetLogger(opts.Logger)
+	}
+	for _, migrations := range opts.Migrations {
+		sg.AddMigrations(migrations)
+	}
+	for _, seeds := range opts.Seeds {
+		sg.AddSeeds(seeds)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+	if err := sg.RunForcefully(ctx); err != nil {
+		sg.Stop()
+		return nil, err
+	}
+
+	// drop what an interrupted run left behind, then copy the migrated database into the template
+	db, err := sg.Database()
+	if err == nil {
+		var rows [][]string
+		if rows, err = db.Query(ctx, fmt.Sprintf("SELECT datname FROM pg_database WHERE starts_with(datname, '%s');", prefix)); err == nil {
+			for _, row := range rows {
+				if err = sg.DropDatabase(ctx, row[0]); err != nil {
+					break
+				}
+			}
+		}
+	}
+	if err == nil {
+		_, err = sg.CloneDatabase(ctx, template, supago.CloneDatabaseOptions{})
+	}
+	if err != nil {
+		sg.Stop()
+		return nil, fmt.Errorf("failed to create template database: %w", err)
+	}
+	return sg, nil
+}
+
+// databaseName a unique database name for test n (within the 63 bytes postgres allows)
+func databaseName(test string, n int64) string {
+	suffix := fmt.Sprintf("_%d", n)
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		} else if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, test)
+	if max := 63 - len(prefix) - len(suffix); len(name) > max {
+		name = name[:max]
+	}
+	return prefix + name + suffix
+}
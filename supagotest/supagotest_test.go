@@ -0,0 +1,50 @@
+package supagotest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDatabaseName(t *testing.T) {
+	for _, tc := range []struct {
+		test string
+		n    int64
+		name string
+	}{
+		{"TestTodos", 1, "supagotest_testtodos_1"},
+		{"TestTodos/with space-and.dots", 12, "supagotest_testtodos_with_space_and_dots_12"},
+		{"TestÜnicode", 3, "supagotest_test_nicode_3"},
+	} {
+		if name := databaseName(tc.test, tc.n); name != tc.name {
+			t.Errorf("databaseName(%q, %d) = %q, expected %q", tc.test, tc.n, name, tc.name)
+		}
+	}
+
+	// long names are truncated to fit postgres' 63 bytes, keeping the (unique) suffix
+	long := "Test" + strings.Repeat("VeryLongSubtestName/", 10)
+	name := databaseName(long, 123456)
+	if len(name) != 63 {
+		t.Errorf("expected a 63 byte name, got %d bytes (%q)", len(name), name)
+	} else if !strings.HasPrefix(name, prefix+"testverylongsubtestname_") || !strings.HasSuffix(name, "_123456") {
+		t.Errorf("unexpected truncated name %q", name)
+	}
+	if databaseName(long, 1) == databaseName(long, 2) {
+		t.Error("expected tests sharing a truncated name to get distinct databases")
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	opts := withDefaults(Options{})
+	if opts.Platform != "supagotest" || opts.Directory != filepath.Join(os.TempDir(), "supagotest") ||
+		opts.KongPort != 58000 || opts.Services == nil || opts.Timeout != 5*time.Minute {
+		t.Errorf("unexpected defaults: %+v", opts)
+	}
+
+	opts = withDefaults(Options{Platform: "apitest", KongPort: 59000, Timeout: time.Minute})
+	if opts.Directory != filepath.Join(os.TempDir(), "apitest") || opts.KongPort != 59000 || opts.Timeout != time.Minute {
+		t.Errorf("expected set options to be kept (and the directory named after the platform), got %+v", opts)
+	}
+}
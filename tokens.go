@@ -0,0 +1,225 @@
+package supago
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/train360-corp/supago/internal/jwk"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TokenOptions describe a JWT to mint (e.g., to call PostgREST as a specific user, or for a background job)
+type TokenOptions struct {
+	Subject      string         // the user id ("sub")
+	Role         string         // the postgres role; defaults to "authenticated"
+	Audience     string         // defaults to "authenticated"
+	Email        string         // optional
+	AppMetadata  map[string]any // optional custom "app_metadata" claims
+	UserMetadata map[string]any // optional "user_metadata" claims
+	Claims       map[string]any // optional additional top-level claims
+	TTL          time.Duration  // defaults to one hour
+}
+
+// TokenClaims the claims of a (verified) Supabase JWT
+type TokenClaims struct {
+	jwt.RegisteredClaims
+	Role         string         `json:"role"`
+	Email        string         `json:"email,omitempty"`
+	Phone        string         `json:"phone,omitempty"`
+	AppMetadata  map[string]any `json:"app_metadata,omitempty"`
+	UserMetadata map[string]any `json:"user_metadata,omitempty"`
+	SessionID    string         `json:"session_id,omitempty"`
+	AAL          string         `json:"aal,omitempty"`
+	IsAnonymous  bool           `json:"is_anonymous,omitempty"`
+}
+
+// VerifyOptions what a verified token must be, besides validly signed and unexpired; the zero value accepts users'
+// tokens (audience "authenticated") only
+// Tokens of the anon role (e.g., the public anon key) are always rejected.
+type VerifyOptions struct {
+	Audience string // defaults to "authenticated"
+	// AllowServiceRole also accept service-role tokens (e.g., the service key, or tokens minted for background jobs),
+	// whatever their audience
+	AllowServiceRole bool
+}
+
+// MintToken signs a JWT accepted by every service of the stack
+func (c Config) MintToken(opts TokenOptions) (string, error) {
+	if opts.Role == "" {
+		opts.Role = "authenticated"
+	}
+	if opts.Audience == "" {
+		opts.Audience = "authenticated"
+	}
+	if opts.TTL == 0 {
+		opts.TTL = time.Hour
+	} else if opts.TTL < 0 {
+		return "", fmt.Errorf("invalid token ttl: %v", opts.TTL)
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for k, v := range opts.Claims {
+		claims[k] = v
+	}
+	claims["iss"] = fmt.Sprintf("%s/auth/v1", strings.TrimSuffix(c.Kong.URLs.Kong, "/"))
+	claims["aud"] = opts.Audience
+	claims["role"] = opts.Role
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(opts.TTL).Unix()
+	if opts.Subject != "" {
+		claims["sub"] = opts.Subject
+	}
+	if opts.Email != "" {
+		claims["email"] = opts.Email
+	}
+	if opts.AppMetadata != nil {
+		claims["app_metadata"] = opts.AppMetadata
+	}
+	if opts.UserMetadata != nil {
+		claims["user_metadata"] = opts.UserMetadata
+	}
+
+	method, key, kid, err := c.Keys.signer()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign %s JWT: %v", opts.Role, err)
+	}
+	return signed, nil
+}
+
+// VerifyToken parses a JWT and validates its signature (against current and retiring keys), expiry, audience and role
+func (c Config) VerifyToken(token string, opts VerifyOptions) (*TokenClaims, error) {
+	claims := &TokenClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, c.Keys.keyfunc,
+		jwt.WithValidMethods([]string{jwk.HS256, jwk.RS256, jwk.ES256}),
+		jwt.WithExpirationRequired(),
+	); err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	if claims.Role == "anon" {
+		return nil, errors.New("invalid token: anon tokens are not accepted")
+	} else if opts.AllowServiceRole && claims.Role == "service_role" {
+		return claims, nil
+	}
+	audience := opts.Audience
+	if audience == "" {
+		audience = "authenticated"
+	}
+	if err := jwt.NewValidator(jwt.WithAudience(audience), jwt.WithExpirationRequired()).Validate(claims); err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	return claims, nil
+}
+
+// keyfunc resolves the keys a token may be verified with; by "kid" when present
+// As in the key set services verify against (see deriveJWKS), a secret is only a key while no signing key replaces it.
+func (k KeysConfig) keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	var secrets []string
+	var signingKeys []*SigningKey
+	add := func(secret string, key *SigningKey) {
+		if key != nil {
+			signingKeys = append(signingKeys, key)
+		} else {
+			secrets = append(secrets, secret)
+		}
+	}
+	add(k.JwtSecret, k.SigningKey)
+	if k.Retiring != nil {
+		add(k.Retiring.JwtSecret, k.Retiring.SigningKey)
+	}
+
+	set := jwt.VerificationKeySet{}
+	switch token.Method.Alg() {
+	case jwk.HS256:
+		for _, secret := range secrets {
+			if secret == "" {
+				continue
+			} else if kid != "" {
+				if oct, err := jwk.Symmetric([]byte(secret)); err != nil || oct.Kid != kid {
+					continue
+				}
+			}
+			set.Keys = append(set.Keys, []byte(secret))
+		}
+	default:
+		for _, key := range signingKeys {
+			if key == nil || string(key.Algorithm) != token.Method.Alg() {
+				continue
+			} else if kid != "" {
+				if id, err := key.KeyID(); err != nil || id != kid {
+					continue
+				}
+			}
+			set.Keys = append(set.Keys, key.Private.Public())
+		}
+	}
+
+	if len(set.Keys) == 0 {
+		return nil, fmt.Errorf("no key found to verify %s token (kid=%q)", token.Method.Alg(), kid)
+	}
+	return set, nil
+}
+
+// MintToken signs a JWT accepted by every service of the stack (see Config.MintToken)
+func (sg *SupaGo) MintToken(opts TokenOptions) (string, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+	return sg.config.MintToken(opts)
+}
+
+// VerifyToken parses and validates a JWT issued by (or for) the stack (see Config.VerifyToken)
+func (sg *SupaGo) VerifyToken(token string, opts VerifyOptions) (*TokenClaims, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+	return sg.config.VerifyToken(token, opts)
+}
+
+// VerifyRequest validates the "Authorization: Bearer <jwt>" header of an incoming request
+func (sg *SupaGo) VerifyRequest(r *http.Request, opts VerifyOptions) (*TokenClaims, error) {
+	header := r.Header.Get("Authorization")
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return nil, errors.New("missing bearer token")
+	}
+	return sg.VerifyToken(strings.TrimSpace(token), opts)
+}
+
+type tokenClaimsContextKey struct{}
+
+// Authenticate wraps next, rejecting requests without a valid user JWT (401)
+// The verified claims are available to next via TokenClaimsFromContext
+func (sg *SupaGo) Authenticate(next http.Handler) http.Handler {
+	return sg.AuthenticateWith(VerifyOptions{}, next)
+}
+
+// AuthenticateWith like Authenticate, but accepting the tokens opts describes (e.g., service-role tokens too)
+func (sg *SupaGo) AuthenticateWith(opts VerifyOptions, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := sg.VerifyRequest(r, opts)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenClaimsContextKey{}, claims)))
+	})
+}
+
+// TokenClaimsFromContext the claims verified by Authenticate (nil if none)
+func TokenClaimsFromContext(ctx context.Context) *TokenClaims {
+	claims, _ := ctx.Value(tokenClaimsContextKey{}).(*TokenClaims)
+	return claims
+}
@@ -0,0 +1,133 @@
+package supago
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/train360-corp/supago/internal/jwk"
+	"testing"
+	"time"
+)
+
+func testKeysConfig(t *testing.T, signingKey *SigningKey) Config {
+	t.Helper()
+	keys, err := getJwtKeysConfig("0123456789abcdef0123456789abcdef", signingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{Keys: *keys}
+	cfg.Kong.URLs.Kong = "http://127.0.0.1:8000"
+	return cfg
+}
+
+func TestVerifyToken(t *testing.T) {
+	key, err := jwk.Generate(jwk.ES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, cfg := range map[string]Config{
+		"secret":      testKeysConfig(t, nil),
+		"signing key": testKeysConfig(t, &SigningKey{Algorithm: SigningAlgorithmES256, Private: key}),
+	} {
+		mint := func(opts TokenOptions) string {
+			token, err := cfg.MintToken(opts)
+			if err != nil {
+				t.Fatalf("%s: MintToken: %v", name, err)
+			}
+			return token
+		}
+		expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"aud": "authenticated", "role": "authenticated", "exp": time.Now().Add(-time.Minute).Unix(),
+		}).SignedString([]byte(cfg.Keys.JwtSecret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the shared secret (in every container's environment) only signs tokens while no signing key replaces it
+		shared, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"aud": "authenticated", "role": "authenticated", "exp": time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte(cfg.Keys.JwtSecret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"aud": "authenticated", "role": "authenticated", "exp": time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte("another-secret-another-secret-xx"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tc := range []struct {
+			name  string
+			token string
+			opts  VerifyOptions
+			valid bool
+		}{
+			{"user", mint(TokenOptions{Subject: "user-1"}), VerifyOptions{}, true},
+			{"anon key", cfg.Keys.PublicJwt, VerifyOptions{}, false},
+			{"anon key (service role allowed)", cfg.Keys.PublicJwt, VerifyOptions{AllowServiceRole: true}, false},
+			{"anon role", mint(TokenOptions{Role: "anon"}), VerifyOptions{}, false},
+			{"service key", cfg.Keys.PrivateJwt, VerifyOptions{}, false},
+			{"service key (allowed)", cfg.Keys.PrivateJwt, VerifyOptions{AllowServiceRole: true}, true},
+			{"other audience", mint(TokenOptions{Audience: "jobs"}), VerifyOptions{}, false},
+			{"custom audience", mint(TokenOptions{Audience: "jobs"}), VerifyOptions{Audience: "jobs"}, true},
+			{"expired", expired, VerifyOptions{}, false},
+			{"shared secret", shared, VerifyOptions{}, cfg.Keys.SigningKey == nil},
+			{"forged", forged, VerifyOptions{}, false},
+			{"malformed", "not.a.jwt", VerifyOptions{}, false},
+		} {
+			claims, err := cfg.VerifyToken(tc.token, tc.opts)
+			if tc.valid && err != nil {
+				t.Errorf("%s/%s: expected a valid token, got %v", name, tc.name, err)
+			} else if !tc.valid && err == nil {
+				t.Errorf("%s/%s: expected an invalid token, got claims for role %q", name, tc.name, claims.Role)
+			}
+		}
+	}
+}
+
+func TestMintTokenClaims(t *testing.T) {
+	cfg := testKeysConfig(t, nil)
+	token, err := cfg.MintToken(TokenOptions{
+		Subject:     "user-1",
+		Email:       "ada@example.com",
+		AppMetadata: map[string]any{"tenant": "acme"},
+		TTL:         5 * time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := cfg.VerifyToken(token, VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "ada@example.com" || claims.Role != "authenticated" {
+		t.Errorf("unexpected claims: %+v", claims)
+	} else if claims.AppMetadata["tenant"] != "acme" {
+		t.Errorf("expected app metadata tenant acme, got %v", claims.AppMetadata)
+	} else if ttl := time.Until(claims.ExpiresAt.Time); ttl > 5*time.Minute || ttl < 4*time.Minute {
+		t.Errorf("expected a 5 minute ttl, got %v", ttl)
+	}
+
+	if _, err := cfg.MintToken(TokenOptions{TTL: -time.Minute}); err == nil {
+		t.Errorf("expected a negative ttl to be rejected")
+	}
+}
+
+func TestVerifyTokenRetiringKeys(t *testing.T) {
+	cfg := testKeysConfig(t, nil)
+	old, err := cfg.MintToken(TokenOptions{Subject: "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := cfg
+	next.Keys.Retiring = &RetiringKeysConfig{JwtSecret: cfg.Keys.JwtSecret}
+	next.Keys.JwtSecret = "fedcba9876543210fedcba9876543210"
+	if err := next.Keys.mint(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := next.VerifyToken(old, VerifyOptions{}); err != nil {
+		t.Errorf("expected tokens of retiring keys to be valid, got %v", err)
+	}
+	next.Keys.Retiring = nil
+	if _, err := next.VerifyToken(old, VerifyOptions{}); err == nil {
+		t.Errorf("expected tokens of retired keys to be invalid")
+	}
+}
@@ -0,0 +1,236 @@
+package supago
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// postgresImages the (last) supabase/postgres image SupaGo ran for each earlier postgres major version
+var postgresImages = map[string]string{
+	"15": "supabase/postgres:15.8.1.060",
+}
+
+// DataDirectoryVersionError the database's data directory was initialized by a different postgres major version than
+// the database image runs (which cannot start on it); see SupaGo.Upgrade
+type DataDirectoryVersionError struct {
+	Directory    string
+	DataVersion  string // the postgres major version of the data directory (PG_VERSION)
+	Image        string
+	ImageVersion string // the postgres major version of the image
+}
+
+func (e *DataDirectoryVersionError) Error() string {
+	return fmt.Sprintf(
+		"postgres data directory \"%s\" was initialized by postgres %s, but %s runs postgres %s (upgrade it with SupaGo.Upgrade, or run a postgres %s image)",
+		e.Directory, e.DataVersion, e.Image, e.ImageVersion, e.DataVersion,
+	)
+}
+
+// imageMajorVersion the postgres major version of a supabase/postgres image (e.g., "17" for "supabase/postgres:17.4.1.055")
+func imageMajorVersion(image string) string {
+	_, tag, found := strings.Cut(image[strings.LastIndex(image, "/")+1:], ":")
+	if !found {
+		return ""
+	}
+	major, _, _ := strings.Cut(tag, ".")
+	return major
+}
+
+// dataDirectoryVersion the postgres major version a data directory was initialized by ("" if uninitialized)
+// The directory is usually only readable by the container's postgres user; it is then read through a container.
+// The caller must hold sg.mu
+func (sg *SupaGo) dataDirectoryVersion(ctx context.Context, db *Service) (string, error) {
+	dir := sg.config.Database.DataDirectory
+	if isUninitializedDataDirectory(dir) {
+		return "", nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "PG_VERSION"))
+	if err == nil {
+		return strings.TrimSpace(string(data)), nil
+	} else if !errors.Is(err, os.ErrPermission) {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("postgres data directory \"%s\" is not empty, but has no PG_VERSION", dir)
+		}
+		return "", fmt.Errorf("failed to read postgres data directory version: %w", err)
+	}
+
+	output, err := sg.runTask(ctx, Service{
+		Image:      db.Image,
+		Name:       db.Name + "-version",
+		Entrypoint: []string{"cat", "/var/lib/postgresql/data/PG_VERSION"},
+		Mounts:     db.Mounts,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read postgres data directory version: %w", err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// checkDataDirectoryVersion fails with a DataDirectoryVersionError if the database image cannot run on its data directory
+// The caller must hold sg.mu
+func (sg *SupaGo) checkDataDirectoryVersion(ctx context.Context) error {
+	db := sg.databaseService()
+	if db == nil {
+		return nil
+	}
+	imageVersion := imageMajorVersion(db.Image)
+	if imageVersion == "" {
+		sg.logger.Warnf("cannot tell the postgres version of image %s (skipping data directory version check)", db.Image)
+		return nil
+	}
+	dataVersion, err := sg.dataDirectoryVersion(ctx, db)
+	if err != nil {
+		return err
+	} else if dataVersion != "" && dataVersion != imageVersion {
+		return &DataDirectoryVersionError{
+			Directory:    sg.config.Database.DataDirectory,
+			DataVersion:  dataVersion,
+			Image:        db.Image,
+			ImageVersion: imageVersion,
+		}
+	}
+	return nil
+}
+
+type UpgradeOptions struct {
+	// FromImage (optional) the image to run the current data directory with while dumping it; defaults to the image
+	// SupaGo last shipped for the data directory's postgres version
+	FromImage string
+}
+
+type UpgradeResult struct {
+	FromVersion string
+	ToVersion   string
+	// PreviousDataDirectory where the data directory of the previous version was moved to (kept for rollback)
+	PreviousDataDirectory string
+	Duration              time.Duration
+}
+
+// Upgrade moves the database to the postgres major version of the database image, then starts the stack (as Run does)
+// The upgrade is a dump and restore: the current data directory is started with an image of its own version, dumped
+// (see Backup), and moved aside (see UpgradeResult.PreviousDataDirectory, which can be moved back to roll back); then
+// the stack is started on a new data directory, and the dump restored into it (see Restore). If the data directory
+// already matches the image, Upgrade only starts the stack.
+func (sg *SupaGo) Upgrade(ctx context.Context, opts UpgradeOptions) (*UpgradeResult, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	started := time.Now()
+	db := sg.databaseService()
+	if db == nil {
+		return nil, errors.New("no database service")
+	} else if err := sg.setupDocker(); err != nil {
+		return nil, fmt.Errorf("failed to setup docker connection: %w", err)
+	} else if err := sg.ensureNetwork(ctx); err != nil {
+		return nil, fmt.Errorf("failed to setup docker network: %w", err)
+	}
+
+	result := &UpgradeResult{ToVersion: imageMajorVersion(db.Image)}
+	var err error
+	if result.FromVersion, err = sg.dataDirectoryVersion(ctx, db); err != nil {
+		return nil, err
+	} else if result.FromVersion == "" || result.FromVersion == result.ToVersion {
+		sg.logger.Infof("postgres data directory is up to date (postgres %s)", result.ToVersion)
+		result.FromVersion = result.ToVersion
+		if err := sg.start(ctx, true); err != nil {
+			return nil, err
+		}
+		result.Duration = time.Since(started)
+		return result, nil
+	}
+
+	from := opts.FromImage
+	if from == "" {
+		if from = postgresImages[result.FromVersion]; from == "" {
+			return nil, fmt.Errorf("no known image for postgres %s (specify UpgradeOptions.FromImage)", result.FromVersion)
+		}
+	} else if version := imageMajorVersion(from); version != result.FromVersion {
+		return nil, fmt.Errorf("image %s runs postgres %s, but the data directory is postgres %s", from, version, result.FromVersion)
+	}
+	sg.logger.Infow("upgrading postgres",
+		"from", result.FromVersion,
+		"to", result.ToVersion,
+		"image", from,
+	)
+
+	// dump the current data directory, with an image of its own version
+	dump, err := os.CreateTemp("", "supago-upgrade-*.tar")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() {
+		_ = dump.Close()
+		_ = os.Remove(dump.Name())
+	}()
+	source, err := db.constructor(sg.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct postgres %s: %w", result.FromVersion, err)
+	}
+	source.Image = from
+	source.Name += "-upgrade"
+	source.Aliases = nil
+	source.Ports = nil
+	source.AfterStart = nil
+	if err := sg.startService(ctx, &source, true); err != nil {
+		sg.removeContainer(&source)
+		return nil, fmt.Errorf("failed to start postgres %s: %w", result.FromVersion, err)
+	}
+	_, err = sg.backup(ctx, &Database{docker: sg.docker, cid: source.container.ID, user: "supabase_admin", name: "postgres"}, sg.config.Global.PlatformName, dump, BackupOptions{})
+	if source.closeConn != nil {
+		source.closeConn()
+	}
+	sg.stopContainer(&source)
+	sg.removeContainer(&source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dump postgres %s: %w", result.FromVersion, err)
+	}
+
+	// move the data directory aside, then start the stack on a new one
+	dir := sg.config.Database.DataDirectory
+	result.PreviousDataDirectory = fmt.Sprintf("%s.pg%s-%s", dir, result.FromVersion, time.Now().UTC().Format("20060102T150405Z"))
+	if err := os.Rename(dir, result.PreviousDataDirectory); err != nil {
+		return nil, fmt.Errorf("failed to move data directory aside: %w", err)
+	}
+	sg.logger.Infof("moved data directory \"%s\" to \"%s\"", dir, result.PreviousDataDirectory)
+	for _, service := range sg.services { // rebuilt (the database's constructor creates the new data directory)
+		if service.constructor != nil {
+			rebuilt, err := sg.construct(service.constructor)
+			if err != nil {
+				return nil, fmt.Errorf("failed to rebuild %v (previous data directory kept at \"%s\"): %w", service, result.PreviousDataDirectory, err)
+			}
+			*service = *rebuilt
+		}
+	}
+	if err := sg.serveAuthCallbacks(ctx); err != nil { // before the auth container starts (as start does)
+		return nil, err
+	}
+	for _, service := range sg.services {
+		if err := sg.startService(ctx, service, true); err != nil {
+			return nil, fmt.Errorf("failed to start services (previous data directory kept at \"%s\"): %w", result.PreviousDataDirectory, err)
+		}
+	}
+
+	if _, err := dump.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind dump: %w", err)
+	} else if _, err := sg.restore(ctx, dump, RestoreOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to restore into postgres %s (previous data directory kept at \"%s\"): %w", result.ToVersion, result.PreviousDataDirectory, err)
+	}
+	if _, err := sg.migrate(ctx); err != nil {
+		return nil, fmt.Errorf("failed to apply migrations: %w", err)
+	}
+
+	result.Duration = time.Since(started)
+	sg.logger.Infow("upgrade completed",
+		"from", result.FromVersion,
+		"to", result.ToVersion,
+		"duration", result.Duration,
+		"previous_data_directory", result.PreviousDataDirectory,
+	)
+	return result, nil
+}
@@ -0,0 +1,41 @@
+package supago
+
+import (
+	"time"
+)
+
+// User a user of the auth service (GoTrue), as its API and hooks represent them
+type User struct {
+	ID               string         `json:"id"`
+	Aud              string         `json:"aud,omitempty"`
+	Role             string         `json:"role,omitempty"`
+	Email            string         `json:"email,omitempty"`
+	NewEmail         string         `json:"new_email,omitempty"`
+	Phone            string         `json:"phone,omitempty"`
+	NewPhone         string         `json:"new_phone,omitempty"`
+	EmailConfirmedAt *time.Time     `json:"email_confirmed_at,omitempty"`
+	PhoneConfirmedAt *time.Time     `json:"phone_confirmed_at,omitempty"`
+	ConfirmedAt      *time.Time     `json:"confirmed_at,omitempty"`
+	InvitedAt        *time.Time     `json:"invited_at,omitempty"`
+	LastSignInAt     *time.Time     `json:"last_sign_in_at,omitempty"`
+	BannedUntil      *time.Time     `json:"banned_until,omitempty"`
+	AppMetadata      map[string]any `json:"app_metadata,omitempty"`
+	UserMetadata     map[string]any `json:"user_metadata,omitempty"`
+	Identities       []Identity     `json:"identities,omitempty"`
+	IsAnonymous      bool           `json:"is_anonymous,omitempty"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+}
+
+// Identity a way a user signs in (e.g., their email, or an OAuth provider's account)
+type Identity struct {
+	ID           string         `json:"id"`
+	IdentityID   string         `json:"identity_id,omitempty"`
+	UserID       string         `json:"user_id"`
+	Provider     string         `json:"provider"`
+	Email        string         `json:"email,omitempty"`
+	IdentityData map[string]any `json:"identity_data,omitempty"`
+	LastSignInAt *time.Time     `json:"last_sign_in_at,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+}